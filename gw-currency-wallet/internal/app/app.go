@@ -2,19 +2,31 @@ package app
 
 import (
 	"context"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/currencies"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/delivery"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/denylist"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/exchanger"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/fees"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/grpc"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/limits"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/loginguard"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/mailer"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/middleware"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/quotes"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/ratelimit"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/service"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store/postgres"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/validation"
 	httpserver "github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/httpServer"
+	jwttoken "github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/jwtToken"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/redis"
 	"github.com/mizmorr/gw_currency/gw-exchanger/pkg/utils/lifecycle"
 	logger "github.com/mizmorr/loggerm"
+	"github.com/pkg/errors"
 )
 
 type component struct {
@@ -108,20 +120,83 @@ func (a *App) setUp(ctx context.Context) error {
 
 	cashExchanger := redis.NewRedisClient(ctx, a.config.Redis.Host, a.config.Redis.Port, a.config.Redis.Password)
 
-	exchanger, err := exchanger.New(remoteExchanger, cashExchanger, a.config.CurrencyCodes, a.config.Redis.TTL)
+	var rateProvider currencies.Provider
+	if a.config.Currencies.ProviderURL != "" {
+		rateProvider = currencies.NewRateProvider(a.config.Currencies.ProviderURL, a.config.Currencies.ProviderTimeout)
+	}
+	catalogue := currencies.New(repo, rateProvider, a.config.Currencies.CacheTTL)
+
+	exchanger, err := exchanger.New(remoteExchanger, cashExchanger, catalogue, a.config.Redis.TTL)
+	if err != nil {
+		return err
+	}
+
+	quoteStore := quotes.New(cashExchanger, a.config.Quotes.TTL)
+
+	feeSchedule, err := fees.New(a.config.Fees)
+	if err != nil {
+		return err
+	}
+
+	limitSchedule, err := limits.New(a.config.Limits)
+	if err != nil {
+		return err
+	}
+
+	accessKeys, err := loadAccessKeys(a.config.JWTtokens)
+	if err != nil {
+		return err
+	}
+
+	tokenDenylist := denylist.New(cashExchanger)
+
+	loginGuard := loginguard.New(cashExchanger, a.config.LoginGuard)
+
+	registration, err := validation.NewRegistration(a.config.Registration)
+	if err != nil {
+		return err
+	}
+
+	mail, err := mailer.New(a.config.Mailer, a.log)
 	if err != nil {
 		return err
 	}
 
-	service := service.New(repo, exchanger, a.config.JWTtokens)
+	service := service.New(repo, exchanger, catalogue, quoteStore, feeSchedule, limitSchedule, a.config.JWTtokens, accessKeys, tokenDenylist, loginGuard, registration, mail, a.config.EmailVerification, a.config.PasswordReset, a.config.MFA, a.config.Wallets)
 
 	walletController := delivery.NewWalletController(service)
 
 	handler := gin.New()
+	// the rate limit and the login lockout count by client IP, so the
+	// forwarded headers are only believed from the configured proxies
+	trustedProxies := a.config.TrustedProxies
+	if len(trustedProxies) == 0 {
+		trustedProxies = nil
+	}
+	if err = handler.SetTrustedProxies(trustedProxies); err != nil {
+		return errors.Wrap(err, "invalid trusted proxies")
+	}
 
-	authMiddleware := middleware.JWTAuthMiddleware(a.config.JWTtokens.AccessSecret)
+	authMiddleware := middleware.JWTAuthMiddleware(accessKeys, jwttoken.Expected{
+		Type:     jwttoken.TypeAccess,
+		Issuer:   a.config.JWTtokens.Issuer,
+		Audience: a.config.JWTtokens.Audience,
+	}, tokenDenylist)
+
+	idempotencyMiddleware := middleware.Idempotency(cashExchanger, a.config.Idempotency.KeyTTL)
+
+	var requestCounter ratelimit.Counter
+	switch a.config.RateLimit.Backend {
+	case "redis":
+		requestCounter = cashExchanger
+	case "memory":
+		requestCounter = ratelimit.NewMemoryCounter()
+	default:
+		return errors.Errorf("unknown rate limit backend %q", a.config.RateLimit.Backend)
+	}
+	rateLimit := middleware.RateLimit(ratelimit.New(requestCounter), a.config.RateLimit)
 
-	delivery.NewRouter(handler, authMiddleware, walletController)
+	delivery.NewRouter(handler, authMiddleware, idempotencyMiddleware, middleware.RequireRole(repo), rateLimit, walletController)
 
 	httpServer := httpserver.New(handler, a.config.HttpHost, a.config.HttpPort, a.config.ShutdownTimeout)
 
@@ -133,3 +208,27 @@ func (a *App) setUp(ctx context.Context) error {
 
 	return nil
 }
+
+// loadAccessKeys reads the access token keys from the configured PEM files,
+// falling back to HS256 with the access secret when no signing key is set.
+func loadAccessKeys(cfg config.JWTtokens) (*jwttoken.KeySet, error) {
+	if cfg.SigningKeyPath == "" {
+		return jwttoken.NewHMACKeySet(cfg.AccessSecret), nil
+	}
+
+	signingKey, err := os.ReadFile(cfg.SigningKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read signing key")
+	}
+
+	verificationKeys := make([][]byte, 0, len(cfg.VerificationKeyPaths))
+	for _, path := range cfg.VerificationKeyPaths {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read verification key %s", path)
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+
+	return jwttoken.NewKeySet(signingKey, verificationKeys...)
+}
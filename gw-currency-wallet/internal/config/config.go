@@ -23,11 +23,168 @@ type Config struct {
 
 	GRPC
 
-	Rates
+	Currencies
+
+	Wallets
+
+	Idempotency
+
+	Quotes
+
+	Fees
+
+	LoginGuard
+
+	RateLimit
+
+	Registration
+
+	Mailer
+
+	EmailVerification
+
+	PasswordReset
+
+	MFA
+
+	Limits
+}
+
+// Limits cap withdrawals and exchanges per currency over the last day and
+// the last 30 days, e.g. LIMITS.WITHDRAW.USD.DAILY=5000. An exchange counts
+// the amount sold. Zero means no limit for the period; an admin can give a
+// user limits of their own.
+type Limits struct {
+	Withdraw map[string]LimitRule
+	Exchange map[string]LimitRule
+}
+
+type LimitRule struct {
+	Daily   float64
+	Monthly float64
+}
+
+// Mailer sends the emails of the service. Transport is "smtp", "file"
+// (messages appended to FilePath) or "log" (only the recipient and the
+// subject are logged, the body carries one-time tokens).
+type Mailer struct {
+	Transport string
+	From      string
+	FilePath  string
+	SMTP      SMTP
+}
+
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// EmailVerification tokens are valid for TokenTTL; the link in the email is
+// VerifyURL followed by the token.
+type EmailVerification struct {
+	TokenTTL  time.Duration
+	VerifyURL string
+}
+
+// MFA is the optional two-factor authentication with TOTP codes. After the
+// password a login has ChallengeTTL to present a code. Withdrawals of more
+// than the threshold of their currency, e.g. MFA.WITHDRAWTHRESHOLDS.USD=1000,
+// require a code; currencies without a threshold never do.
+type MFA struct {
+	OTPIssuer          string
+	ChallengeTTL       time.Duration
+	WithdrawThresholds map[string]float64
+}
+
+// PasswordReset tokens are valid for ResetTokenTTL; the link in the email is
+// ResetURL followed by the token, it should lead to a page posting the token
+// with the new password to /api/v1/password/reset.
+type PasswordReset struct {
+	ResetTokenTTL time.Duration
+	ResetURL      string
+}
+
+// Registration is the policy for new accounts. BreachedPasswordsFile lists
+// one known leaked password per line; such passwords are refused.
+type Registration struct {
+	UsernameMinLength     int
+	UsernameMaxLength     int
+	PasswordMinLength     int
+	BreachedPasswordsFile string
+}
+
+// RateLimit limits requests per user, or per IP before authentication.
+// Limit applies to every route without its own rule in Routes, e.g.
+// RATELIMIT.ROUTES.EXCHANGE.REQUESTS=10. Backend is "redis" to share the
+// limits between replicas or "memory" for a single instance.
+type RateLimit struct {
+	Backend string
+	Limit   RateLimitRule
+	Routes  map[string]RateLimitRule
+}
+
+// RateLimitRule allows Requests per Window; zero requests means no limit.
+type RateLimitRule struct {
+	Requests int
+	Window   time.Duration
+}
+
+// LoginGuard limits failed logins. MaxAttempts failures of a username or
+// IPMaxAttempts failures from an address within Window lock it out for
+// LockoutDuration; before that every failure of a username doubles the wait
+// before its next attempt, from BaseDelay up to MaxDelay.
+type LoginGuard struct {
+	MaxAttempts     int
+	IPMaxAttempts   int
+	Window          time.Duration
+	LockoutDuration time.Duration
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+}
+
+// Fees is the exchange fee schedule. Pairs are keyed by "BASE_TARGET", e.g.
+// FEES.PAIRS.USD_EUR.PERCENT=1.5, and replace the default rule entirely.
+type Fees struct {
+	Default FeeRule
+	Pairs   map[string]FeeRule
+}
+
+// FeeRule values are percents except Minimum, which holds the minimum fee
+// per target currency in that currency, e.g. FEES.DEFAULT.MINIMUM.USD=0.5.
+// Tiers are "from:percent" items, where from is the amount in the base
+// currency starting at which the tier's percent is charged.
+type FeeRule struct {
+	Spread  float64
+	Percent float64
+	Minimum map[string]float64
+	Tiers   []string
+}
+
+// Wallets caps how many open wallets a user may have, the primary one
+// included.
+type Wallets struct {
+	MaxPerUser int
+}
+
+type Quotes struct {
+	TTL time.Duration
+}
+
+type Idempotency struct {
+	KeyTTL time.Duration
 }
 
-type Rates struct {
-	CurrencyCodes []string
+// Currencies configures the in-memory copy of the currency table. A change
+// made through the admin API applies at once on the instance that made it,
+// other instances pick it up within CacheTTL. ProviderURL is the rate source
+// of the exchanger; a currency is only enabled if it has a rate there. An
+// empty URL skips the check.
+type Currencies struct {
+	CacheTTL        time.Duration
+	ProviderURL     string
+	ProviderTimeout time.Duration
 }
 
 type GRPC struct {
@@ -35,10 +192,13 @@ type GRPC struct {
 	Port string
 }
 
+// Listen.TrustedProxies lists the proxies whose X-Forwarded-For header is
+// believed; by default the client IP is the address of the peer.
 type Listen struct {
 	HttpHost        string
 	HttpPort        string
 	ShutdownTimeout time.Duration
+	TrustedProxies  []string
 }
 
 type Storage struct {
@@ -65,7 +225,8 @@ type Redis struct {
 }
 
 type Worker struct {
-	KeepAliveTimeout time.Duration
+	KeepAliveTimeout  time.Duration
+	TokensPurgePeriod time.Duration
 }
 
 type Logger struct {
@@ -74,10 +235,14 @@ type Logger struct {
 }
 
 type JWTtokens struct {
-	RefreshSecret      string
-	AccessSecret       string
-	AccessExpiresTime  time.Duration
-	RefreshExpiresTime time.Duration
+	RefreshSecret        string
+	AccessSecret         string
+	AccessExpiresTime    time.Duration
+	RefreshExpiresTime   time.Duration
+	Issuer               string
+	Audience             string
+	SigningKeyPath       string
+	VerificationKeyPaths []string
 }
 
 var (
@@ -31,6 +31,12 @@ var defaults = []option{
 		value:       "5s",
 		description: "Timeout for graceful shutdown",
 	},
+	{
+		name:        "listen.trustedProxies",
+		typing:      "slice",
+		value:       []string{},
+		description: "Addresses or CIDRs of the proxies whose X-Forwarded-For header is trusted",
+	},
 
 	{
 		name:        "storage.postgres.URL",
@@ -74,6 +80,12 @@ var defaults = []option{
 		value:       "5s",
 		description: "Timeout for worker keep-alive",
 	},
+	{
+		name:        "worker.tokensPurgePeriod",
+		typing:      "duration",
+		value:       "1h",
+		description: "Period for deleting expired refresh tokens",
+	},
 	{
 		name:        "storage.redis.host",
 		typing:      "string",
@@ -128,6 +140,30 @@ var defaults = []option{
 		value:       "24h",
 		description: "Expiration time for the refresh token",
 	},
+	{
+		name:        "jwttokens.issuer",
+		typing:      "string",
+		value:       "gw-currency-wallet",
+		description: "Issuer (iss) of the tokens",
+	},
+	{
+		name:        "jwttokens.audience",
+		typing:      "string",
+		value:       "gw-currency",
+		description: "Audience (aud) of the tokens",
+	},
+	{
+		name:        "jwttokens.signingKeyPath",
+		typing:      "string",
+		value:       "",
+		description: "PEM private key (RSA or Ed25519) for signing access tokens; HS256 with the access secret if empty",
+	},
+	{
+		name:        "jwttokens.verificationKeyPaths",
+		typing:      "slice",
+		value:       []string{},
+		description: "PEM public keys of previous signing keys still accepted for access tokens",
+	},
 	{
 		name:        "grpc.host",
 		typing:      "string",
@@ -141,10 +177,346 @@ var defaults = []option{
 		description: "gRPC server port",
 	},
 	{
-		name:        "rates.currencycodes",
-		typing:      "slice",
-		value:       []string{"USD", "RUB", "EUR"},
-		description: "List of supported currencies",
+		name:        "currencies.cacheTTL",
+		typing:      "duration",
+		value:       "1m",
+		description: "How long the currency table is cached",
+	},
+	{
+		name:        "currencies.providerURL",
+		typing:      "string",
+		value:       "https://api.exchangerate-api.com/v4/latest/RUB",
+		description: "Rate provider of the exchanger, checked before a currency is enabled",
+	},
+	{
+		name:        "currencies.providerTimeout",
+		typing:      "duration",
+		value:       "5s",
+		description: "Timeout of a request to the rate provider",
+	},
+	{
+		name:        "wallets.maxPerUser",
+		typing:      "int",
+		value:       10,
+		description: "How many open wallets a user may have",
+	},
+	{
+		name:        "idempotency.keyTTL",
+		typing:      "duration",
+		value:       "24h",
+		description: "How long responses to requests with an Idempotency-Key are kept",
+	},
+	{
+		name:        "quotes.ttl",
+		typing:      "duration",
+		value:       "30s",
+		description: "How long an exchange quote keeps its rate",
+	},
+	{
+		name:        "fees.default.spread",
+		typing:      "float",
+		value:       0.0,
+		description: "Default spread off the mid rate, in percent",
+	},
+	{
+		name:        "fees.default.percent",
+		typing:      "float",
+		value:       0.0,
+		description: "Default exchange fee, in percent of the converted amount",
+	},
+	{
+		name:        "loginGuard.maxAttempts",
+		typing:      "int",
+		value:       5,
+		description: "Failed logins of a username before it is locked out",
+	},
+	{
+		name:        "loginGuard.ipMaxAttempts",
+		typing:      "int",
+		value:       50,
+		description: "Failed logins from an IP before it is locked out",
+	},
+	{
+		name:        "loginGuard.window",
+		typing:      "duration",
+		value:       "15m",
+		description: "Window failed logins are counted in",
+	},
+	{
+		name:        "loginGuard.lockoutDuration",
+		typing:      "duration",
+		value:       "15m",
+		description: "How long a username or an IP stays locked out",
+	},
+	{
+		name:        "loginGuard.baseDelay",
+		typing:      "duration",
+		value:       "1s",
+		description: "Wait after the first failed login of a username, doubled with every next failure",
+	},
+	{
+		name:        "loginGuard.maxDelay",
+		typing:      "duration",
+		value:       "30s",
+		description: "Maximum wait between failed logins of a username",
+	},
+	{
+		name:        "rateLimit.backend",
+		typing:      "string",
+		value:       "redis",
+		description: "Where request counters are kept: redis or memory",
+	},
+	{
+		name:        "rateLimit.limit.requests",
+		typing:      "int",
+		value:       100,
+		description: "Requests allowed per window on routes without their own limit",
+	},
+	{
+		name:        "rateLimit.limit.window",
+		typing:      "duration",
+		value:       "1m",
+		description: "Window of the default request limit",
+	},
+	{
+		name:        "rateLimit.routes.login.requests",
+		typing:      "int",
+		value:       10,
+		description: "Login requests allowed per window",
+	},
+	{
+		name:        "rateLimit.routes.login.window",
+		typing:      "duration",
+		value:       "1m",
+		description: "Window of the login request limit",
+	},
+	{
+		name:        "rateLimit.routes.register.requests",
+		typing:      "int",
+		value:       5,
+		description: "Registrations allowed per window",
+	},
+	{
+		name:        "rateLimit.routes.register.window",
+		typing:      "duration",
+		value:       "1h",
+		description: "Window of the registration limit",
+	},
+	{
+		name:        "rateLimit.routes.exchange.requests",
+		typing:      "int",
+		value:       20,
+		description: "Exchange and quote requests allowed per window",
+	},
+	{
+		name:        "rateLimit.routes.exchange.window",
+		typing:      "duration",
+		value:       "1m",
+		description: "Window of the exchange request limit",
+	},
+	{
+		name:        "rateLimit.routes.password.requests",
+		typing:      "int",
+		value:       5,
+		description: "Password reset requests allowed per window",
+	},
+	{
+		name:        "rateLimit.routes.password.window",
+		typing:      "duration",
+		value:       "1h",
+		description: "Window of the password reset limit",
+	},
+	{
+		name:        "registration.usernameMinLength",
+		typing:      "int",
+		value:       3,
+		description: "Minimum username length",
+	},
+	{
+		name:        "registration.usernameMaxLength",
+		typing:      "int",
+		value:       32,
+		description: "Maximum username length",
+	},
+	{
+		name:        "registration.passwordMinLength",
+		typing:      "int",
+		value:       8,
+		description: "Minimum password length",
+	},
+	{
+		name:        "registration.breachedPasswordsFile",
+		typing:      "string",
+		value:       "",
+		description: "File with known breached passwords, one per line; not checked if empty",
+	},
+	{
+		name:        "mailer.transport",
+		typing:      "string",
+		value:       "file",
+		description: "How emails are sent: smtp, file or log",
+	},
+	{
+		name:        "mailer.from",
+		typing:      "string",
+		value:       "no-reply@gw-currency.local",
+		description: "Sender address of the emails",
+	},
+	{
+		name:        "mailer.filePath",
+		typing:      "string",
+		value:       "./logs/mail.log",
+		description: "File emails are appended to by the file transport",
+	},
+	{
+		name:        "mailer.smtp.host",
+		typing:      "string",
+		value:       "localhost",
+		description: "SMTP server host",
+	},
+	{
+		name:        "mailer.smtp.port",
+		typing:      "string",
+		value:       "25",
+		description: "SMTP server port",
+	},
+	{
+		name:        "mailer.smtp.username",
+		typing:      "string",
+		value:       "",
+		description: "SMTP username; no authentication if empty",
+	},
+	{
+		name:        "mailer.smtp.password",
+		typing:      "string",
+		value:       "",
+		description: "SMTP password",
+	},
+	{
+		name:        "emailVerification.tokenTTL",
+		typing:      "duration",
+		value:       "24h",
+		description: "How long an email verification link is valid",
+	},
+	{
+		name:        "emailVerification.verifyURL",
+		typing:      "string",
+		value:       "http://localhost:8080/api/v1/verify-email?token=",
+		description: "Link sent for email verification, the token is appended to it",
+	},
+	{
+		name:        "passwordReset.resetTokenTTL",
+		typing:      "duration",
+		value:       "1h",
+		description: "How long a password reset link is valid",
+	},
+	{
+		name:        "passwordReset.resetURL",
+		typing:      "string",
+		value:       "http://localhost:8080/reset-password?token=",
+		description: "Link sent for password reset, the token is appended to it",
+	},
+	{
+		name:        "mfa.otpIssuer",
+		typing:      "string",
+		value:       "gw-currency-wallet",
+		description: "Issuer shown by authenticator apps",
+	},
+	{
+		name:        "mfa.challengeTTL",
+		typing:      "duration",
+		value:       "5m",
+		description: "Time to enter the two-factor code after the password",
+	},
+	{
+		name:        "mfa.withdrawThresholds.usd",
+		typing:      "float",
+		value:       1000.0,
+		description: "USD withdrawals above this amount require a two-factor code",
+	},
+	{
+		name:        "mfa.withdrawThresholds.eur",
+		typing:      "float",
+		value:       1000.0,
+		description: "EUR withdrawals above this amount require a two-factor code",
+	},
+	{
+		name:        "mfa.withdrawThresholds.rub",
+		typing:      "float",
+		value:       100000.0,
+		description: "RUB withdrawals above this amount require a two-factor code",
+	},
+	{
+		name:        "limits.withdraw.usd.daily",
+		typing:      "float",
+		value:       10000.0,
+		description: "USD withdrawn in a day; no limit if zero",
+	},
+	{
+		name:        "limits.withdraw.usd.monthly",
+		typing:      "float",
+		value:       50000.0,
+		description: "USD withdrawn in 30 days; no limit if zero",
+	},
+	{
+		name:        "limits.withdraw.eur.daily",
+		typing:      "float",
+		value:       10000.0,
+		description: "EUR withdrawn in a day; no limit if zero",
+	},
+	{
+		name:        "limits.withdraw.eur.monthly",
+		typing:      "float",
+		value:       50000.0,
+		description: "EUR withdrawn in 30 days; no limit if zero",
+	},
+	{
+		name:        "limits.withdraw.rub.daily",
+		typing:      "float",
+		value:       1000000.0,
+		description: "RUB withdrawn in a day; no limit if zero",
+	},
+	{
+		name:        "limits.withdraw.rub.monthly",
+		typing:      "float",
+		value:       5000000.0,
+		description: "RUB withdrawn in 30 days; no limit if zero",
+	},
+	{
+		name:        "limits.exchange.usd.daily",
+		typing:      "float",
+		value:       20000.0,
+		description: "USD sold in exchanges in a day; no limit if zero",
+	},
+	{
+		name:        "limits.exchange.usd.monthly",
+		typing:      "float",
+		value:       100000.0,
+		description: "USD sold in exchanges in 30 days; no limit if zero",
+	},
+	{
+		name:        "limits.exchange.eur.daily",
+		typing:      "float",
+		value:       20000.0,
+		description: "EUR sold in exchanges in a day; no limit if zero",
+	},
+	{
+		name:        "limits.exchange.eur.monthly",
+		typing:      "float",
+		value:       100000.0,
+		description: "EUR sold in exchanges in 30 days; no limit if zero",
+	},
+	{
+		name:        "limits.exchange.rub.daily",
+		typing:      "float",
+		value:       2000000.0,
+		description: "RUB sold in exchanges in a day; no limit if zero",
+	},
+	{
+		name:        "limits.exchange.rub.monthly",
+		typing:      "float",
+		value:       10000000.0,
+		description: "RUB sold in exchanges in 30 days; no limit if zero",
 	},
 }
 
@@ -0,0 +1,152 @@
+package currencies
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported currency")
+	ErrDisabled    = errors.New("currency is disabled")
+	ErrNotQuoted   = errors.New("rate provider has no rate for the currency")
+)
+
+type Storage interface {
+	GetCurrencies(ctx context.Context) ([]*store.Currency, error)
+}
+
+// Provider lists the currencies the exchanger can get rates for.
+type Provider interface {
+	Published(ctx context.Context) (map[string]bool, error)
+}
+
+// Catalogue keeps the currency table in memory and reads it again once the
+// TTL has passed. Every load also replaces the rounding rules of the money
+// package, so amounts follow the minor units of the table.
+type Catalogue struct {
+	storage  Storage
+	provider Provider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	list     []*store.Currency
+	byCode   map[string]*store.Currency
+	loadedAt time.Time
+}
+
+// New builds the catalogue. Without a provider every code counts as quoted.
+func New(storage Storage, provider Provider, ttl time.Duration) *Catalogue {
+	return &Catalogue{
+		storage:  storage,
+		provider: provider,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// Enabled returns the enabled currencies ordered by code.
+func (c *Catalogue) Enabled(ctx context.Context) ([]*store.Currency, error) {
+	list, _, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := make([]*store.Currency, 0, len(list))
+	for _, currency := range list {
+		if currency.Enabled {
+			enabled = append(enabled, currency)
+		}
+	}
+	return enabled, nil
+}
+
+// Codes returns the codes of the enabled currencies.
+func (c *Catalogue) Codes(ctx context.Context) ([]string, error) {
+	enabled, err := c.Enabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, len(enabled))
+	for _, currency := range enabled {
+		codes = append(codes, currency.Code)
+	}
+	return codes, nil
+}
+
+// Check refuses currencies missing from the catalogue. Funds coming into a
+// currency also need it to be enabled; a disabled currency can still be
+// withdrawn and exchanged from.
+func (c *Catalogue) Check(ctx context.Context, code string, incoming bool) error {
+	_, byCode, err := c.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	currency, ok := byCode[code]
+	if !ok {
+		return errors.Wrap(ErrUnsupported, code)
+	}
+	if incoming && !currency.Enabled {
+		return errors.Wrap(ErrDisabled, code)
+	}
+	return nil
+}
+
+// Quoted refuses codes the rate provider does not publish: the exchanger
+// would never get a rate for them, so they cannot be enabled.
+func (c *Catalogue) Quoted(ctx context.Context, code string) error {
+	if c.provider == nil {
+		return nil
+	}
+
+	published, err := c.provider.Published(ctx)
+	if err != nil {
+		return err
+	}
+	if !published[code] {
+		return errors.Wrap(ErrNotQuoted, code)
+	}
+	return nil
+}
+
+// Invalidate makes the next call read the table again.
+func (c *Catalogue) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.byCode = nil
+}
+
+// load returns the cached catalogue, reading it first if it is missing or
+// older than the TTL. Concurrent callers wait for a single read.
+func (c *Catalogue) load(ctx context.Context) ([]*store.Currency, map[string]*store.Currency, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byCode != nil && c.now().Sub(c.loadedAt) < c.ttl {
+		return c.list, c.byCode, nil
+	}
+
+	list, err := c.storage.GetCurrencies(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to load currencies")
+	}
+
+	byCode := make(map[string]*store.Currency, len(list))
+	units := make(map[string]int32, len(list))
+	for _, currency := range list {
+		byCode[currency.Code] = currency
+		units[currency.Code] = currency.MinorUnits
+	}
+	money.SetMinorUnits(units)
+
+	c.list, c.byCode, c.loadedAt = list, byCode, c.now()
+	return c.list, c.byCode, nil
+}
@@ -0,0 +1,117 @@
+package currencies
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStorage struct {
+	currencies []*store.Currency
+	err        error
+	calls      int
+}
+
+func (s *fakeStorage) GetCurrencies(_ context.Context) ([]*store.Currency, error) {
+	s.calls++
+	return s.currencies, s.err
+}
+
+func newStorage() *fakeStorage {
+	return &fakeStorage{currencies: []*store.Currency{
+		{Code: "EUR", Name: "Euro", MinorUnits: 2, Enabled: true},
+		{Code: "JPY", Name: "Japanese yen", MinorUnits: 0, Enabled: true},
+		{Code: "RUB", Name: "Russian ruble", MinorUnits: 2, Enabled: false},
+	}}
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	catalogue := New(newStorage(), nil, time.Minute)
+	defer money.SetMinorUnits(nil)
+
+	assert.NoError(t, catalogue.Check(ctx, "EUR", true))
+	assert.NoError(t, catalogue.Check(ctx, "EUR", false))
+
+	// из отключённой валюты можно вывести средства, но не зачислить их
+	assert.NoError(t, catalogue.Check(ctx, "RUB", false))
+	assert.True(t, errors.Is(catalogue.Check(ctx, "RUB", true), ErrDisabled))
+
+	assert.True(t, errors.Is(catalogue.Check(ctx, "GBP", false), ErrUnsupported))
+
+	// правила округления берутся из справочника
+	assert.Equal(t, int32(0), money.MinorUnits("JPY"))
+}
+
+func TestCodes(t *testing.T) {
+	catalogue := New(newStorage(), nil, time.Minute)
+	defer money.SetMinorUnits(nil)
+
+	codes, err := catalogue.Codes(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"EUR", "JPY"}, codes)
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	storage := newStorage()
+	catalogue := New(storage, nil, time.Minute)
+	defer money.SetMinorUnits(nil)
+
+	now := time.Now()
+	catalogue.now = func() time.Time { return now }
+
+	_, err := catalogue.Codes(ctx)
+	assert.NoError(t, err)
+	_, err = catalogue.Codes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, storage.calls)
+
+	// после TTL справочник читается заново
+	now = now.Add(time.Minute)
+	assert.NoError(t, catalogue.Check(ctx, "EUR", true))
+	assert.Equal(t, 2, storage.calls)
+
+	catalogue.Invalidate()
+	assert.NoError(t, catalogue.Check(ctx, "EUR", true))
+	assert.Equal(t, 3, storage.calls)
+
+	// ошибка чтения не кэшируется
+	catalogue.Invalidate()
+	storage.err = errors.New("connection refused")
+	assert.Error(t, catalogue.Check(ctx, "EUR", true))
+	storage.err = nil
+	assert.NoError(t, catalogue.Check(ctx, "EUR", true))
+	assert.Equal(t, 5, storage.calls)
+}
+
+func TestQuoted(t *testing.T) {
+	ctx := context.Background()
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"base": "RUB", "rates": {"RUB": 1, "USD": 0.011, "EUR": 0.0098}}`))
+	}))
+	defer server.Close()
+
+	catalogue := New(newStorage(), NewRateProvider(server.URL, time.Second), time.Minute)
+	assert.NoError(t, catalogue.Quoted(ctx, "USD"))
+	assert.ErrorIs(t, catalogue.Quoted(ctx, "XYZ"), ErrNotQuoted)
+
+	// недоступный провайдер — это не ошибка кода валюты
+	status = http.StatusServiceUnavailable
+	err := catalogue.Quoted(ctx, "USD")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotQuoted)
+
+	// без провайдера проверка пропускается
+	assert.NoError(t, New(newStorage(), nil, time.Minute).Quoted(ctx, "XYZ"))
+}
@@ -0,0 +1,56 @@
+package currencies
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RateProvider asks the rate source of the exchanger which currencies it
+// publishes. The response has the shape of exchangerate-api:
+// {"base": "RUB", "rates": {"USD": 0.011, ...}}.
+type RateProvider struct {
+	url    string
+	client *http.Client
+}
+
+func NewRateProvider(url string, timeout time.Duration) *RateProvider {
+	return &RateProvider{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Published returns the codes the provider has rates for.
+func (p *RateProvider) Published(ctx context.Context) (map[string]bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build provider request")
+	}
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to reach the rate provider")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("rate provider answered %s", response.Status)
+	}
+
+	var data struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&data); err != nil {
+		return nil, errors.Wrap(err, "failed to decode provider rates")
+	}
+
+	codes := make(map[string]bool, len(data.Rates))
+	for code := range data.Rates {
+		codes[code] = true
+	}
+	return codes, nil
+}
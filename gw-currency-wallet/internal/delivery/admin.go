@@ -0,0 +1,467 @@
+package delivery
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/currencies"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+// @Summary Find users
+// @Description Finds users whose username or email starts with the query. Requires the support or admin role
+// @Tags admin
+// @Produce  json
+// @Security BearerAuth
+// @Param q query string true "Start of the username or email"
+// @Param limit query int false "Number of users, at most 100"
+// @Success 200 {array} domain.AdminUserResponse
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 500 {object} map[string]string "failed to find users"
+// @Router /admin/users [get]
+func (wc *WalletController) AdminFindUsers(c *gin.Context) {
+	actorID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.AdminUsersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	users, err := wc.service.AdminFindUsers(c.Request.Context(), actorID.(int64), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// @Summary Get a user
+// @Description Returns the account of a user. Requires the support or admin role
+// @Tags admin
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} domain.AdminUserResponse
+// @Failure 400 {object} map[string]string "invalid user id"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 404 {object} map[string]string "user not found"
+// @Failure 500 {object} map[string]string "failed to get user"
+// @Router /admin/users/{id} [get]
+func (wc *WalletController) AdminGetUser(c *gin.Context) {
+	actorID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	user, err := wc.service.AdminGetUser(c.Request.Context(), actorID, userID)
+	if errors.Is(err, store.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// @Summary Get a user's balance
+// @Description Returns the balance of one of a user's wallets, the primary one unless wallet_id is given. Requires the support or admin role
+// @Tags admin
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param wallet_id query int false "Wallet id"
+// @Success 200 {array} domain.BalanceResponse
+// @Failure 400 {object} map[string]string "invalid user id"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 404 {object} map[string]string "wallet not found"
+// @Failure 500 {object} map[string]string "failed to get balance"
+// @Router /admin/users/{id}/balance [get]
+func (wc *WalletController) AdminGetBalance(c *gin.Context) {
+	actorID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var req domain.BalanceRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	balance, err := wc.service.AdminGetBalance(c.Request.Context(), actorID, userID, req.WalletID)
+	if errors.Is(err, store.ErrWalletNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get balance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
+// @Summary Get a user's transactions
+// @Description Returns the operations of a user, newest first. Requires the support or admin role
+// @Tags admin
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param type query string false "Operation type" Enums(deposit, withdraw, exchange, transfer, move)
+// @Param wallet_id query int false "Only operations touching this wallet"
+// @Param currency query string false "Currency code"
+// @Param from query string false "Start of the period, RFC 3339"
+// @Param to query string false "End of the period, RFC 3339"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param limit query int false "Page size, at most 100"
+// @Success 200 {object} domain.TransactionsResponse
+// @Failure 400 {object} map[string]string "invalid request or from is after to"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 500 {object} map[string]string "failed to get transactions"
+// @Router /admin/users/{id}/transactions [get]
+func (wc *WalletController) AdminGetTransactions(c *gin.Context) {
+	actorID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var req domain.TransactionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if invalidPeriod(&req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": domain.ErrInvalidPeriod.Error()})
+		return
+	}
+
+	transactions, err := wc.service.AdminTransactions(c.Request.Context(), actorID, userID, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transactions)
+}
+
+// @Summary Unlock user login
+// @Description Clears the failed login attempts and the lockout of a user. Requires the support or admin role
+// @Tags admin
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string "user unlocked"
+// @Failure 400 {object} map[string]string "invalid user id"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 404 {object} map[string]string "user not found"
+// @Failure 500 {object} map[string]string "failed to unlock user"
+// @Router /admin/users/{id}/unlock [post]
+func (wc *WalletController) UnlockUser(c *gin.Context) {
+	actorID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	err := wc.service.UnlockUser(c.Request.Context(), actorID, userID)
+	if errors.Is(err, store.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "user unlocked"})
+}
+
+// @Summary Freeze a user
+// @Description Blocks logins, token refreshes and operations of a user and ends the user's sessions. Requires the admin role
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body domain.AdminActionRequest true "Reason"
+// @Success 200 {object} map[string]string "user frozen"
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 404 {object} map[string]string "user not found"
+// @Failure 409 {object} map[string]string "account is frozen"
+// @Failure 500 {object} map[string]string "failed to freeze user"
+// @Router /admin/users/{id}/freeze [post]
+func (wc *WalletController) FreezeUser(c *gin.Context) {
+	actorID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var req domain.AdminActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.FreezeUser(c.Request.Context(), actorID, userID, &req)
+	if !adminChangeFailed(c, err, "failed to freeze user") {
+		c.JSON(http.StatusOK, gin.H{"message": "user frozen"})
+	}
+}
+
+// @Summary Unfreeze a user
+// @Description Lifts the freeze of a user. Requires the admin role
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body domain.AdminActionRequest true "Reason"
+// @Success 200 {object} map[string]string "user unfrozen"
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 404 {object} map[string]string "user not found"
+// @Failure 409 {object} map[string]string "account is not frozen"
+// @Failure 500 {object} map[string]string "failed to unfreeze user"
+// @Router /admin/users/{id}/unfreeze [post]
+func (wc *WalletController) UnfreezeUser(c *gin.Context) {
+	actorID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var req domain.AdminActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.UnfreezeUser(c.Request.Context(), actorID, userID, &req)
+	if !adminChangeFailed(c, err, "failed to unfreeze user") {
+		c.JSON(http.StatusOK, gin.H{"message": "user unfrozen"})
+	}
+}
+
+// @Summary Set a user's role
+// @Description Changes the role of a user and ends the user's sessions, so the role is applied from the next login. Requires the admin role
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body domain.SetRoleRequest true "Role and reason"
+// @Success 200 {object} map[string]string "role changed"
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 404 {object} map[string]string "user not found"
+// @Failure 500 {object} map[string]string "failed to change role"
+// @Router /admin/users/{id}/role [put]
+func (wc *WalletController) SetUserRole(c *gin.Context) {
+	actorID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var req domain.SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.SetUserRole(c.Request.Context(), actorID, userID, &req)
+	if !adminChangeFailed(c, err, "failed to change role") {
+		c.JSON(http.StatusOK, gin.H{"message": "role changed"})
+	}
+}
+
+// @Summary Set a user's wallet status
+// @Description Freezes, unfreezes or closes a wallet of a user, the primary one unless wallet_id is given. A frozen wallet only accepts incoming funds, a closed one accepts nothing and cannot be reopened, so only a wallet without funds can be closed. Requires the admin role
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body domain.WalletStatusRequest true "Status and reason"
+// @Success 200 {object} map[string]string "wallet status changed"
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 404 {object} map[string]string "user or wallet not found"
+// @Failure 409 {object} map[string]string "wallet is closed, already has this status or still holds funds"
+// @Failure 500 {object} map[string]string "failed to change wallet status"
+// @Router /admin/users/{id}/wallet/status [put]
+func (wc *WalletController) SetWalletStatus(c *gin.Context) {
+	actorID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var req domain.WalletStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.SetWalletStatus(c.Request.Context(), actorID, userID, &req)
+	if !adminChangeFailed(c, err, "failed to change wallet status") {
+		c.JSON(http.StatusOK, gin.H{"message": "wallet status changed"})
+	}
+}
+
+// @Summary Set a user's limit
+// @Description Gives a user a withdrawal or exchange limit of their own in a currency. A null period falls back to the configured limit; with both periods null the user's limit is removed. Requires the admin role
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param request body domain.SetLimitRequest true "Limit and reason"
+// @Success 200 {object} map[string]string "limit changed"
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 404 {object} map[string]string "user not found"
+// @Failure 500 {object} map[string]string "failed to change limit"
+// @Router /admin/users/{id}/limits [put]
+func (wc *WalletController) SetUserLimit(c *gin.Context) {
+	actorID, userID, ok := adminTarget(c)
+	if !ok {
+		return
+	}
+
+	var req domain.SetLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.SetUserLimit(c.Request.Context(), actorID, userID, &req)
+	if !adminChangeFailed(c, err, "failed to change limit") {
+		c.JSON(http.StatusOK, gin.H{"message": "limit changed"})
+	}
+}
+
+// @Summary Add or change a currency
+// @Description Adds a currency to the catalogue, or renames, enables or disables an existing one. Wallets get a balance in an enabled currency with their first credit in it; a disabled currency accepts no funds but can still be withdrawn and exchanged from. Minor units cannot change once the currency exists, and a currency can only be enabled if the rate provider publishes a rate for it. Requires the admin role
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param code path string true "Three-letter currency code"
+// @Param request body domain.SetCurrencyRequest true "Currency and reason"
+// @Success 200 {object} map[string]string "currency saved"
+// @Failure 400 {object} map[string]string "invalid request or no rate at the provider"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 409 {object} map[string]string "minor units of an existing currency cannot change"
+// @Failure 500 {object} map[string]string "failed to save currency"
+// @Router /admin/currencies/{code} [put]
+func (wc *WalletController) SetCurrency(c *gin.Context) {
+	actorID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.SetCurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.SetCurrency(c.Request.Context(), actorID.(int64), c.Param("code"), &req)
+	if !adminChangeFailed(c, err, "failed to save currency") {
+		c.JSON(http.StatusOK, gin.H{"message": "currency saved"})
+	}
+}
+
+// @Summary Get the audit log
+// @Description Returns the recorded actions of support and admin users, newest first. Requires the admin role
+// @Tags admin
+// @Produce  json
+// @Security BearerAuth
+// @Param user_id query int false "Only actions about this user"
+// @Param cursor query string false "Cursor from the previous page"
+// @Param limit query int false "Page size, at most 100"
+// @Success 200 {object} domain.AuditLogResponse
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "insufficient permissions"
+// @Failure 500 {object} map[string]string "failed to get audit log"
+// @Router /admin/audit [get]
+func (wc *WalletController) GetAuditLog(c *gin.Context) {
+	actorID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.AuditLogRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	entries, err := wc.service.AuditLog(c.Request.Context(), actorID.(int64), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// adminTarget returns the acting user and the user of the path, answering
+// the request itself if either is missing.
+func adminTarget(c *gin.Context) (int64, int64, bool) {
+	actorID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return 0, 0, false
+	}
+
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return 0, 0, false
+	}
+	return actorID.(int64), userID, true
+}
+
+// adminChangeFailed answers the request if the change failed.
+func adminChangeFailed(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, domain.ErrOwnAccount), errors.Is(err, domain.ErrInvalidLimit),
+		errors.Is(err, domain.ErrInvalidCurrencyCode), errors.Is(err, currencies.ErrUnsupported),
+		errors.Is(err, currencies.ErrNotQuoted):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, store.ErrUserNotFound), errors.Is(err, store.ErrWalletNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, store.ErrAccountFrozen), errors.Is(err, store.ErrAccountNotFrozen),
+		errors.Is(err, store.ErrWalletClosed), errors.Is(err, store.ErrWalletStatusSame), errors.Is(err, store.ErrWalletNotEmpty),
+		errors.Is(err, store.ErrMinorUnitsFixed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return true
+}
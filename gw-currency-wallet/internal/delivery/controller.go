@@ -3,21 +3,63 @@ package delivery
 import (
 	"context"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/loginguard"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/quotes"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	jwttoken "github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/jwtToken"
 	"github.com/pkg/errors"
 )
 
 type WalletExchangeService interface {
 	RegisterUser(ctx context.Context, user *domain.RegisterRequest) error
-	LoginUser(ctx context.Context, user *domain.AuthorizationRequest) (*domain.TokenResponse, error)
-	GetBalance(ctx context.Context, userid int64) ([]*domain.BalanceResponse, error)
+	LoginUser(ctx context.Context, user *domain.AuthorizationRequest, client *domain.Client) (*domain.LoginResponse, error)
+	LoginMFA(ctx context.Context, req *domain.MFALoginRequest, client *domain.Client) (*domain.TokenResponse, error)
+	GetBalance(ctx context.Context, userid, walletID int64) ([]*domain.BalanceResponse, error)
+	Wallets(ctx context.Context, userid int64) ([]*domain.WalletResponse, error)
+	CreateWallet(ctx context.Context, userid int64, req *domain.CreateWalletRequest) (*domain.WalletResponse, error)
+	MoveFunds(ctx context.Context, userid int64, req *domain.MoveRequest) ([]*domain.WalletResponse, error)
 	Deposit(ctx context.Context, userid int64, req *domain.DepositRequest) ([]*domain.BalanceResponse, error)
 	Withdraw(ctx context.Context, userid int64, req *domain.WithdrawRequest) ([]*domain.BalanceResponse, error)
+	Transfer(ctx context.Context, userid int64, req *domain.TransferRequest) (*domain.TransferResponse, error)
+	Transactions(ctx context.Context, userid int64, req *domain.TransactionsRequest) (*domain.TransactionsResponse, error)
 	ExchangeRates(ctx context.Context) ([]*domain.RateResponse, error)
+	Currencies(ctx context.Context) ([]*domain.CurrencyResponse, error)
+	ExchangeQuote(ctx context.Context, userid int64, req *domain.ExchangeQuoteRequest) (*domain.ExchangeQuoteResponse, error)
 	Exchange(ctx context.Context, userid int64, req *domain.ExchangeRequest) (*domain.ExchangeResponse, error)
-	Refresh(ctx context.Context, req *domain.RefreshRequest) (*domain.TokenResponse, error)
+	Refresh(ctx context.Context, req *domain.RefreshRequest, client *domain.Client) (*domain.TokenResponse, error)
+	Logout(ctx context.Context, req *domain.RefreshRequest, accessToken string) error
+	LogoutAll(ctx context.Context, userid int64, access *domain.AccessToken) error
+	Sessions(ctx context.Context, userid int64) ([]*domain.SessionResponse, error)
+	RevokeSession(ctx context.Context, userid, sessionID int64) error
+	UnlockUser(ctx context.Context, actorID, userid int64) error
+	AdminFindUsers(ctx context.Context, actorID int64, req *domain.AdminUsersRequest) ([]*domain.AdminUserResponse, error)
+	AdminGetUser(ctx context.Context, actorID, userid int64) (*domain.AdminUserResponse, error)
+	AdminGetBalance(ctx context.Context, actorID, userid, walletID int64) ([]*domain.BalanceResponse, error)
+	AdminTransactions(ctx context.Context, actorID, userid int64, req *domain.TransactionsRequest) (*domain.TransactionsResponse, error)
+	FreezeUser(ctx context.Context, actorID, userid int64, req *domain.AdminActionRequest) error
+	UnfreezeUser(ctx context.Context, actorID, userid int64, req *domain.AdminActionRequest) error
+	SetUserRole(ctx context.Context, actorID, userid int64, req *domain.SetRoleRequest) error
+	SetWalletStatus(ctx context.Context, actorID, userid int64, req *domain.WalletStatusRequest) error
+	SetUserLimit(ctx context.Context, actorID, userid int64, req *domain.SetLimitRequest) error
+	SetCurrency(ctx context.Context, actorID int64, code string, req *domain.SetCurrencyRequest) error
+	Limits(ctx context.Context, userid int64) ([]*domain.LimitResponse, error)
+	AuditLog(ctx context.Context, actorID int64, req *domain.AuditLogRequest) (*domain.AuditLogResponse, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, userid int64) error
+	ForgotPassword(ctx context.Context, req *domain.ForgotPasswordRequest) error
+	ResetPassword(ctx context.Context, req *domain.ResetPasswordRequest) error
+	ChangePassword(ctx context.Context, userid int64, req *domain.ChangePasswordRequest) error
+	EnrollMFA(ctx context.Context, userid int64) (*domain.MFAEnrollResponse, error)
+	ConfirmMFA(ctx context.Context, userid int64, req *domain.MFACodeRequest) (*domain.RecoveryCodesResponse, error)
+	DisableMFA(ctx context.Context, userid int64, req *domain.MFACodeRequest) error
+	RegenerateRecoveryCodes(ctx context.Context, userid int64, req *domain.MFACodeRequest) (*domain.RecoveryCodesResponse, error)
+	JWKS() *jwttoken.JWKS
 }
 
 type WalletController struct {
@@ -37,17 +79,37 @@ func NewWalletController(service WalletExchangeService) *WalletController {
 // @Produce  json
 // @Param request body domain.RegisterRequest true "User registration data"
 // @Success 201 {object} map[string]string "user registered successfully"
-// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 400 {object} domain.ValidationErrorResponse "invalid request"
+// @Failure 409 {object} domain.ValidationErrorResponse "username or email is taken"
 // @Router /register [post]
 func (wc *WalletController) Register(c *gin.Context) {
 	var req domain.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		var missing validator.ValidationErrors
+		if errors.As(err, &missing) {
+			c.JSON(http.StatusBadRequest, domain.ValidationErrorResponse{Error: "invalid request", Fields: requiredFields(missing)})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
 
 	err := wc.service.RegisterUser(c.Request.Context(), &req)
-	if err != nil {
+	var fields domain.FieldErrors
+	switch {
+	case errors.As(err, &fields):
+		c.JSON(http.StatusBadRequest, domain.ValidationErrorResponse{Error: "invalid request", Fields: fields})
+		return
+	case errors.Is(err, store.ErrUsernameTaken):
+		c.JSON(http.StatusConflict, domain.ValidationErrorResponse{Error: err.Error(), Fields: domain.FieldErrors{"username": "is already taken"}})
+		return
+	case errors.Is(err, store.ErrEmailTaken):
+		c.JSON(http.StatusConflict, domain.ValidationErrorResponse{Error: err.Error(), Fields: domain.FieldErrors{"email": "is already registered"}})
+		return
+	case errors.Is(err, domain.ErrVerificationNotSent):
+		c.JSON(http.StatusCreated, gin.H{"message": domain.ErrVerificationNotSent.Error() + ", request a new one at /verify-email/resend"})
+		return
+	case err != nil:
 		c.JSON(http.StatusBadRequest, gin.H{"error": errors.Wrap(err, "failed to register user").Error()})
 		return
 	}
@@ -56,13 +118,16 @@ func (wc *WalletController) Register(c *gin.Context) {
 }
 
 // @Summary User login
-// @Description Authenticates a user and returns JWT tokens
+// @Description Authenticates a user and returns JWT tokens. With two-factor authentication enabled only an MFA token is returned and the login is finished at /login/mfa
 // @Tags auth
 // @Accept  json
 // @Produce  json
 // @Param request body domain.AuthorizationRequest true "User credentials"
-// @Success 200 {object} map[string]interface{}
+// @Success 200 {object} domain.LoginResponse
 // @Failure 401 {object} map[string]string "invalid credentials"
+// @Failure 403 {object} map[string]string "account is frozen"
+// @Failure 429 {object} map[string]string "too many login attempts"
+// @Header 429 {integer} Retry-After "seconds before the next attempt"
 // @Router /login [post]
 func (wc *WalletController) Login(c *gin.Context) {
 	var req domain.AuthorizationRequest
@@ -71,8 +136,16 @@ func (wc *WalletController) Login(c *gin.Context) {
 		return
 	}
 
-	tokens, err := wc.service.LoginUser(c.Request.Context(), &req)
-	if err != nil {
+	tokens, err := wc.service.LoginUser(c.Request.Context(), &req, clientOf(c))
+	var locked *loginguard.LockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(locked.RetryAfterSeconds()))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": locked.Error()})
+		return
+	} else if errors.Is(err, store.ErrAccountFrozen) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
@@ -80,14 +153,60 @@ func (wc *WalletController) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, tokens)
 }
 
+// @Summary Finish login with a two-factor code
+// @Description Exchanges the MFA token from /login and a TOTP or recovery code for JWT tokens
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param request body domain.MFALoginRequest true "MFA token and code"
+// @Success 200 {object} domain.TokenResponse
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "invalid MFA token or code"
+// @Failure 403 {object} map[string]string "account is frozen"
+// @Failure 429 {object} map[string]string "too many login attempts"
+// @Header 429 {integer} Retry-After "seconds before the next attempt"
+// @Router /login/mfa [post]
+func (wc *WalletController) LoginMFA(c *gin.Context) {
+	var req domain.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	tokens, err := wc.service.LoginMFA(c.Request.Context(), &req, clientOf(c))
+	var locked *loginguard.LockedError
+	switch {
+	case errors.As(err, &locked):
+		c.Header("Retry-After", strconv.Itoa(locked.RetryAfterSeconds()))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": locked.Error()})
+		return
+	case errors.Is(err, domain.ErrInvalidMFAToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": domain.ErrInvalidMFAToken.Error()})
+		return
+	case errors.Is(err, store.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, store.ErrAccountFrozen):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
 // @Summary Get user balance
-// @Description Returns the balance of an authenticated user
+// @Description Returns the balance of one of the user's wallets, the primary one unless wallet_id is given
 // @Tags wallet
 // @Produce  json
 // @Security BearerAuth
-// @Success 200 {object} map[string]interface{}
+// @Param wallet_id query int false "Wallet id"
+// @Success 200 {array} domain.BalanceResponse
+// @Failure 400 {object} map[string]string "invalid request"
 // @Failure 401 {object} map[string]string "unauthorized"
-// @Failure 500 {object} map[string]string "failed to get balance"
+// @Failure 404 {object} map[string]string "wallet not found"
 // @Router /wallet/balance [get]
 func (wc *WalletController) GetBalance(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -96,8 +215,17 @@ func (wc *WalletController) GetBalance(c *gin.Context) {
 		return
 	}
 
-	balance, err := wc.service.GetBalance(c.Request.Context(), userID.(int64))
-	if err != nil {
+	var req domain.BalanceRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	balance, err := wc.service.GetBalance(c.Request.Context(), userID.(int64), req.WalletID)
+	if errors.Is(err, store.ErrWalletNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -112,10 +240,15 @@ func (wc *WalletController) GetBalance(c *gin.Context) {
 // @Produce  json
 // @Security BearerAuth
 // @Param request body domain.DepositRequest true "Deposit data"
+// @Param Idempotency-Key header string false "Key that makes retries of the request safe"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string "invalid request"
 // @Failure 401 {object} map[string]string "unauthorized"
 // @Failure 500 {object} map[string]string "failed to deposit"
+// @Failure 409 {object} map[string]string "request with this key is being processed"
+// @Failure 422 {object} map[string]string "key was used with a different request"
+// @Failure 403 {object} map[string]string "account is frozen or wallet is closed"
+// @Failure 404 {object} map[string]string "wallet not found"
 // @Router /wallet/deposit [post]
 func (wc *WalletController) Deposit(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -131,7 +264,13 @@ func (wc *WalletController) Deposit(c *gin.Context) {
 	}
 
 	newBalance, err := wc.service.Deposit(c.Request.Context(), userID.(int64), &req)
-	if err != nil {
+	if operationBlocked(err) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, store.ErrWalletNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -146,10 +285,15 @@ func (wc *WalletController) Deposit(c *gin.Context) {
 // @Produce  json
 // @Security BearerAuth
 // @Param request body domain.WithdrawRequest true "Withdraw data"
+// @Param Idempotency-Key header string false "Key that makes retries of the request safe"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string "invalid request"
 // @Failure 401 {object} map[string]string "unauthorized"
 // @Failure 500 {object} map[string]string "failed to withdraw"
+// @Failure 409 {object} map[string]string "request with this key is being processed"
+// @Failure 422 {object} map[string]string "key was used with a different request"
+// @Failure 403 {object} map[string]string "email is not verified, account or wallet is frozen, wallet is closed, limit is exceeded or two-factor code is missing or invalid"
+// @Failure 404 {object} map[string]string "wallet not found"
 // @Router /wallet/withdraw [post]
 func (wc *WalletController) Withdraw(c *gin.Context) {
 	userID, exists := c.Get("user_id")
@@ -165,7 +309,14 @@ func (wc *WalletController) Withdraw(c *gin.Context) {
 	}
 
 	newBalance, err := wc.service.Withdraw(c.Request.Context(), userID.(int64), &req)
-	if err != nil {
+	if errors.Is(err, store.ErrEmailNotVerified) || operationBlocked(err) || errors.Is(err, store.ErrLimitExceeded) ||
+		errors.Is(err, domain.ErrMFACodeRequired) || errors.Is(err, store.ErrInvalidMFACode) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, store.ErrWalletNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -173,6 +324,228 @@ func (wc *WalletController) Withdraw(c *gin.Context) {
 	c.JSON(http.StatusOK, newBalance)
 }
 
+// @Summary Transfer funds
+// @Description Sends funds from one of the user's wallets to the primary wallet of another user identified by username or email, converting them with the exchange spread and fee when target_currency differs
+// @Tags wallet
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body domain.TransferRequest true "Transfer data"
+// @Param Idempotency-Key header string false "Key that makes retries of the request safe"
+// @Success 200 {object} domain.TransferResponse
+// @Failure 400 {object} map[string]string "transfer failed"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 409 {object} map[string]string "request with this key is being processed"
+// @Failure 422 {object} map[string]string "key was used with a different request"
+// @Failure 403 {object} map[string]string "email is not verified, account or wallet is frozen, wallet is closed, withdrawal limit is exceeded or two-factor code is missing or invalid"
+// @Failure 404 {object} map[string]string "wallet not found"
+// @Router /wallet/transfer [post]
+func (wc *WalletController) Transfer(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	transferResponse, err := wc.service.Transfer(c.Request.Context(), userID.(int64), &req)
+	if errors.Is(err, store.ErrEmailNotVerified) || operationBlocked(err) || errors.Is(err, store.ErrLimitExceeded) ||
+		errors.Is(err, domain.ErrMFACodeRequired) || errors.Is(err, store.ErrInvalidMFACode) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, store.ErrWalletNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.Wrap(err, "transfer failed").Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, transferResponse)
+}
+
+// @Summary List wallets
+// @Description Returns the user's wallets with their balances, the primary wallet first
+// @Tags wallet
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {array} domain.WalletResponse
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 500 {object} map[string]string "failed to get wallets"
+// @Router /wallets [get]
+func (wc *WalletController) GetWallets(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	wallets, err := wc.service.Wallets(c.Request.Context(), userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get wallets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, wallets)
+}
+
+// @Summary Create a wallet
+// @Description Opens another named wallet with a zero balance in every enabled currency
+// @Tags wallet
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body domain.CreateWalletRequest true "Wallet name"
+// @Success 201 {object} domain.WalletResponse
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "account is frozen"
+// @Failure 409 {object} map[string]string "name is taken or the maximum number of wallets is reached"
+// @Router /wallets [post]
+func (wc *WalletController) CreateWallet(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.CreateWalletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	wallet, err := wc.service.CreateWallet(c.Request.Context(), userID.(int64), &req)
+	if operationBlocked(err) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, store.ErrWalletNameTaken) || errors.Is(err, store.ErrTooManyWallets) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, wallet)
+}
+
+// @Summary Move funds between wallets
+// @Description Moves funds between two of the user's wallets in the same currency; a missing wallet id means the primary wallet
+// @Tags wallet
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body domain.MoveRequest true "Move data"
+// @Param Idempotency-Key header string false "Key that makes retries of the request safe"
+// @Success 200 {array} domain.WalletResponse
+// @Failure 400 {object} map[string]string "invalid request, insufficient funds or the same wallet on both sides"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "account or wallet is frozen or wallet is closed"
+// @Failure 404 {object} map[string]string "wallet not found"
+// @Failure 409 {object} map[string]string "request with this key is being processed"
+// @Failure 422 {object} map[string]string "key was used with a different request"
+// @Router /wallets/move [post]
+func (wc *WalletController) MoveFunds(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.MoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	wallets, err := wc.service.MoveFunds(c.Request.Context(), userID.(int64), &req)
+	if operationBlocked(err) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, store.ErrWalletNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, wallets)
+}
+
+// @Summary Get limits
+// @Description Returns the withdrawal and exchange limits of the user with the amount used (transfers to other users count as withdrawals) and left over the last day and the last 30 days
+// @Tags wallet
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {array} domain.LimitResponse
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 500 {object} map[string]string "failed to get limits"
+// @Router /wallet/limits [get]
+func (wc *WalletController) GetLimits(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	limits, err := wc.service.Limits(c.Request.Context(), userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get limits"})
+		return
+	}
+
+	c.JSON(http.StatusOK, limits)
+}
+
+// @Summary Get transaction history
+// @Description Returns the user's deposits, withdrawals, exchanges and transfers, newest first
+// @Tags wallet
+// @Produce  json
+// @Security BearerAuth
+// @Param type query string false "Operation type" Enums(deposit, withdraw, exchange, transfer, move)
+// @Param wallet_id query int false "Only operations touching this wallet"
+// @Param currency query string false "Currency code"
+// @Param from query string false "Start of the period (RFC3339)"
+// @Param to query string false "End of the period (RFC3339)"
+// @Param cursor query string false "Cursor returned by the previous page"
+// @Param limit query int false "Page size (1-100)"
+// @Success 200 {object} domain.TransactionsResponse
+// @Failure 400 {object} map[string]string "invalid request or from is after to"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Router /wallet/transactions [get]
+func (wc *WalletController) GetTransactions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.TransactionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if invalidPeriod(&req) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": domain.ErrInvalidPeriod.Error()})
+		return
+	}
+
+	transactions, err := wc.service.Transactions(c.Request.Context(), userID.(int64), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, transactions)
+}
+
 // @Summary Refresh access token
 // @Description Refreshes the user's access token using a refresh token
 // @Tags auth
@@ -182,6 +555,7 @@ func (wc *WalletController) Withdraw(c *gin.Context) {
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string "invalid request"
 // @Failure 401 {object} map[string]string "invalid refresh token"
+// @Failure 403 {object} map[string]string "account is frozen"
 // @Router /refresh [post]
 func (wc *WalletController) Refresh(c *gin.Context) {
 	var req domain.RefreshRequest
@@ -190,8 +564,11 @@ func (wc *WalletController) Refresh(c *gin.Context) {
 		return
 	}
 
-	newTokens, err := wc.service.Refresh(c.Request.Context(), &req)
-	if err != nil {
+	newTokens, err := wc.service.Refresh(c.Request.Context(), &req, clientOf(c))
+	if errors.Is(err, store.ErrAccountFrozen) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
 		return
 	}
@@ -199,6 +576,465 @@ func (wc *WalletController) Refresh(c *gin.Context) {
 	c.JSON(http.StatusOK, newTokens)
 }
 
+// @Summary Log out
+// @Description Revokes the presented refresh token. The access token of the session, if sent in the Authorization header, is denylisted as well
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param request body domain.RefreshRequest true "Refresh token data"
+// @Param Authorization header string false "Bearer access token of the session"
+// @Success 200 {object} map[string]string "logged out"
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "invalid refresh token"
+// @Router /logout [post]
+func (wc *WalletController) Logout(c *gin.Context) {
+	var req domain.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	accessToken, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	err := wc.service.Logout(c.Request.Context(), &req, accessToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// @Summary Log out everywhere
+// @Description Revokes every refresh token of the authenticated user
+// @Tags auth
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "logged out"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 500 {object} map[string]string "failed to log out"
+// @Router /logout-all [post]
+func (wc *WalletController) LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	err := wc.service.LogoutAll(c.Request.Context(), userID.(int64), accessTokenOf(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// @Summary List active sessions
+// @Description Returns the user's sessions that can still be refreshed, most recently used first
+// @Tags auth
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {array} domain.SessionResponse
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 500 {object} map[string]string "failed to get sessions"
+// @Router /sessions [get]
+func (wc *WalletController) GetSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessions, err := wc.service.Sessions(c.Request.Context(), userID.(int64))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// @Summary End a session
+// @Description Revokes the session's refresh tokens, so it cannot be refreshed anymore
+// @Tags auth
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Success 200 {object} map[string]string "session revoked"
+// @Failure 400 {object} map[string]string "invalid session id"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 404 {object} map[string]string "session not found"
+// @Router /sessions/{id} [delete]
+func (wc *WalletController) DeleteSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+
+	err = wc.service.RevokeSession(c.Request.Context(), userID.(int64), sessionID)
+	if errors.Is(err, store.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
+
+// @Summary Verify email
+// @Description Confirms the user's email with the token from the verification email
+// @Tags auth
+// @Produce  json
+// @Param token query string true "Verification token"
+// @Success 200 {object} map[string]string "email verified"
+// @Failure 400 {object} map[string]string "verification token is invalid or expired"
+// @Failure 500 {object} map[string]string "failed to verify email"
+// @Router /verify-email [get]
+func (wc *WalletController) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.VerifyEmail(c.Request.Context(), token)
+	if errors.Is(err, store.ErrVerificationFailed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "email verified"})
+}
+
+// @Summary Resend verification email
+// @Description Sends a new email verification link to the user's email
+// @Tags auth
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "verification email sent"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 409 {object} map[string]string "email is already verified"
+// @Failure 500 {object} map[string]string "failed to send verification email"
+// @Router /verify-email/resend [post]
+func (wc *WalletController) ResendVerification(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	err := wc.service.ResendVerification(c.Request.Context(), userID.(int64))
+	if errors.Is(err, domain.ErrEmailAlreadyVerified) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "verification email sent"})
+}
+
+// @Summary Forgot password
+// @Description Sends a password reset link to the email if it is registered; the response is the same either way
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param request body domain.ForgotPasswordRequest true "Email of the account"
+// @Success 202 {object} map[string]string "password reset email sent if the email is registered"
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 500 {object} map[string]string "failed to request password reset"
+// @Router /password/forgot [post]
+func (wc *WalletController) ForgotPassword(c *gin.Context) {
+	var req domain.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.ForgotPassword(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to request password reset"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the email is registered, a password reset link has been sent to it"})
+}
+
+// @Summary Reset password
+// @Description Sets a new password with the token from the password reset email and ends all sessions
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param request body domain.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string "password reset"
+// @Failure 400 {object} domain.ValidationErrorResponse "invalid request or password reset token"
+// @Failure 500 {object} map[string]string "failed to reset password"
+// @Router /password/reset [post]
+func (wc *WalletController) ResetPassword(c *gin.Context) {
+	var req domain.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.ResetPassword(c.Request.Context(), &req)
+	var fields domain.FieldErrors
+	switch {
+	case errors.As(err, &fields):
+		c.JSON(http.StatusBadRequest, domain.ValidationErrorResponse{Error: "invalid request", Fields: fields})
+		return
+	case errors.Is(err, store.ErrResetFailed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password reset"})
+}
+
+// @Summary Change password
+// @Description Replaces the password of the user and ends all sessions; requires the current password
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body domain.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} map[string]string "password changed"
+// @Failure 400 {object} domain.ValidationErrorResponse "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "current password is incorrect"
+// @Failure 500 {object} map[string]string "failed to change password"
+// @Router /password/change [post]
+func (wc *WalletController) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.ChangePassword(c.Request.Context(), userID.(int64), &req)
+	var fields domain.FieldErrors
+	switch {
+	case errors.As(err, &fields):
+		c.JSON(http.StatusBadRequest, domain.ValidationErrorResponse{Error: "invalid request", Fields: fields})
+		return
+	case errors.Is(err, store.ErrWrongPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "password changed"})
+}
+
+// @Summary Enroll in two-factor authentication
+// @Description Generates a TOTP secret for an authenticator app; two-factor authentication is enabled once it is confirmed with a code
+// @Tags mfa
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} domain.MFAEnrollResponse
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 409 {object} map[string]string "two-factor authentication is already enabled"
+// @Failure 500 {object} map[string]string "failed to enroll"
+// @Router /mfa/enroll [post]
+func (wc *WalletController) EnrollMFA(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	enrollment, err := wc.service.EnrollMFA(c.Request.Context(), userID.(int64))
+	if errors.Is(err, store.ErrMFAAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enroll"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// @Summary Confirm two-factor authentication
+// @Description Enables two-factor authentication with the first code from the authenticator app and returns the recovery codes
+// @Tags mfa
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body domain.MFACodeRequest true "TOTP code"
+// @Success 200 {object} domain.RecoveryCodesResponse
+// @Failure 400 {object} map[string]string "invalid request or not enrolled"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "invalid two-factor authentication code"
+// @Failure 409 {object} map[string]string "two-factor authentication is already enabled"
+// @Failure 500 {object} map[string]string "failed to enable two-factor authentication"
+// @Router /mfa/confirm [post]
+func (wc *WalletController) ConfirmMFA(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	codes, err := wc.service.ConfirmMFA(c.Request.Context(), userID.(int64), &req)
+	switch {
+	case errors.Is(err, store.ErrMFANotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "enroll in two-factor authentication first"})
+		return
+	case errors.Is(err, store.ErrInvalidMFACode):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, store.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// @Summary Disable two-factor authentication
+// @Description Turns two-factor authentication off with a TOTP code or a recovery code
+// @Tags mfa
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body domain.MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {object} map[string]string "two-factor authentication disabled"
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "invalid two-factor authentication code"
+// @Failure 409 {object} map[string]string "two-factor authentication is not enabled"
+// @Failure 500 {object} map[string]string "failed to disable two-factor authentication"
+// @Router /mfa/disable [post]
+func (wc *WalletController) DisableMFA(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	err := wc.service.DisableMFA(c.Request.Context(), userID.(int64), &req)
+	switch {
+	case errors.Is(err, store.ErrInvalidMFACode):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, store.ErrMFANotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replaces all recovery codes with new ones; requires a TOTP code
+// @Tags mfa
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body domain.MFACodeRequest true "TOTP code"
+// @Success 200 {object} domain.RecoveryCodesResponse
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Failure 403 {object} map[string]string "invalid two-factor authentication code"
+// @Failure 409 {object} map[string]string "two-factor authentication is not enabled"
+// @Failure 500 {object} map[string]string "failed to regenerate recovery codes"
+// @Router /mfa/recovery-codes [post]
+func (wc *WalletController) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	codes, err := wc.service.RegenerateRecoveryCodes(c.Request.Context(), userID.(int64), &req)
+	switch {
+	case errors.Is(err, store.ErrInvalidMFACode):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, store.ErrMFANotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to regenerate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// JWKS publishes the public keys of access tokens so other services can
+// verify them without the signing key. It is served outside the API base
+// path, at /.well-known/jwks.json.
+func (wc *WalletController) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, wc.service.JWKS())
+}
+
+// @Summary List currencies
+// @Description Returns the enabled currencies with the number of decimal places their amounts may have
+// @Tags wallet
+// @Produce  json
+// @Success 200 {array} domain.CurrencyResponse
+// @Failure 500 {object} map[string]string "failed to get currencies"
+// @Router /currencies [get]
+func (wc *WalletController) GetCurrencies(c *gin.Context) {
+	currencies, err := wc.service.Currencies(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get currencies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, currencies)
+}
+
 // @Summary Get exchange rates
 // @Description Fetches the latest exchange rates
 // @Tags exchange
@@ -217,17 +1053,56 @@ func (wc *WalletController) ExchangeRatesHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, rates)
 }
 
+// @Summary Quote currency exchange
+// @Description Locks the current rate for an exchange and returns a quote that can be executed once before it expires
+// @Tags exchange
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body domain.ExchangeQuoteRequest true "Exchange data"
+// @Success 200 {object} domain.ExchangeQuoteResponse
+// @Failure 400 {object} map[string]string "invalid request"
+// @Failure 401 {object} map[string]string "unauthorized"
+// @Router /exchange/quote [post]
+func (wc *WalletController) ExchangeQuoteHandler(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req domain.ExchangeQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	quote, err := wc.service.ExchangeQuote(c.Request.Context(), userID.(int64), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.Wrap(err, "quote failed").Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
+
 // @Summary Exchange currency
-// @Description Exchanges one currency for another
+// @Description Exchanges one currency for another. With quote_id the quoted amounts and rate are used and the other fields are ignored
 // @Tags exchange
 // @Accept  json
 // @Produce  json
 // @Security BearerAuth
 // @Param request body domain.ExchangeRequest true "Exchange data"
+// @Param Idempotency-Key header string false "Key that makes retries of the request safe"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string "invalid request"
 // @Failure 401 {object} map[string]string "unauthorized"
 // @Failure 400 {object} map[string]string "exchange failed"
+// @Failure 409 {object} map[string]string "request with this key is being processed"
+// @Failure 422 {object} map[string]string "key was used with a different request"
+// @Failure 403 {object} map[string]string "email is not verified, account or wallet is frozen, wallet is closed or limit is exceeded"
+// @Failure 404 {object} map[string]string "wallet not found"
+// @Failure 500 {object} map[string]string "exchange failed"
 // @Router /exchange [post]
 func (wc *WalletController) ExchangeHandler(c *gin.Context) {
 	var req domain.ExchangeRequest
@@ -243,10 +1118,54 @@ func (wc *WalletController) ExchangeHandler(c *gin.Context) {
 	}
 
 	exchangeResponse, err := wc.service.Exchange(c.Request.Context(), userID.(int64), &req)
-	if err != nil {
+	if errors.Is(err, store.ErrEmailNotVerified) || operationBlocked(err) || errors.Is(err, store.ErrLimitExceeded) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, store.ErrWalletNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if errors.Is(err, quotes.ErrUnavailable) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "exchange failed"})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": errors.Wrap(err, "exchange failed").Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, exchangeResponse)
 }
+
+// requiredFields reports the fields the binding found missing the same way
+// the registration policy reports invalid ones.
+func requiredFields(missing validator.ValidationErrors) domain.FieldErrors {
+	fields := domain.FieldErrors{}
+	for _, field := range missing {
+		fields[strings.ToLower(field.Field())] = "is required"
+	}
+	return fields
+}
+
+// invalidPeriod reports a history period that ends before it starts.
+func invalidPeriod(req *domain.TransactionsRequest) bool {
+	return !req.From.IsZero() && !req.To.IsZero() && req.From.After(req.To)
+}
+
+// operationBlocked reports whether the account or the wallet status forbids
+// the operation.
+func operationBlocked(err error) bool {
+	return errors.Is(err, store.ErrAccountFrozen) || errors.Is(err, store.ErrWalletFrozen) || errors.Is(err, store.ErrWalletClosed)
+}
+
+func accessTokenOf(c *gin.Context) *domain.AccessToken {
+	return &domain.AccessToken{
+		ID:        c.GetString("token_id"),
+		ExpiresAt: c.GetTime("token_expires_at"),
+	}
+}
+
+func clientOf(c *gin.Context) *domain.Client {
+	return &domain.Client{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+}
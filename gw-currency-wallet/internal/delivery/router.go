@@ -2,6 +2,7 @@ package delivery
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -12,33 +13,114 @@ type Controller interface {
 	GetBalance(c *gin.Context)
 	Deposit(c *gin.Context)
 	Withdraw(c *gin.Context)
+	Transfer(c *gin.Context)
+	GetWallets(c *gin.Context)
+	CreateWallet(c *gin.Context)
+	MoveFunds(c *gin.Context)
+	GetTransactions(c *gin.Context)
 	Refresh(c *gin.Context)
+	Logout(c *gin.Context)
+	LogoutAll(c *gin.Context)
+	GetSessions(c *gin.Context)
+	DeleteSession(c *gin.Context)
+	UnlockUser(c *gin.Context)
+	AdminFindUsers(c *gin.Context)
+	AdminGetUser(c *gin.Context)
+	AdminGetBalance(c *gin.Context)
+	AdminGetTransactions(c *gin.Context)
+	FreezeUser(c *gin.Context)
+	UnfreezeUser(c *gin.Context)
+	SetUserRole(c *gin.Context)
+	SetWalletStatus(c *gin.Context)
+	SetUserLimit(c *gin.Context)
+	GetLimits(c *gin.Context)
+	GetAuditLog(c *gin.Context)
+	SetCurrency(c *gin.Context)
+	GetCurrencies(c *gin.Context)
+	VerifyEmail(c *gin.Context)
+	ResendVerification(c *gin.Context)
+	ForgotPassword(c *gin.Context)
+	ResetPassword(c *gin.Context)
+	ChangePassword(c *gin.Context)
+	LoginMFA(c *gin.Context)
+	EnrollMFA(c *gin.Context)
+	ConfirmMFA(c *gin.Context)
+	DisableMFA(c *gin.Context)
+	RegenerateRecoveryCodes(c *gin.Context)
+	JWKS(c *gin.Context)
 	ExchangeRatesHandler(c *gin.Context)
+	ExchangeQuoteHandler(c *gin.Context)
 	ExchangeHandler(c *gin.Context)
 }
 
-func NewRouter(router *gin.Engine, authMiddleware gin.HandlerFunc, c Controller) {
+func NewRouter(router *gin.Engine, authMiddleware, idempotencyMiddleware gin.HandlerFunc, requireRole func(roles ...string) gin.HandlerFunc, rateLimit func(route string) gin.HandlerFunc, c Controller) {
 	router.Use(gin.Recovery())
 	router.Use(gin.Logger())
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	router.GET("/.well-known/jwks.json", c.JWKS)
 
 	publicRoutes := router.Group("/api/v1")
+	publicRoutes.Use(rateLimit("public"))
 	{
-		publicRoutes.POST("/register", c.Register)
-		publicRoutes.POST("/login", c.Login)
+		publicRoutes.POST("/register", rateLimit("register"), c.Register)
+		publicRoutes.POST("/login", rateLimit("login"), c.Login)
+		publicRoutes.POST("/login/mfa", rateLimit("login"), c.LoginMFA)
 		publicRoutes.POST("/refresh", c.Refresh)
+		publicRoutes.POST("/logout", c.Logout)
+		publicRoutes.GET("/verify-email", c.VerifyEmail)
+		publicRoutes.POST("/password/forgot", rateLimit("password"), c.ForgotPassword)
+		publicRoutes.POST("/password/reset", rateLimit("password"), c.ResetPassword)
+		publicRoutes.GET("/currencies", c.GetCurrencies)
+	}
+
+	adminRoutes := router.Group("/api/v1/admin")
+	adminRoutes.Use(authMiddleware, rateLimit("api"), requireRole(store.RoleSupport, store.RoleAdmin))
+	{
+		adminOnly := requireRole(store.RoleAdmin)
+
+		adminRoutes.GET("/users", c.AdminFindUsers)
+		adminRoutes.GET("/users/:id", c.AdminGetUser)
+		adminRoutes.GET("/users/:id/balance", c.AdminGetBalance)
+		adminRoutes.GET("/users/:id/transactions", c.AdminGetTransactions)
+		adminRoutes.POST("/users/:id/unlock", c.UnlockUser)
+		adminRoutes.POST("/users/:id/freeze", adminOnly, c.FreezeUser)
+		adminRoutes.POST("/users/:id/unfreeze", adminOnly, c.UnfreezeUser)
+		adminRoutes.PUT("/users/:id/role", adminOnly, c.SetUserRole)
+		adminRoutes.PUT("/users/:id/wallet/status", adminOnly, c.SetWalletStatus)
+		adminRoutes.PUT("/users/:id/limits", adminOnly, c.SetUserLimit)
+		adminRoutes.PUT("/currencies/:code", adminOnly, c.SetCurrency)
+		adminRoutes.GET("/audit", adminOnly, c.GetAuditLog)
 	}
 
 	protectedRoutes := router.Group("/api/v1")
-	protectedRoutes.Use(authMiddleware)
+	protectedRoutes.Use(authMiddleware, rateLimit("api"))
+	protectedRoutes.POST("/logout-all", c.LogoutAll)
+	protectedRoutes.POST("/verify-email/resend", c.ResendVerification)
+	protectedRoutes.POST("/password/change", c.ChangePassword)
+	protectedRoutes.POST("/mfa/enroll", c.EnrollMFA)
+	protectedRoutes.POST("/mfa/confirm", c.ConfirmMFA)
+	protectedRoutes.POST("/mfa/disable", c.DisableMFA)
+	protectedRoutes.POST("/mfa/recovery-codes", c.RegenerateRecoveryCodes)
+	protectedRoutes.GET("/sessions", c.GetSessions)
+	protectedRoutes.DELETE("/sessions/:id", c.DeleteSession)
 	walletRoutes := protectedRoutes.Group("/wallet")
 	{
 
 		walletRoutes.GET("/balance", c.GetBalance)
-		walletRoutes.POST("/deposit", c.Deposit)
-		walletRoutes.POST("/withdraw", c.Withdraw)
+		walletRoutes.POST("/deposit", idempotencyMiddleware, c.Deposit)
+		walletRoutes.POST("/withdraw", idempotencyMiddleware, c.Withdraw)
+		walletRoutes.POST("/transfer", idempotencyMiddleware, c.Transfer)
+		walletRoutes.GET("/transactions", c.GetTransactions)
+		walletRoutes.GET("/limits", c.GetLimits)
+	}
+	walletsRoutes := protectedRoutes.Group("/wallets")
+	{
+		walletsRoutes.GET("", c.GetWallets)
+		walletsRoutes.POST("", c.CreateWallet)
+		walletsRoutes.POST("/move", idempotencyMiddleware, c.MoveFunds)
 	}
 	protectedRoutes.GET("/exchange/rates", c.ExchangeRatesHandler)
-	protectedRoutes.POST("/exchange", c.ExchangeHandler)
+	protectedRoutes.POST("/exchange/quote", rateLimit("exchange"), c.ExchangeQuoteHandler)
+	protectedRoutes.POST("/exchange", rateLimit("exchange"), idempotencyMiddleware, c.ExchangeHandler)
 }
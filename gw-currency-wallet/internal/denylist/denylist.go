@@ -0,0 +1,50 @@
+package denylist
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Storage interface {
+	SetBytes(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// Store keeps the ids (jti) of access tokens that must be rejected before
+// they expire. An entry lives only as long as its token would.
+type Store struct {
+	storage Storage
+}
+
+func New(storage Storage) *Store {
+	return &Store{
+		storage: storage,
+	}
+}
+
+func (s *Store) Add(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	err := s.storage.SetBytes(ctx, key(tokenID), []byte{1}, ttl)
+	if err != nil {
+		return errors.Wrap(err, "failed to denylist token")
+	}
+	return nil
+}
+
+func (s *Store) Contains(ctx context.Context, tokenID string) (bool, error) {
+	found, err := s.storage.Exists(ctx, key(tokenID))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check token denylist")
+	}
+	return found, nil
+}
+
+func key(tokenID string) string {
+	return "denylist:jti:" + tokenID
+}
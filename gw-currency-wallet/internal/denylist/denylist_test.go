@@ -0,0 +1,55 @@
+package denylist
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryStorage struct {
+	mu   sync.Mutex
+	data map[string]time.Duration
+}
+
+func (m *memoryStorage) SetBytes(_ context.Context, key string, _ []byte, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = expiration
+	return nil
+}
+
+func (m *memoryStorage) Exists(_ context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.data[key]
+	return ok, nil
+}
+
+func TestDenylist(t *testing.T) {
+	ctx := context.Background()
+	storage := &memoryStorage{data: map[string]time.Duration{}}
+	store := New(storage)
+
+	err := store.Add(ctx, "live", time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	found, err := store.Contains(ctx, "live")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	// запись живёт не дольше самого токена
+	ttl := storage.data[key("live")]
+	assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour)
+
+	found, err = store.Contains(ctx, "other")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	// истёкший токен и так не пройдёт проверку, хранить его незачем
+	err = store.Add(ctx, "expired", time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.NotContains(t, storage.data, key("expired"))
+}
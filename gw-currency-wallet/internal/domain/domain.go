@@ -1,53 +1,348 @@
 package domain
 
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// RegisterRequest is checked against the registration policy by the
+// service, which reports every invalid field at once.
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+// FieldErrors maps a request field to what is wrong with it.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field, problem := range e {
+		fields = append(fields, field+" "+problem)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, "; ")
+}
+
+type ValidationErrorResponse struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
 type AuthorizationRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
 type BalanceResponse struct {
-	Currency string  `json:"currency" `
-	Value    float64 `json:"value" `
+	WalletID     int64           `json:"wallet_id"`
+	Currency     string          `json:"currency" `
+	Value        decimal.Decimal `json:"value" swaggertype:"string"`
+	WalletStatus string          `json:"wallet_status" enums:"active,frozen,closed"`
+}
+
+// BalanceRequest selects one of the user's wallets. In this and the other
+// requests a missing or zero wallet id means the primary wallet.
+type BalanceRequest struct {
+	WalletID int64 `form:"wallet_id" binding:"omitempty,min=1"`
 }
 
 type DepositRequest struct {
-	Currency string  `json:"currency" binding:"required"`
-	Amount   float64 `json:"amount" binding:"required"`
+	money.Money
+	WalletID int64 `json:"wallet_id,omitempty" binding:"omitempty,min=1"`
 }
 
+// WithdrawRequest carries a TOTP code when the amount is above the two-factor
+// threshold of its currency.
 type WithdrawRequest struct {
-	Currency string  `json:"currency" binding:"required"`
-	Amount   float64 `json:"amount" binding:"required"`
+	money.Money
+	WalletID int64  `json:"wallet_id,omitempty" binding:"omitempty,min=1"`
+	MFACode  string `json:"mfa_code,omitempty"`
+}
+
+type WalletResponse struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name" example:"Savings"`
+	Primary   bool               `json:"primary"`
+	Status    string             `json:"status" enums:"active,frozen,closed"`
+	Balances  []*BalanceResponse `json:"balances"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type CreateWalletRequest struct {
+	Name string `json:"name" binding:"required,max=64" example:"Savings"`
+}
+
+// MoveRequest moves funds between two of the user's own wallets, in the same
+// currency.
+type MoveRequest struct {
+	FromWalletID int64 `json:"from_wallet_id,omitempty" binding:"omitempty,min=1"`
+	ToWalletID   int64 `json:"to_wallet_id,omitempty" binding:"omitempty,min=1"`
+	money.Money
 }
 
 type RateResponse struct {
-	CurrencyCode string  `json:"currency_code" binding:"required"`
-	Value        float64 `json:"value" binding:"required"`
+	CurrencyCode string          `json:"currency_code" binding:"required"`
+	Value        decimal.Decimal `json:"value" binding:"required" swaggertype:"string"`
 }
 
 type ExchangeRequest struct {
-	BaseCurrency   string  `json:"base_currency" binding:"required"`
-	TargetCurrency string  `json:"target_currency" binding:"required"`
-	Amount         float64 `json:"amount" binding:"required"`
+	QuoteID        string          `json:"quote_id"`
+	WalletID       int64           `json:"wallet_id,omitempty" binding:"omitempty,min=1"`
+	BaseCurrency   string          `json:"base_currency" binding:"required_without=QuoteID"`
+	TargetCurrency string          `json:"target_currency" binding:"required_without=QuoteID"`
+	Amount         decimal.Decimal `json:"amount" swaggertype:"string" example:"100.50"`
+}
+
+type ExchangeQuoteRequest struct {
+	BaseCurrency   string          `json:"base_currency" binding:"required"`
+	TargetCurrency string          `json:"target_currency" binding:"required"`
+	Amount         decimal.Decimal `json:"amount" binding:"required" swaggertype:"string" example:"100.50"`
+}
+
+type ExchangeQuoteResponse struct {
+	QuoteID        string          `json:"quote_id"`
+	BaseCurrency   string          `json:"base_currency"`
+	TargetCurrency string          `json:"target_currency"`
+	Amount         decimal.Decimal `json:"amount" swaggertype:"string"`
+	GrossAmount    decimal.Decimal `json:"gross_amount" swaggertype:"string"`
+	Fee            decimal.Decimal `json:"fee" swaggertype:"string"`
+	ExchangeAmount decimal.Decimal `json:"exchange_amount" swaggertype:"string"`
+	Rate           decimal.Decimal `json:"rate" swaggertype:"string"`
+	EffectiveRate  decimal.Decimal `json:"effective_rate" swaggertype:"string"`
+	ExpiresAt      time.Time       `json:"expires_at"`
 }
 
+// ExchangeResponse reports the amount bought at Rate as GrossAmount and what
+// was credited after the fee as ExchangeAmount.
 type ExchangeResponse struct {
-	ExchangeAmount float64            `json:"exchange_amount"`
+	GrossAmount    decimal.Decimal    `json:"gross_amount" swaggertype:"string"`
+	Fee            decimal.Decimal    `json:"fee" swaggertype:"string"`
+	ExchangeAmount decimal.Decimal    `json:"exchange_amount" swaggertype:"string"`
+	Rate           decimal.Decimal    `json:"rate" swaggertype:"string"`
+	EffectiveRate  decimal.Decimal    `json:"effective_rate" swaggertype:"string"`
 	Message        string             `json:"message"`
 	NewBalance     []*BalanceResponse `json:"new_balance"`
 }
 
+// TransferRequest is paid from the sender's wallet WalletID and arrives in
+// the recipient's primary wallet. Above the two-factor threshold it carries
+// a TOTP code, like WithdrawRequest.
+type TransferRequest struct {
+	Recipient string `json:"recipient" binding:"required" example:"alice"`
+	money.Money
+	TargetCurrency string `json:"target_currency"`
+	WalletID       int64  `json:"wallet_id,omitempty" binding:"omitempty,min=1"`
+	MFACode        string `json:"mfa_code,omitempty"`
+}
+
+type TransferResponse struct {
+	Message          string             `json:"message"`
+	Recipient        string             `json:"recipient"`
+	ReceivedAmount   decimal.Decimal    `json:"received_amount" swaggertype:"string"`
+	ReceivedCurrency string             `json:"received_currency"`
+	Rate             *decimal.Decimal   `json:"rate,omitempty" swaggertype:"string"`
+	Fee              *decimal.Decimal   `json:"fee,omitempty" swaggertype:"string"`
+	NewBalance       []*BalanceResponse `json:"new_balance"`
+}
+
 type TokenResponse struct {
 	Access  string `json:"access"`
 	Refresh string `json:"refresh"`
 }
 
+// LoginResponse carries the tokens, or only an MFA token if the user has
+// two-factor authentication enabled; the login is then finished at
+// /login/mfa.
+type LoginResponse struct {
+	Access      string `json:"access,omitempty"`
+	Refresh     string `json:"refresh,omitempty"`
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+// MFALoginRequest takes a TOTP code or a recovery code.
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFAEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type SessionResponse struct {
+	ID         int64     `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// Client describes where a request came from; it is attached to the
+// refresh token session.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+// AccessToken identifies the access token a request was authorized with.
+type AccessToken struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
 type RefreshRequest struct {
 	TokenHash string `json:"tokenhash" binding:"required"`
 }
+
+type TransactionsRequest struct {
+	Type     string    `form:"type" binding:"omitempty,oneof=deposit withdraw exchange transfer move"`
+	WalletID int64     `form:"wallet_id" binding:"omitempty,min=1"`
+	Currency string    `form:"currency"`
+	From     time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To       time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Cursor   string    `form:"cursor"`
+	Limit    int       `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type TransactionEntry struct {
+	WalletID int64           `json:"wallet_id"`
+	Currency string          `json:"currency"`
+	Amount   decimal.Decimal `json:"amount" swaggertype:"string"`
+	Balance  decimal.Decimal `json:"balance" swaggertype:"string"`
+}
+
+type TransactionResponse struct {
+	ID        int64               `json:"id"`
+	Type      string              `json:"type"`
+	Rate      *decimal.Decimal    `json:"rate,omitempty" swaggertype:"string"`
+	Fee       *decimal.Decimal    `json:"fee,omitempty" swaggertype:"string"`
+	Entries   []*TransactionEntry `json:"entries"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+type TransactionsResponse struct {
+	Transactions []*TransactionResponse `json:"transactions"`
+	NextCursor   string                 `json:"next_cursor,omitempty"`
+}
+
+type AdminUsersRequest struct {
+	Query string `form:"q" binding:"required"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type AdminUserResponse struct {
+	ID            int64      `json:"id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	EmailVerified bool       `json:"email_verified"`
+	FrozenAt      *time.Time `json:"frozen_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// AdminActionRequest carries the reason recorded in the audit log.
+type AdminActionRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type SetRoleRequest struct {
+	Role   string `json:"role" binding:"required,oneof=user support admin"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+// LimitResponse shows how much of a limit is left; a period without a limit
+// is omitted.
+type LimitResponse struct {
+	Operation string             `json:"operation" enums:"withdraw,exchange"`
+	Currency  string             `json:"currency"`
+	Daily     *AllowanceResponse `json:"daily,omitempty"`
+	Monthly   *AllowanceResponse `json:"monthly,omitempty"`
+}
+
+type AllowanceResponse struct {
+	Limit     decimal.Decimal `json:"limit" swaggertype:"string"`
+	Used      decimal.Decimal `json:"used" swaggertype:"string"`
+	Remaining decimal.Decimal `json:"remaining" swaggertype:"string"`
+}
+
+// SetLimitRequest gives a user limits of their own. A null or missing period
+// falls back to the configured limit; with both null the user's limit is
+// removed.
+type SetLimitRequest struct {
+	Operation string              `json:"operation" binding:"required,oneof=withdraw exchange"`
+	Currency  string              `json:"currency" binding:"required"`
+	Daily     decimal.NullDecimal `json:"daily" swaggertype:"string"`
+	Monthly   decimal.NullDecimal `json:"monthly" swaggertype:"string"`
+	Reason    string              `json:"reason" binding:"required"`
+}
+
+type WalletStatusRequest struct {
+	WalletID int64  `json:"wallet_id,omitempty" binding:"omitempty,min=1"`
+	Status   string `json:"status" binding:"required,oneof=active frozen closed"`
+	Reason   string `json:"reason" binding:"required"`
+}
+
+type CurrencyResponse struct {
+	Code       string `json:"code" example:"USD"`
+	Name       string `json:"name" example:"US dollar"`
+	MinorUnits int32  `json:"minor_units" example:"2"`
+}
+
+// SetCurrencyRequest adds a currency to the catalogue or changes an existing
+// one. The minor units of an existing currency have to stay the same.
+type SetCurrencyRequest struct {
+	Name       string `json:"name" binding:"required,max=64"`
+	MinorUnits *int32 `json:"minor_units" binding:"required,min=0,max=8"`
+	Enabled    *bool  `json:"enabled" binding:"required"`
+	Reason     string `json:"reason" binding:"required"`
+}
+
+type AuditLogRequest struct {
+	UserID int64  `form:"user_id"`
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type AuditEntryResponse struct {
+	ID           int64             `json:"id"`
+	ActorID      int64             `json:"actor_id"`
+	Action       string            `json:"action"`
+	TargetUserID *int64            `json:"target_user_id,omitempty"`
+	Details      map[string]string `json:"details"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+type AuditLogResponse struct {
+	Entries    []*AuditEntryResponse `json:"entries"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "errors"
+
+var (
+	ErrVerificationNotSent  = errors.New("user registered, but the verification email could not be sent")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	ErrMFACodeRequired      = errors.New("a two-factor authentication code is required for this amount")
+	ErrInvalidMFAToken      = errors.New("MFA token is invalid or expired")
+	ErrOwnAccount           = errors.New("admins cannot apply this action to their own account")
+	ErrInvalidLimit         = errors.New("limit must not be negative or have more decimal places than the currency")
+	ErrInvalidCurrencyCode  = errors.New("currency code must be three latin letters")
+	ErrInvalidWalletName    = errors.New("wallet name must not be blank")
+	ErrInvalidPeriod        = errors.New("from must not be after to")
+)
@@ -6,6 +6,7 @@ import (
 
 	pb "github.com/mizmorr/grpc_exchange/exchange"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/shopspring/decimal"
 )
 
 type RemoteExchanger interface {
@@ -13,29 +14,36 @@ type RemoteExchanger interface {
 	GetSpecificRate(ctx context.Context, code string) (*pb.ExchangeRateResponse, error)
 }
 
+// Cash keeps rates as decimal strings, so a cached rate reads back exactly
+// as it was converted on arrival.
 type Cash interface {
-	Set(ctx context.Context, key string, value float64, expiration time.Duration) error
-	Get(ctx context.Context, key string) (float64, error)
+	SetBytes(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	GetBytes(ctx context.Context, key string) ([]byte, error)
+}
+
+// Currencies lists the codes whose rates GetExchangeRates returns.
+type Currencies interface {
+	Codes(ctx context.Context) ([]string, error)
 }
 
 type Exchanger struct {
-	remote   RemoteExchanger
-	cash     Cash
-	cacheTTL time.Duration
-	rates    []string
+	remote     RemoteExchanger
+	cash       Cash
+	cacheTTL   time.Duration
+	currencies Currencies
 }
 
-func New(remote RemoteExchanger, cash Cash, rates []string, ttl time.Duration) (*Exchanger, error) {
+func New(remote RemoteExchanger, cash Cash, currencies Currencies, ttl time.Duration) (*Exchanger, error) {
 	return &Exchanger{
-		remote:   remote,
-		cash:     cash,
-		cacheTTL: ttl,
-		rates:    rates,
+		remote:     remote,
+		cash:       cash,
+		cacheTTL:   ttl,
+		currencies: currencies,
 	}, nil
 }
 
 func (c *Exchanger) GetExchangeRate(ctx context.Context, currencyCode string) (*domain.RateResponse, error) {
-	if rate, err := c.cash.Get(ctx, currencyCode); err == nil {
+	if rate, ok := c.cached(ctx, currencyCode); ok {
 		return &domain.RateResponse{CurrencyCode: currencyCode, Value: rate}, nil
 	}
 
@@ -43,35 +51,35 @@ func (c *Exchanger) GetExchangeRate(ctx context.Context, currencyCode string) (*
 	if err != nil {
 		return nil, err
 	}
-	_ = c.cash.Set(ctx, currencyCode, rate.Rate, c.cacheTTL)
 
 	return &domain.RateResponse{
 		CurrencyCode: rate.CurrencyCode,
-		Value:        rate.Rate,
+		Value:        c.store(ctx, rate.CurrencyCode, rate.Rate),
 	}, nil
 }
 
 func (e *Exchanger) GetExchangeRates(ctx context.Context) ([]*domain.RateResponse, error) {
-	var (
-		notFound []string
-		result   = make([]*domain.RateResponse, 0, len(e.rates))
-	)
-	notFound, result = e.scanCash(ctx)
+	codes, err := e.currencies.Codes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	notFound, result := e.scanCash(ctx, codes)
 
 	if len(notFound) == 0 {
 		return result, nil
 	}
 
-	if len(notFound) < len(e.rates) {
+	if len(notFound) < len(codes) {
 		return e.mediumPath(ctx, notFound, result)
 	}
-	return e.slowPath(ctx, result)
+	return e.slowPath(ctx, codes, result)
 }
 
-func (e *Exchanger) scanCash(ctx context.Context) (notFound []string, result []*domain.RateResponse) {
-	for _, currencyCode := range e.rates {
-		rate, err := e.cash.Get(ctx, currencyCode)
-		if err != nil {
+func (e *Exchanger) scanCash(ctx context.Context, codes []string) (notFound []string, result []*domain.RateResponse) {
+	for _, currencyCode := range codes {
+		rate, ok := e.cached(ctx, currencyCode)
+		if !ok {
 			notFound = append(notFound, currencyCode)
 		} else {
 			result = append(result, &domain.RateResponse{
@@ -89,29 +97,58 @@ func (e *Exchanger) mediumPath(ctx context.Context, codes []string, result []*do
 		if err != nil {
 			return nil, err
 		}
-		_ = e.cash.Set(ctx, currencyCode, rate.Rate, e.cacheTTL)
-
 		result = append(result, &domain.RateResponse{
 			CurrencyCode: rate.CurrencyCode,
-			Value:        rate.Rate,
+			Value:        e.store(ctx, rate.CurrencyCode, rate.Rate),
 		})
 	}
 	return result, nil
 }
 
-func (e *Exchanger) slowPath(ctx context.Context, result []*domain.RateResponse) ([]*domain.RateResponse, error) {
+// slowPath takes every rate in one call. The exchanger may still know
+// currencies that have been disabled since, those are left out.
+func (e *Exchanger) slowPath(ctx context.Context, codes []string, result []*domain.RateResponse) ([]*domain.RateResponse, error) {
 	rates, err := e.remote.GetAllRates(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	wanted := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		wanted[code] = true
+	}
+
 	for _, r := range rates.Rates {
-		_ = e.cash.Set(ctx, r.CurrencyCode, r.Rate, e.cacheTTL)
+		value := e.store(ctx, r.CurrencyCode, r.Rate)
+		if !wanted[r.CurrencyCode] {
+			continue
+		}
 
 		result = append(result, &domain.RateResponse{
 			CurrencyCode: r.CurrencyCode,
-			Value:        r.Rate,
+			Value:        value,
 		})
 	}
 	return result, nil
 }
+
+// cached reports a rate from the cache. An entry that does not parse as a
+// decimal counts as a miss and is fetched again.
+func (e *Exchanger) cached(ctx context.Context, code string) (decimal.Decimal, bool) {
+	raw, err := e.cash.GetBytes(ctx, code)
+	if err != nil {
+		return decimal.Decimal{}, false
+	}
+	rate, err := decimal.NewFromString(string(raw))
+	if err != nil {
+		return decimal.Decimal{}, false
+	}
+	return rate, true
+}
+
+// store converts a rate from the exchanger once and caches its decimal form.
+func (e *Exchanger) store(ctx context.Context, code string, rate float64) decimal.Decimal {
+	value := decimal.NewFromFloat(rate)
+	_ = e.cash.SetBytes(ctx, code, []byte(value.String()), e.cacheTTL)
+	return value
+}
@@ -0,0 +1,164 @@
+package fees
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	hundred = decimal.NewFromInt(100)
+
+	ErrSameCurrency = errors.New("cannot exchange a currency for itself")
+)
+
+type tier struct {
+	from    decimal.Decimal
+	percent decimal.Decimal
+}
+
+type rule struct {
+	spread  decimal.Decimal
+	percent decimal.Decimal
+	// minimum fee by target currency code
+	minimum map[string]decimal.Decimal
+	tiers   []tier
+}
+
+// Schedule holds the fee rule of every currency pair.
+type Schedule struct {
+	def   *rule
+	pairs map[string]*rule
+}
+
+// Charge is the breakdown of one exchange. Gross is the amount bought at
+// Rate, Net is what the user receives after the fee.
+type Charge struct {
+	Rate          decimal.Decimal
+	Gross         money.Money
+	Fee           money.Money
+	Net           money.Money
+	EffectiveRate decimal.Decimal
+}
+
+func New(cfg config.Fees) (*Schedule, error) {
+	def, err := parseRule(cfg.Default)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid default fee rule")
+	}
+
+	schedule := &Schedule{
+		def:   def,
+		pairs: make(map[string]*rule, len(cfg.Pairs)),
+	}
+	for pair, ruleCfg := range cfg.Pairs {
+		r, err := parseRule(ruleCfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid fee rule for %s", pair)
+		}
+		schedule.pairs[strings.ToUpper(pair)] = r
+	}
+	return schedule, nil
+}
+
+// Charge prices the exchange of amount into target at the mid rate: the
+// spread lowers the rate, the fee is taken from the bought amount. The fee
+// is rounded up and the gross amount down to the target's minor units.
+func (s *Schedule) Charge(amount money.Money, midRate decimal.Decimal, target string) (*Charge, error) {
+	// there is nothing to exchange, only a fee to pay
+	if amount.Currency == target {
+		return nil, ErrSameCurrency
+	}
+	r := s.rule(amount.Currency, target)
+
+	rate := midRate.Mul(hundred.Sub(r.spread)).DivRound(hundred, money.RateScale)
+	gross := amount.Convert(rate, target)
+
+	fee := gross.Amount.Mul(r.percentFor(amount.Amount)).Div(hundred)
+	if minimum := r.minimum[target]; fee.LessThan(minimum) {
+		fee = minimum
+	}
+	fee = fee.RoundUp(money.MinorUnits(target))
+
+	net := gross.Amount.Sub(fee)
+	if !net.IsPositive() {
+		return nil, errors.New("amount is too small to exchange")
+	}
+
+	return &Charge{
+		Rate:          rate,
+		Gross:         gross,
+		Fee:           money.New(fee, target),
+		Net:           money.New(net, target),
+		EffectiveRate: net.DivRound(amount.Amount, money.RateScale),
+	}, nil
+}
+
+func (s *Schedule) rule(base, target string) *rule {
+	if r, ok := s.pairs[base+"_"+target]; ok {
+		return r
+	}
+	return s.def
+}
+
+// percentFor returns the percent of the highest tier the amount reaches, or
+// the rule's flat percent below the first tier.
+func (r *rule) percentFor(amount decimal.Decimal) decimal.Decimal {
+	percent := r.percent
+	for _, t := range r.tiers {
+		if amount.LessThan(t.from) {
+			break
+		}
+		percent = t.percent
+	}
+	return percent
+}
+
+func parseRule(cfg config.FeeRule) (*rule, error) {
+	r := &rule{
+		spread:  decimal.NewFromFloat(cfg.Spread),
+		percent: decimal.NewFromFloat(cfg.Percent),
+		minimum: make(map[string]decimal.Decimal, len(cfg.Minimum)),
+	}
+	if r.spread.IsNegative() || r.spread.GreaterThanOrEqual(hundred) {
+		return nil, errors.New("spread must be in [0, 100)")
+	}
+	if r.percent.IsNegative() {
+		return nil, errors.New("fee must not be negative")
+	}
+	// viper keys come lower-cased
+	for currency, minimum := range cfg.Minimum {
+		m := decimal.NewFromFloat(minimum)
+		if m.IsNegative() {
+			return nil, errors.Errorf("minimum fee in %s must not be negative", currency)
+		}
+		r.minimum[strings.ToUpper(currency)] = m
+	}
+
+	for _, raw := range cfg.Tiers {
+		from, percent, ok := strings.Cut(strings.TrimSpace(raw), ":")
+		if !ok {
+			return nil, errors.Errorf("tier %q is not in from:percent format", raw)
+		}
+		t := tier{}
+		var err error
+		if t.from, err = decimal.NewFromString(from); err != nil {
+			return nil, errors.Wrapf(err, "invalid tier %q", raw)
+		}
+		if t.percent, err = decimal.NewFromString(percent); err != nil {
+			return nil, errors.Wrapf(err, "invalid tier %q", raw)
+		}
+		if t.from.IsNegative() || t.percent.IsNegative() {
+			return nil, errors.Errorf("tier %q must not be negative", raw)
+		}
+		r.tiers = append(r.tiers, t)
+	}
+	sort.Slice(r.tiers, func(i, j int) bool {
+		return r.tiers[i].from.LessThan(r.tiers[j].from)
+	})
+	return r, nil
+}
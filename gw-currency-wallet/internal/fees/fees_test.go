@@ -0,0 +1,91 @@
+package fees
+
+import (
+	"testing"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCharge(t *testing.T) {
+	schedule, err := New(config.Fees{
+		Default: config.FeeRule{Percent: 1, Minimum: map[string]float64{"usd": 0.5}},
+		Pairs: map[string]config.FeeRule{
+			// ключи приходят из viper в нижнем регистре
+			"usd_eur": {Spread: 2, Percent: 1, Tiers: []string{"10000:0.25", "1000:0.5"}},
+		},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		amount        money.Money
+		target        string
+		gross         string
+		fee           string
+		net           string
+		effectiveRate string
+	}{
+		{
+			name:   "default percent",
+			amount: money.New(decimal.NewFromInt(200), "EUR"), target: "USD",
+			gross: "200", fee: "2", net: "198", effectiveRate: "0.99",
+		},
+		{
+			name:   "default minimum",
+			amount: money.New(decimal.NewFromInt(10), "EUR"), target: "USD",
+			gross: "10", fee: "0.5", net: "9.5", effectiveRate: "0.95",
+		},
+		{
+			// минимум задаётся в каждой валюте отдельно
+			name:   "no minimum for the currency",
+			amount: money.New(decimal.NewFromInt(10), "USD"), target: "GBP",
+			gross: "10", fee: "0.1", net: "9.9", effectiveRate: "0.99",
+		},
+		{
+			name:   "pair with spread",
+			amount: money.New(decimal.NewFromInt(100), "USD"), target: "EUR",
+			gross: "98", fee: "0.98", net: "97.02", effectiveRate: "0.9702",
+		},
+		{
+			name:   "pair tier",
+			amount: money.New(decimal.NewFromInt(1000), "USD"), target: "EUR",
+			gross: "980", fee: "4.9", net: "975.1", effectiveRate: "0.9751",
+		},
+		{
+			name:   "fee rounded up",
+			amount: money.New(decimal.RequireFromString("100.01"), "EUR"), target: "USD",
+			gross: "100.01", fee: "1.01", net: "99", effectiveRate: "0.9899010099",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			charge, err := schedule.Charge(tt.amount, decimal.NewFromInt(1), tt.target)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.gross, charge.Gross.Amount.String())
+			assert.Equal(t, tt.fee, charge.Fee.Amount.String())
+			assert.Equal(t, tt.net, charge.Net.Amount.String())
+			assert.Equal(t, tt.effectiveRate, charge.EffectiveRate.String())
+		})
+	}
+
+	_, err = schedule.Charge(money.New(decimal.RequireFromString("0.4"), "EUR"), decimal.NewFromInt(1), "USD")
+	assert.Error(t, err)
+
+	// обмен валюты на саму себя только списал бы комиссию
+	_, err = schedule.Charge(money.New(decimal.NewFromInt(100), "USD"), decimal.NewFromInt(1), "USD")
+	assert.ErrorIs(t, err, ErrSameCurrency)
+}
+
+func TestInvalidRule(t *testing.T) {
+	_, err := New(config.Fees{Default: config.FeeRule{Tiers: []string{"1000"}}})
+	assert.Error(t, err)
+
+	_, err = New(config.Fees{Default: config.FeeRule{Percent: -1}})
+	assert.Error(t, err)
+
+	_, err = New(config.Fees{Default: config.FeeRule{Minimum: map[string]float64{"usd": -1}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+package limits
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// Schedule holds the configured limit of every operation and currency.
+type Schedule struct {
+	limits map[string]*store.Limit
+}
+
+func New(cfg config.Limits) (*Schedule, error) {
+	schedule := &Schedule{limits: make(map[string]*store.Limit)}
+
+	for operation, rules := range map[string]map[string]config.LimitRule{
+		store.OperationWithdraw: cfg.Withdraw,
+		store.OperationExchange: cfg.Exchange,
+	} {
+		for currency, rule := range rules {
+			// viper lowercases map keys
+			currency = strings.ToUpper(currency)
+
+			limit, err := parseRule(operation, currency, rule)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s limit for %s", operation, currency)
+			}
+			if limit.Daily.Valid || limit.Monthly.Valid {
+				schedule.limits[key(operation, currency)] = limit
+			}
+		}
+	}
+	return schedule, nil
+}
+
+// Limit returns the limit of the operation in the currency, taking every
+// period the user has an override for from the override. It is nil when
+// the operation is not limited.
+func (s *Schedule) Limit(operation, currency string, overrides []*store.Limit) *store.Limit {
+	limit := s.merge(operation, currency, overrides)
+	if !limit.Daily.Valid && !limit.Monthly.Valid {
+		return nil
+	}
+	return limit
+}
+
+// Limits returns every limit that applies to the user, ordered by operation
+// and currency.
+func (s *Schedule) Limits(overrides []*store.Limit) []*store.Limit {
+	keys := make(map[string][2]string, len(s.limits)+len(overrides))
+	for _, limit := range s.limits {
+		keys[key(limit.Operation, limit.Currency)] = [2]string{limit.Operation, limit.Currency}
+	}
+	for _, override := range overrides {
+		keys[key(override.Operation, override.Currency)] = [2]string{override.Operation, override.Currency}
+	}
+
+	limits := make([]*store.Limit, 0, len(keys))
+	for _, k := range keys {
+		if limit := s.Limit(k[0], k[1], overrides); limit != nil {
+			limits = append(limits, limit)
+		}
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		if limits[i].Operation != limits[j].Operation {
+			return limits[i].Operation < limits[j].Operation
+		}
+		return limits[i].Currency < limits[j].Currency
+	})
+	return limits
+}
+
+func (s *Schedule) merge(operation, currency string, overrides []*store.Limit) *store.Limit {
+	limit := &store.Limit{Operation: operation, Currency: currency}
+	if configured, ok := s.limits[key(operation, currency)]; ok {
+		limit.Daily, limit.Monthly = configured.Daily, configured.Monthly
+	}
+
+	for _, override := range overrides {
+		if override.Operation != operation || override.Currency != currency {
+			continue
+		}
+		if override.Daily.Valid {
+			limit.Daily = override.Daily
+		}
+		if override.Monthly.Valid {
+			limit.Monthly = override.Monthly
+		}
+	}
+	return limit
+}
+
+func parseRule(operation, currency string, cfg config.LimitRule) (*store.Limit, error) {
+	if cfg.Daily < 0 || cfg.Monthly < 0 {
+		return nil, errors.New("limit must not be negative")
+	}
+
+	limit := &store.Limit{Operation: operation, Currency: currency}
+	if cfg.Daily > 0 {
+		limit.Daily = decimal.NewNullDecimal(decimal.NewFromFloat(cfg.Daily))
+	}
+	if cfg.Monthly > 0 {
+		limit.Monthly = decimal.NewNullDecimal(decimal.NewFromFloat(cfg.Monthly))
+	}
+	return limit, nil
+}
+
+func key(operation, currency string) string {
+	return operation + "_" + currency
+}
@@ -0,0 +1,71 @@
+package limits
+
+import (
+	"testing"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func amount(value int64) decimal.NullDecimal {
+	return decimal.NewNullDecimal(decimal.NewFromInt(value))
+}
+
+func assertAmount(t *testing.T, expected int64, actual decimal.NullDecimal) {
+	t.Helper()
+	if assert.True(t, actual.Valid) {
+		assert.True(t, decimal.NewFromInt(expected).Equal(actual.Decimal), "expected %d, got %s", expected, actual.Decimal)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	schedule, err := New(config.Limits{
+		// ключи приходят из viper в нижнем регистре
+		Withdraw: map[string]config.LimitRule{
+			"usd": {Daily: 1000, Monthly: 5000},
+			"eur": {Monthly: 3000},
+			"rub": {},
+		},
+		Exchange: map[string]config.LimitRule{
+			"usd": {Daily: 2000},
+		},
+	})
+	assert.NoError(t, err)
+
+	limit := schedule.Limit(store.OperationWithdraw, "USD", nil)
+	if assert.NotNil(t, limit) {
+		assertAmount(t, 1000, limit.Daily)
+		assertAmount(t, 5000, limit.Monthly)
+	}
+
+	// нулевой лимит означает отсутствие лимита
+	assert.Nil(t, schedule.Limit(store.OperationWithdraw, "RUB", nil))
+	assert.Nil(t, schedule.Limit(store.OperationExchange, "EUR", nil))
+
+	overrides := []*store.Limit{
+		{Operation: store.OperationWithdraw, Currency: "USD", Daily: amount(100)},
+		{Operation: store.OperationWithdraw, Currency: "RUB", Monthly: amount(50000)},
+		{Operation: store.OperationWithdraw, Currency: "EUR", Monthly: amount(0)},
+	}
+
+	// личный лимит заменяет только заданные в нём периоды
+	limit = schedule.Limit(store.OperationWithdraw, "USD", overrides)
+	if assert.NotNil(t, limit) {
+		assertAmount(t, 100, limit.Daily)
+		assertAmount(t, 5000, limit.Monthly)
+	}
+
+	limits := schedule.Limits(overrides)
+	if assert.Len(t, limits, 4) {
+		assert.Equal(t, [2]string{store.OperationExchange, "USD"}, [2]string{limits[0].Operation, limits[0].Currency})
+		assert.Equal(t, [2]string{store.OperationWithdraw, "EUR"}, [2]string{limits[1].Operation, limits[1].Currency})
+		assertAmount(t, 0, limits[1].Monthly)
+		assert.Equal(t, [2]string{store.OperationWithdraw, "RUB"}, [2]string{limits[2].Operation, limits[2].Currency})
+		assert.Equal(t, [2]string{store.OperationWithdraw, "USD"}, [2]string{limits[3].Operation, limits[3].Currency})
+	}
+
+	_, err = New(config.Limits{Withdraw: map[string]config.LimitRule{"usd": {Daily: -1}}})
+	assert.Error(t, err)
+}
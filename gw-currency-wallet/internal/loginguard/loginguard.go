@@ -0,0 +1,149 @@
+package loginguard
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/pkg/errors"
+)
+
+type Storage interface {
+	Incr(ctx context.Context, key string, expiration time.Duration) (int64, error)
+	SetBytes(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Del(ctx context.Context, key string) error
+}
+
+// LockedError is returned while a username or an IP has to wait before the
+// next login attempt.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// RetryAfterSeconds is the wait rounded up to whole seconds, as sent in the
+// Retry-After header.
+func (e *LockedError) RetryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// Guard counts failed logins per username and per IP. Every failure of a
+// username makes it wait twice as long before the next attempt, and after
+// the configured number of failures within the window the username or the
+// IP is locked out.
+type Guard struct {
+	storage Storage
+	cfg     config.LoginGuard
+}
+
+func New(storage Storage, cfg config.LoginGuard) *Guard {
+	return &Guard{
+		storage: storage,
+		cfg:     cfg,
+	}
+}
+
+// Check refuses the attempt while the username or the IP is waiting out a
+// delay or a lockout.
+func (g *Guard) Check(ctx context.Context, username, ip string) error {
+	var wait time.Duration
+	for _, key := range []string{waitKey(userSubject(username)), waitKey(ipSubject(ip))} {
+		ttl, err := g.storage.TTL(ctx, key)
+		if err != nil {
+			return errors.Wrap(err, "failed to check login attempts")
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+	if wait > 0 {
+		return &LockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// Fail records a failed attempt for the username and the IP.
+func (g *Guard) Fail(ctx context.Context, username, ip string) error {
+	err := g.fail(ctx, userSubject(username), g.cfg.MaxAttempts, true)
+	if err != nil {
+		return err
+	}
+	return g.fail(ctx, ipSubject(ip), g.cfg.IPMaxAttempts, false)
+}
+
+// Succeed forgets the failures of the username. The IP keeps its count, so
+// one valid account does not let an address try others for free.
+func (g *Guard) Succeed(ctx context.Context, username string) error {
+	return g.Unlock(ctx, username)
+}
+
+// Unlock clears the failures and the lockout of the username.
+func (g *Guard) Unlock(ctx context.Context, username string) error {
+	subject := userSubject(username)
+	for _, key := range []string{failKey(subject), waitKey(subject)} {
+		if err := g.storage.Del(ctx, key); err != nil {
+			return errors.Wrap(err, "failed to reset login attempts")
+		}
+	}
+	return nil
+}
+
+func (g *Guard) fail(ctx context.Context, subject string, maxAttempts int, progressive bool) error {
+	count, err := g.storage.Incr(ctx, failKey(subject), g.cfg.Window)
+	if err != nil {
+		return errors.Wrap(err, "failed to count login attempt")
+	}
+
+	var wait time.Duration
+	switch {
+	case maxAttempts > 0 && count >= int64(maxAttempts):
+		wait = g.cfg.LockoutDuration
+	case progressive:
+		wait = g.delay(count)
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	err = g.storage.SetBytes(ctx, waitKey(subject), []byte{1}, wait)
+	if err != nil {
+		return errors.Wrap(err, "failed to delay login attempts")
+	}
+	return nil
+}
+
+// delay doubles with every failure, starting at the base delay and never
+// exceeding the maximum.
+func (g *Guard) delay(failures int64) time.Duration {
+	delay := g.cfg.BaseDelay
+	for i := int64(1); i < failures && delay < g.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if g.cfg.MaxDelay > 0 && delay > g.cfg.MaxDelay {
+		delay = g.cfg.MaxDelay
+	}
+	return delay
+}
+
+func userSubject(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+func failKey(subject string) string {
+	return "login:fail:" + subject
+}
+
+func waitKey(subject string) string {
+	return "login:wait:" + subject
+}
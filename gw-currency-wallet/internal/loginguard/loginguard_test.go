@@ -0,0 +1,124 @@
+package loginguard
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStorage хранит вместо времени истечения сам TTL ключа
+type memoryStorage struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	ttls     map[string]time.Duration
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{counters: map[string]int64{}, ttls: map[string]time.Duration{}}
+}
+
+func (m *memoryStorage) Incr(_ context.Context, key string, expiration time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[key]++
+	if m.counters[key] == 1 {
+		m.ttls[key] = expiration
+	}
+	return m.counters[key], nil
+}
+
+func (m *memoryStorage) SetBytes(_ context.Context, key string, _ []byte, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ttls[key] = expiration
+	return nil
+}
+
+func (m *memoryStorage) TTL(_ context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ttls[key], nil
+}
+
+func (m *memoryStorage) Del(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.counters, key)
+	delete(m.ttls, key)
+	return nil
+}
+
+func (m *memoryStorage) expire(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.ttls, key)
+}
+
+func TestProgressiveDelayAndLockout(t *testing.T) {
+	ctx := context.Background()
+	storage := newMemoryStorage()
+	guard := New(storage, config.LoginGuard{
+		MaxAttempts:     4,
+		IPMaxAttempts:   100,
+		Window:          15 * time.Minute,
+		LockoutDuration: 15 * time.Minute,
+		BaseDelay:       time.Second,
+		MaxDelay:        3 * time.Second,
+	})
+
+	assert.NoError(t, guard.Check(ctx, "alice", "10.0.0.1"))
+
+	// задержка растёт с каждой неудачей, но не больше максимальной
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		assert.NoError(t, guard.Fail(ctx, "Alice", "10.0.0.1"))
+
+		var locked *LockedError
+		assert.True(t, errors.As(guard.Check(ctx, "alice", "10.0.0.2"), &locked))
+		assert.Equal(t, want, locked.RetryAfter)
+
+		storage.expire(waitKey(userSubject("alice")))
+	}
+
+	// после MaxAttempts неудач имя блокируется
+	assert.NoError(t, guard.Fail(ctx, "alice", "10.0.0.1"))
+	var locked *LockedError
+	assert.True(t, errors.As(guard.Check(ctx, "alice", "10.0.0.3"), &locked))
+	assert.Equal(t, 15*time.Minute, locked.RetryAfter)
+	assert.Equal(t, 900, locked.RetryAfterSeconds())
+
+	// другие пользователи с того же адреса не затронуты
+	assert.NoError(t, guard.Check(ctx, "bob", "10.0.0.1"))
+
+	assert.NoError(t, guard.Unlock(ctx, "ALICE"))
+	assert.NoError(t, guard.Check(ctx, "alice", "10.0.0.1"))
+}
+
+func TestIPLockout(t *testing.T) {
+	ctx := context.Background()
+	guard := New(newMemoryStorage(), config.LoginGuard{
+		MaxAttempts:     100,
+		IPMaxAttempts:   3,
+		Window:          time.Minute,
+		LockoutDuration: time.Hour,
+	})
+
+	for _, username := range []string{"a", "b", "c"} {
+		assert.NoError(t, guard.Check(ctx, username, "10.0.0.1"))
+		assert.NoError(t, guard.Fail(ctx, username, "10.0.0.1"))
+	}
+
+	// перебор разных имён с одного адреса блокирует адрес
+	var locked *LockedError
+	assert.True(t, errors.As(guard.Check(ctx, "d", "10.0.0.1"), &locked))
+	assert.Equal(t, time.Hour, locked.RetryAfter)
+
+	// успешный вход не снимает блокировку адреса
+	assert.NoError(t, guard.Succeed(ctx, "d"))
+	assert.Error(t, guard.Check(ctx, "d", "10.0.0.1"))
+	assert.NoError(t, guard.Check(ctx, "d", "10.0.0.2"))
+}
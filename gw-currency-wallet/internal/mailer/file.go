@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	logger "github.com/mizmorr/loggerm"
+	"github.com/pkg/errors"
+)
+
+// File appends every message to a file instead of sending it, for local
+// development and tests.
+type File struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+func NewFile(path, from string) *File {
+	return &File{
+		path: path,
+		from: from,
+	}
+}
+
+func (m *File) Send(_ context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open mail file")
+	}
+	defer file.Close()
+
+	data := append(format(m.from, msg), "\r\n"...)
+	if _, err = file.Write(data); err != nil {
+		return errors.Wrap(err, "failed to write mail file")
+	}
+	return nil
+}
+
+// Log writes the recipient and the subject of every message to the service
+// log instead of sending it. The body is left out: it carries verification
+// and reset tokens that must not end up in the logs.
+type Log struct {
+	log *logger.Logger
+}
+
+func NewLog(log *logger.Logger) *Log {
+	return &Log{
+		log: log,
+	}
+}
+
+func (m *Log) Send(_ context.Context, msg *Message) error {
+	m.log.Info().Str("to", msg.To).Str("subject", msg.Subject).Msg("Email")
+	return nil
+}
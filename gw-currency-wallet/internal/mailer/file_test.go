@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := NewFile(path, "no-reply@example.com")
+
+	err := m.Send(context.Background(), &Message{
+		To:      "user@example.com",
+		Subject: "Confirm\r\nBcc: victim@example.com",
+		Body:    "first line\nsecond line",
+	})
+	assert.NoError(t, err)
+	err = m.Send(context.Background(), &Message{To: "other@example.com", Subject: "Second", Body: "body"})
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	content := string(data)
+
+	assert.Contains(t, content, "From: no-reply@example.com\r\n")
+	assert.Contains(t, content, "To: user@example.com\r\n")
+	assert.Contains(t, content, "first line\r\nsecond line\r\n")
+	assert.Contains(t, content, "To: other@example.com\r\n")
+	// перевод строки в теме не добавляет заголовков
+	assert.Contains(t, content, "Subject: ConfirmBcc: victim@example.com\r\n")
+	assert.False(t, strings.Contains(content, "\r\nBcc:"))
+}
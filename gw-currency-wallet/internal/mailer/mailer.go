@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	logger "github.com/mizmorr/loggerm"
+	"github.com/pkg/errors"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New returns the mailer of the configured transport. Failed sends are
+// logged, so a caller that keeps the failure from the client still leaves
+// a trace of it.
+func New(cfg config.Mailer, log *logger.Logger) (Mailer, error) {
+	var transport Mailer
+	switch cfg.Transport {
+	case "smtp":
+		transport = NewSMTP(cfg.SMTP, cfg.From)
+	case "file":
+		transport = NewFile(cfg.FilePath, cfg.From)
+	case "log":
+		transport = NewLog(log)
+	default:
+		return nil, errors.Errorf("unknown mailer transport %q", cfg.Transport)
+	}
+	return &logFailures{transport: transport, log: log}, nil
+}
+
+type logFailures struct {
+	transport Mailer
+	log       *logger.Logger
+}
+
+func (m *logFailures) Send(ctx context.Context, msg *Message) error {
+	err := m.transport.Send(ctx, msg)
+	if err != nil {
+		m.log.Err(err).Str("to", msg.To).Str("subject", msg.Subject).Msg("Failed to send email")
+	}
+	return err
+}
+
+// format renders the message as an RFC 5322 email. Line breaks are dropped
+// from the header values so they cannot smuggle in extra headers.
+func format(from string, msg *Message) []byte {
+	clean := strings.NewReplacer("\r", "", "\n", "")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", clean.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", clean.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", clean.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/pkg/errors"
+)
+
+// SMTP delivers messages through an SMTP server, authenticating when a
+// username is configured.
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTP(cfg config.SMTP, from string) *SMTP {
+	m := &SMTP{
+		addr: net.JoinHostPort(cfg.Host, cfg.Port),
+		from: from,
+	}
+	if cfg.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return m
+}
+
+func (m *SMTP) Send(_ context.Context, msg *Message) error {
+	err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, format(m.from, msg))
+	if err != nil {
+		return errors.Wrap(err, "failed to send email")
+	}
+	return nil
+}
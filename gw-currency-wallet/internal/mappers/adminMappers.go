@@ -0,0 +1,71 @@
+package mappers
+
+import (
+	"errors"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+)
+
+func ToDomainAdminUser(u *store.User) *domain.AdminUserResponse {
+	return &domain.AdminUserResponse{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		Role:          u.Role,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		FrozenAt:      u.FrozenAt,
+		CreatedAt:     u.CreatedAt,
+	}
+}
+
+func ToDomainAdminUsers(storeUsers []*store.User) []*domain.AdminUserResponse {
+	users := make([]*domain.AdminUserResponse, 0, len(storeUsers))
+	for _, u := range storeUsers {
+		users = append(users, ToDomainAdminUser(u))
+	}
+	return users
+}
+
+func ToStoreAuditFilter(req *domain.AuditLogRequest) (*store.AuditFilter, error) {
+	if req == nil {
+		return nil, errors.New("audit log request is nil")
+	}
+
+	filter := &store.AuditFilter{
+		TargetUserID: req.UserID,
+		Limit:        req.Limit,
+	}
+	if req.Cursor != "" {
+		beforeID, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.BeforeID = beforeID
+	}
+	return filter, nil
+}
+
+// ToDomainAuditLog maps a page fetched with one extra row, like
+// ToDomainTransactions.
+func ToDomainAuditLog(storeEntries []*store.AuditEntry, limit int) *domain.AuditLogResponse {
+	response := &domain.AuditLogResponse{
+		Entries: make([]*domain.AuditEntryResponse, 0, len(storeEntries)),
+	}
+	if len(storeEntries) > limit {
+		storeEntries = storeEntries[:limit]
+		response.NextCursor = encodeCursor(storeEntries[limit-1].ID)
+	}
+
+	for _, e := range storeEntries {
+		response.Entries = append(response.Entries, &domain.AuditEntryResponse{
+			ID:           e.ID,
+			ActorID:      e.ActorID,
+			Action:       e.Action,
+			TargetUserID: e.TargetUserID,
+			Details:      e.Details,
+			CreatedAt:    e.CreatedAt,
+		})
+	}
+	return response
+}
@@ -3,14 +3,18 @@ package mappers
 import (
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/shopspring/decimal"
 )
 
 func ToDomainBalance(storeBalance []*store.WalletCurrency) []*domain.BalanceResponse {
 	balances := make([]*domain.BalanceResponse, 0, len(storeBalance))
 	for _, b := range storeBalance {
 		balance := &domain.BalanceResponse{
-			Currency: b.Currency,
-			Value:    b.Balance,
+			WalletID:     b.WalletID,
+			Currency:     b.Currency,
+			Value:        b.Balance,
+			WalletStatus: b.WalletStatus,
 		}
 		balances = append(balances, balance)
 	}
@@ -20,17 +24,31 @@ func ToDomainBalance(storeBalance []*store.WalletCurrency) []*domain.BalanceResp
 func ToStoreDepositBalance(userid int64, updateRequest *domain.DepositRequest) *store.UpdateBalance {
 	return &store.UpdateBalance{
 		UserID:    userid,
-		Operation: "deposit",
-		Currency:  updateRequest.Currency,
-		Amount:    updateRequest.Amount,
+		WalletID:  updateRequest.WalletID,
+		Operation: store.OperationDeposit,
+		Money:     updateRequest.Money,
 	}
 }
 
 func ToStoreWithdrawBalance(userid int64, updateRequest *domain.WithdrawRequest) *store.UpdateBalance {
 	return &store.UpdateBalance{
-		Operation: "withdraw",
+		Operation: store.OperationWithdraw,
 		UserID:    userid,
-		Currency:  updateRequest.Currency,
-		Amount:    updateRequest.Amount,
+		WalletID:  updateRequest.WalletID,
+		Money:     updateRequest.Money,
+	}
+}
+
+func ToStoreTransfer(userid int64, req *domain.TransferRequest, received money.Money, rate, fee decimal.NullDecimal) *store.Transfer {
+	return &store.Transfer{
+		FromUserID:   userid,
+		FromWalletID: req.WalletID,
+		Recipient:    req.Recipient,
+		FromCurrency: req.Currency,
+		FromAmount:   req.Amount,
+		ToCurrency:   received.Currency,
+		ToAmount:     received.Amount,
+		Rate:         rate,
+		Fee:          fee,
 	}
 }
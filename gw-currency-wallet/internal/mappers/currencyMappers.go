@@ -0,0 +1,38 @@
+package mappers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+)
+
+// currencyCode matches ISO 4217 codes, the exchanger stores rates under
+// three-letter codes only.
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+func ToDomainCurrencies(currencies []*store.Currency) []*domain.CurrencyResponse {
+	response := make([]*domain.CurrencyResponse, 0, len(currencies))
+	for _, c := range currencies {
+		response = append(response, &domain.CurrencyResponse{
+			Code:       c.Code,
+			Name:       c.Name,
+			MinorUnits: c.MinorUnits,
+		})
+	}
+	return response
+}
+
+func ToStoreCurrency(code string, req *domain.SetCurrencyRequest) (*store.Currency, error) {
+	code = strings.ToUpper(code)
+	if !currencyCode.MatchString(code) {
+		return nil, domain.ErrInvalidCurrencyCode
+	}
+	return &store.Currency{
+		Code:       code,
+		Name:       req.Name,
+		MinorUnits: *req.MinorUnits,
+		Enabled:    *req.Enabled,
+	}, nil
+}
@@ -0,0 +1,25 @@
+package mappers
+
+import (
+	"testing"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToStoreCurrency(t *testing.T) {
+	units, enabled := int32(0), true
+	req := &domain.SetCurrencyRequest{Name: "Japanese yen", MinorUnits: &units, Enabled: &enabled, Reason: "launch"}
+
+	currency, err := ToStoreCurrency("jpy", req)
+	assert.NoError(t, err)
+	assert.Equal(t, "JPY", currency.Code)
+	assert.Equal(t, int32(0), currency.MinorUnits)
+	assert.True(t, currency.Enabled)
+
+	// код курса в обменнике хранится тремя буквами
+	for _, code := range []string{"US", "USDT", "U$D", ""} {
+		_, err = ToStoreCurrency(code, req)
+		assert.ErrorIs(t, err, domain.ErrInvalidCurrencyCode)
+	}
+}
@@ -0,0 +1,66 @@
+package mappers
+
+import (
+	"strings"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+// ToDomainLimits pairs every limit with its usage. The remaining allowance
+// never goes below zero, even after a limit was lowered.
+func ToDomainLimits(limits []*store.Limit, usage []*store.LimitUsage) []*domain.LimitResponse {
+	used := make(map[[2]string]*store.LimitUsage, len(usage))
+	for _, u := range usage {
+		used[[2]string{u.Operation, u.Currency}] = u
+	}
+
+	response := make([]*domain.LimitResponse, 0, len(limits))
+	for _, limit := range limits {
+		u, ok := used[[2]string{limit.Operation, limit.Currency}]
+		if !ok {
+			u = &store.LimitUsage{}
+		}
+		response = append(response, &domain.LimitResponse{
+			Operation: limit.Operation,
+			Currency:  limit.Currency,
+			Daily:     toDomainAllowance(limit.Daily, u.Daily),
+			Monthly:   toDomainAllowance(limit.Monthly, u.Monthly),
+		})
+	}
+	return response
+}
+
+func toDomainAllowance(limit decimal.NullDecimal, used decimal.Decimal) *domain.AllowanceResponse {
+	if !limit.Valid {
+		return nil
+	}
+	return &domain.AllowanceResponse{
+		Limit:     limit.Decimal,
+		Used:      used,
+		Remaining: decimal.Max(limit.Decimal.Sub(used), decimal.Zero),
+	}
+}
+
+// ToStoreLimit checks the amounts of a user's own limit: they may be zero,
+// which stops the operation, but not negative.
+func ToStoreLimit(req *domain.SetLimitRequest) (*store.Limit, error) {
+	limit := &store.Limit{
+		Operation: req.Operation,
+		Currency:  strings.ToUpper(req.Currency),
+		Daily:     req.Daily,
+		Monthly:   req.Monthly,
+	}
+	for _, amount := range []decimal.NullDecimal{limit.Daily, limit.Monthly} {
+		if !amount.Valid {
+			continue
+		}
+		units := money.MinorUnits(limit.Currency)
+		if amount.Decimal.IsNegative() || !amount.Decimal.Equal(amount.Decimal.Truncate(units)) {
+			return nil, domain.ErrInvalidLimit
+		}
+	}
+	return limit, nil
+}
@@ -0,0 +1,46 @@
+package mappers
+
+import (
+	"testing"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToDomainLimits(t *testing.T) {
+	limits := []*store.Limit{
+		{Operation: store.OperationExchange, Currency: "EUR", Monthly: decimal.NewNullDecimal(decimal.NewFromInt(500))},
+		{Operation: store.OperationWithdraw, Currency: "USD", Daily: decimal.NewNullDecimal(decimal.NewFromInt(100)), Monthly: decimal.NewNullDecimal(decimal.NewFromInt(1000))},
+	}
+	usage := []*store.LimitUsage{
+		{Operation: store.OperationWithdraw, Currency: "USD", Daily: decimal.NewFromInt(150), Monthly: decimal.NewFromInt(400)},
+		{Operation: store.OperationWithdraw, Currency: "RUB", Daily: decimal.NewFromInt(10), Monthly: decimal.NewFromInt(10)},
+	}
+
+	response := ToDomainLimits(limits, usage)
+	assert.Len(t, response, 2)
+
+	// без использования остаётся весь лимит, период без лимита не выводится
+	assert.Nil(t, response[0].Daily)
+	assert.True(t, decimal.NewFromInt(500).Equal(response[0].Monthly.Remaining))
+
+	// остаток не бывает отрицательным после снижения лимита
+	assert.True(t, decimal.Zero.Equal(response[1].Daily.Remaining))
+	assert.True(t, decimal.NewFromInt(150).Equal(response[1].Daily.Used))
+	assert.True(t, decimal.NewFromInt(600).Equal(response[1].Monthly.Remaining))
+}
+
+func TestToStoreLimit(t *testing.T) {
+	limit, err := ToStoreLimit(&domain.SetLimitRequest{Operation: store.OperationWithdraw, Currency: "usd", Daily: decimal.NewNullDecimal(decimal.Zero)})
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", limit.Currency)
+	assert.False(t, limit.Monthly.Valid)
+
+	_, err = ToStoreLimit(&domain.SetLimitRequest{Operation: store.OperationWithdraw, Currency: "USD", Daily: decimal.NewNullDecimal(decimal.NewFromInt(-1))})
+	assert.ErrorIs(t, err, domain.ErrInvalidLimit)
+
+	_, err = ToStoreLimit(&domain.SetLimitRequest{Operation: store.OperationWithdraw, Currency: "USD", Monthly: decimal.NewNullDecimal(decimal.RequireFromString("0.001"))})
+	assert.ErrorIs(t, err, domain.ErrInvalidLimit)
+}
@@ -0,0 +1,20 @@
+package mappers
+
+import (
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+)
+
+func ToDomainSessions(storeSessions []*store.Session) []*domain.SessionResponse {
+	sessions := make([]*domain.SessionResponse, 0, len(storeSessions))
+	for _, s := range storeSessions {
+		sessions = append(sessions, &domain.SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+		})
+	}
+	return sessions
+}
@@ -0,0 +1,91 @@
+package mappers
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+)
+
+func ToStoreTransactionFilter(userid int64, req *domain.TransactionsRequest) (*store.TransactionFilter, error) {
+	if req == nil {
+		return nil, errors.New("transactions request is nil")
+	}
+
+	filter := &store.TransactionFilter{
+		UserID:    userid,
+		WalletID:  req.WalletID,
+		Operation: req.Type,
+		Currency:  req.Currency,
+		Limit:     req.Limit,
+	}
+	if !req.From.IsZero() {
+		filter.From = &req.From
+	}
+	if !req.To.IsZero() {
+		filter.To = &req.To
+	}
+	if req.Cursor != "" {
+		beforeID, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.BeforeID = beforeID
+	}
+	return filter, nil
+}
+
+// ToDomainTransactions maps a page fetched with one extra row: if the extra
+// row is present it is dropped and the cursor to the next page is set.
+func ToDomainTransactions(storeTransactions []*store.Transaction, limit int) *domain.TransactionsResponse {
+	response := &domain.TransactionsResponse{
+		Transactions: make([]*domain.TransactionResponse, 0, len(storeTransactions)),
+	}
+	if len(storeTransactions) > limit {
+		storeTransactions = storeTransactions[:limit]
+		response.NextCursor = encodeCursor(storeTransactions[limit-1].ID)
+	}
+
+	for _, t := range storeTransactions {
+		transaction := &domain.TransactionResponse{
+			ID:        t.ID,
+			Type:      t.Operation,
+			Entries:   make([]*domain.TransactionEntry, 0, len(t.Entries)),
+			CreatedAt: t.CreatedAt,
+		}
+		if t.Rate.Valid {
+			transaction.Rate = &t.Rate.Decimal
+		}
+		if t.Fee.Valid {
+			transaction.Fee = &t.Fee.Decimal
+		}
+		for _, e := range t.Entries {
+			transaction.Entries = append(transaction.Entries, &domain.TransactionEntry{
+				WalletID: e.WalletID,
+				Currency: e.Currency,
+				Amount:   e.Credit.Sub(e.Debit),
+				Balance:  e.BalanceAfter,
+			})
+		}
+		response.Transactions = append(response.Transactions, transaction)
+	}
+	return response
+}
+
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return id, nil
+}
@@ -0,0 +1,27 @@
+package mappers
+
+import (
+	"testing"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionsCursor(t *testing.T) {
+	transactions := []*store.Transaction{{ID: 30}, {ID: 20}, {ID: 10}}
+
+	page := ToDomainTransactions(transactions, 2)
+	assert.Len(t, page.Transactions, 2)
+	assert.NotEmpty(t, page.NextCursor)
+
+	filter, err := ToStoreTransactionFilter(1, &domain.TransactionsRequest{Cursor: page.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), filter.BeforeID)
+
+	lastPage := ToDomainTransactions(transactions[2:], 2)
+	assert.Empty(t, lastPage.NextCursor)
+
+	_, err = ToStoreTransactionFilter(1, &domain.TransactionsRequest{Cursor: "not-a-cursor"})
+	assert.Error(t, err)
+}
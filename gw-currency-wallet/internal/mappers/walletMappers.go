@@ -0,0 +1,34 @@
+package mappers
+
+import (
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+)
+
+func ToDomainWallets(wallets []*store.Wallet) []*domain.WalletResponse {
+	response := make([]*domain.WalletResponse, 0, len(wallets))
+	for _, w := range wallets {
+		response = append(response, ToDomainWallet(w))
+	}
+	return response
+}
+
+func ToDomainWallet(wallet *store.Wallet) *domain.WalletResponse {
+	return &domain.WalletResponse{
+		ID:        wallet.ID,
+		Name:      wallet.Name,
+		Primary:   wallet.Primary,
+		Status:    wallet.Status,
+		Balances:  ToDomainBalance(wallet.Balances),
+		CreatedAt: wallet.CreatedAt,
+	}
+}
+
+func ToStoreMove(userid int64, req *domain.MoveRequest) *store.Move {
+	return &store.Move{
+		UserID:       userid,
+		FromWalletID: req.FromWalletID,
+		ToWalletID:   req.ToWalletID,
+		Money:        req.Money,
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
@@ -8,7 +9,15 @@ import (
 	jwttoken "github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/jwtToken"
 )
 
-func JWTAuthMiddleware(secretKey string) gin.HandlerFunc {
+type TokenDenylist interface {
+	Contains(ctx context.Context, tokenID string) (bool, error)
+}
+
+// JWTAuthMiddleware accepts access tokens only: the token must be signed by
+// one of the keys, carry the expected issuer, audience and type and must not
+// be denylisted. It sets the user id, the role and the token id and expiry
+// for the handlers.
+func JWTAuthMiddleware(keys *jwttoken.KeySet, expected jwttoken.Expected, denylist TokenDenylist) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -24,17 +33,31 @@ func JWTAuthMiddleware(secretKey string) gin.HandlerFunc {
 
 		tokenString := parts[1]
 
-		err := jwttoken.Validate(tokenString, []byte(secretKey))
+		claims, err := jwttoken.Parse(tokenString, keys, expected)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
-		userID, err := jwttoken.GetUserID(tokenString, []byte(secretKey))
+
+		denied, err := denylist.Contains(c.Request.Context(), claims.ID)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "failed to check token"})
 			return
 		}
-		c.Set("user_id", userID)
+		if denied {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+			return
+		}
+
+		role := claims.Role
+		if role == "" {
+			role = DefaultRole
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("role", role)
+		c.Set("token_id", claims.ID)
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
 
 		c.Next()
 	}
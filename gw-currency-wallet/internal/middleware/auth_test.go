@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jwttoken "github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/jwtToken"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryDenylist map[string]bool
+
+func (m memoryDenylist) Contains(_ context.Context, tokenID string) (bool, error) {
+	return m[tokenID], nil
+}
+
+func TestJWTAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keys := jwttoken.NewHMACKeySet("secret")
+	expected := jwttoken.Expected{Type: jwttoken.TypeAccess, Issuer: "wallet", Audience: "wallet"}
+	denylist := memoryDenylist{}
+
+	router := gin.New()
+	router.GET("/me", JWTAuthMiddleware(keys, expected, denylist), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt64("user_id")})
+	})
+
+	get := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	access, refresh, err := jwttoken.GenerateTokens(&jwttoken.TokensOption{
+		UserID:      5,
+		AccessExp:   time.Minute,
+		RefreshExp:  time.Hour,
+		Issuer:      "wallet",
+		Audience:    "wallet",
+		AccessKeys:  keys,
+		RefreshKeys: keys,
+	})
+	assert.NoError(t, err)
+
+	w := get(access)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"user_id":5}`, w.Body.String())
+
+	// refresh токен не годится для доступа к API
+	assert.Equal(t, http.StatusUnauthorized, get(refresh).Code)
+
+	claims, err := jwttoken.Parse(access, keys, expected)
+	assert.NoError(t, err)
+	denylist[claims.ID] = true
+	assert.Equal(t, http.StatusUnauthorized, get(access).Code)
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+// DefaultRole is assumed for access tokens issued before roles existed.
+const DefaultRole = "user"
+
+// Users reads the current role and status of a user.
+type Users interface {
+	GetUser(ctx context.Context, userid int64) (*store.User, error)
+}
+
+// RequireRole returns a check that lets a request through only if the user
+// currently has one of the roles and is not frozen. The role is read from
+// the users table rather than the access token, so a demotion or a freeze
+// applies to tokens already issued. It runs after JWTAuthMiddleware and
+// replaces the role it set with the current one.
+func RequireRole(users Users) func(roles ...string) gin.HandlerFunc {
+	return func(roles ...string) gin.HandlerFunc {
+		allowed := make(map[string]struct{}, len(roles))
+		for _, role := range roles {
+			allowed[role] = struct{}{}
+		}
+
+		return func(c *gin.Context) {
+			// nested groups check the role again, the user is read once
+			if !c.GetBool("role_checked") {
+				user, err := users.GetUser(c.Request.Context(), c.GetInt64("user_id"))
+				if errors.Is(err, store.ErrUserNotFound) {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+					return
+				} else if err != nil {
+					c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "failed to check permissions"})
+					return
+				}
+				if user.FrozenAt != nil {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": store.ErrAccountFrozen.Error()})
+					return
+				}
+				c.Set("role", user.Role)
+				c.Set("role_checked", true)
+			}
+
+			if _, ok := allowed[c.GetString("role")]; !ok {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+				return
+			}
+			c.Next()
+		}
+	}
+}
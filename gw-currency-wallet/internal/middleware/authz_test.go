@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	jwttoken "github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/jwtToken"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryUsers map[int64]*store.User
+
+func (m memoryUsers) GetUser(_ context.Context, userid int64) (*store.User, error) {
+	user, ok := m[userid]
+	if !ok {
+		return nil, store.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func TestRequireRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keys := jwttoken.NewHMACKeySet("secret")
+	expected := jwttoken.Expected{Type: jwttoken.TypeAccess}
+
+	users := memoryUsers{}
+	requireRole := RequireRole(users)
+
+	router := gin.New()
+	router.Use(JWTAuthMiddleware(keys, expected, memoryDenylist{}))
+	router.GET("/support", requireRole("support", "admin"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"role": c.GetString("role")})
+	})
+	router.GET("/admin", requireRole("support", "admin"), requireRole("admin"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	var lastID int64
+	tokenFor := func(role string) string {
+		lastID++
+		users[lastID] = &store.User{ID: lastID, Role: role}
+		access, _, err := jwttoken.GenerateTokens(&jwttoken.TokensOption{
+			UserID:      lastID,
+			Role:        role,
+			AccessExp:   time.Minute,
+			RefreshExp:  time.Minute,
+			AccessKeys:  keys,
+			RefreshKeys: keys,
+		})
+		assert.NoError(t, err)
+		return access
+	}
+	get := func(path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/support", tokenFor("support"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"role":"support"}`, w.Body.String())
+	assert.Equal(t, http.StatusForbidden, get("/admin", tokenFor("support")).Code)
+
+	assert.Equal(t, http.StatusOK, get("/support", tokenFor("admin")).Code)
+	assert.Equal(t, http.StatusOK, get("/admin", tokenFor("admin")).Code)
+
+	// пользователь без роли не проходит
+	w = get("/support", tokenFor(DefaultRole))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// роль берётся из базы: понижение действует на уже выданный токен
+	token := tokenFor("admin")
+	users[lastID].Role = "support"
+	assert.Equal(t, http.StatusForbidden, get("/admin", token).Code)
+	assert.Equal(t, http.StatusOK, get("/support", token).Code)
+
+	// замороженный администратор теряет доступ сразу
+	token = tokenFor("admin")
+	now := time.Now()
+	users[lastID].FrozenAt = &now
+	assert.Equal(t, http.StatusForbidden, get("/admin", token).Code)
+
+	// удалённый пользователь
+	token = tokenFor("admin")
+	delete(users, lastID)
+	assert.Equal(t, http.StatusForbidden, get("/admin", token).Code)
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+
+	maxIdempotencyKeyLength = 255
+)
+
+type IdempotencyStore interface {
+	SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error)
+	SetBytes(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	GetBytes(ctx context.Context, key string) ([]byte, error)
+	Del(ctx context.Context, key string) error
+}
+
+// idempotencyRecord is what is kept under a key. A zero Status means the
+// first request is still being processed.
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+	Body        []byte `json:"body"`
+}
+
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes requests carrying an Idempotency-Key header safe to
+// retry: the first response is stored per user and key and replayed for
+// repeated requests with the same body. It must run after the auth
+// middleware.
+func Idempotency(store IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var (
+			ctx         = c.Request.Context()
+			userID, _   = c.Get("user_id")
+			storeKey    = fmt.Sprintf("idempotency:%v:%s", userID, key)
+			fingerprint = requestFingerprint(c.Request.Method, c.FullPath(), body)
+		)
+
+		pending, _ := json.Marshal(&idempotencyRecord{Fingerprint: fingerprint})
+
+		reserved, err := store.SetNX(ctx, storeKey, pending, ttl)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "idempotency store is unavailable"})
+			return
+		}
+		if !reserved {
+			replay(c, store, storeKey, fingerprint)
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = recorder
+
+		// the record is finalized even if the client has gone away or the
+		// handler panics, otherwise every retry would get 409 until the
+		// pending record expires
+		finalizeCtx := context.WithoutCancel(ctx)
+		defer func() {
+			if r := recover(); r != nil {
+				_ = store.Del(finalizeCtx, storeKey)
+				panic(r)
+			}
+
+			// server errors are not remembered so the client can retry them
+			if recorder.Status() >= http.StatusInternalServerError {
+				_ = store.Del(finalizeCtx, storeKey)
+				return
+			}
+
+			completed, _ := json.Marshal(&idempotencyRecord{
+				Fingerprint: fingerprint,
+				Status:      recorder.Status(),
+				Body:        recorder.body.Bytes(),
+			})
+			_ = store.SetBytes(finalizeCtx, storeKey, completed, ttl)
+		}()
+
+		c.Next()
+	}
+}
+
+func replay(c *gin.Context, store IdempotencyStore, storeKey, fingerprint string) {
+	raw, err := store.GetBytes(c.Request.Context(), storeKey)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "request with this Idempotency-Key is being processed"})
+		return
+	}
+
+	var record idempotencyRecord
+	if err = json.Unmarshal(raw, &record); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "corrupted idempotency record"})
+		return
+	}
+
+	switch {
+	case record.Fingerprint != fingerprint:
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+	case record.Status == 0:
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "request with this Idempotency-Key is being processed"})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(record.Status, "application/json; charset=utf-8", record.Body)
+		c.Abort()
+	}
+}
+
+func requestFingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *memoryStore) SetNX(_ context.Context, key string, value []byte, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data[key]; ok {
+		return false, nil
+	}
+	m.data[key] = value
+	return true, nil
+}
+
+func (m *memoryStore) SetBytes(ctx context.Context, key string, value []byte, _ time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+func (m *memoryStore) GetBytes(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.data[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return value, nil
+}
+
+func (m *memoryStore) Del(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	calls := 0
+	router := gin.New()
+	router.POST("/deposit", func(c *gin.Context) {
+		c.Set("user_id", int64(1))
+	}, Idempotency(&memoryStore{data: map[string][]byte{}}, time.Hour), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/deposit", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send("key-1", `{"amount":10}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	// Повтор с тем же ключом возвращает сохранённый ответ
+	replayed := send("key-1", `{"amount":10}`)
+	assert.Equal(t, http.StatusOK, replayed.Code)
+	assert.Equal(t, first.Body.String(), replayed.Body.String())
+	assert.Equal(t, "true", replayed.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls)
+
+	// Тот же ключ с другим телом запроса
+	conflict := send("key-1", `{"amount":20}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, conflict.Code)
+
+	// Без ключа запрос выполняется каждый раз
+	send("", `{"amount":10}`)
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyFinalize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var (
+		store      = &memoryStore{data: map[string][]byte{}}
+		calls      = 0
+		disconnect context.CancelFunc
+	)
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST("/deposit", func(c *gin.Context) {
+		c.Set("user_id", int64(1))
+	}, Idempotency(store, time.Hour), func(c *gin.Context) {
+		calls++
+		switch c.GetHeader("X-Test") {
+		case "panic":
+			panic("handler failed")
+		case "disconnect":
+			disconnect()
+		}
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+
+	send := func(key, mode string) *httptest.ResponseRecorder {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		disconnect = cancel
+
+		req := httptest.NewRequest(http.MethodPost, "/deposit", strings.NewReader(`{"amount":10}`)).WithContext(ctx)
+		req.Header.Set(IdempotencyHeader, key)
+		req.Header.Set("X-Test", mode)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// После паники ключ освобождается, и повтор выполняется заново
+	assert.Equal(t, http.StatusInternalServerError, send("key-panic", "panic").Code)
+	assert.Equal(t, http.StatusOK, send("key-panic", "").Code)
+	assert.Equal(t, 2, calls)
+
+	// Ответ сохраняется, даже если клиент отключился
+	assert.Equal(t, http.StatusOK, send("key-gone", "disconnect").Code)
+	replayed := send("key-gone", "")
+	assert.Equal(t, http.StatusOK, replayed.Code)
+	assert.Equal(t, "true", replayed.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/ratelimit"
+)
+
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, rule config.RateLimitRule) (*ratelimit.Result, error)
+}
+
+// RateLimit returns a constructor of per-route limiting middlewares. Routes
+// sharing a name share the counters; a name without its own rule gets the
+// default limit. Requests are counted per user once JWTAuthMiddleware has
+// run, and per client IP before that. If the counters cannot be reached the
+// request is let through rather than taking the API down with them.
+func RateLimit(limiter RateLimiter, cfg config.RateLimit) func(route string) gin.HandlerFunc {
+	return func(route string) gin.HandlerFunc {
+		rule, ok := cfg.Routes[route]
+		if !ok {
+			rule = cfg.Limit
+		}
+
+		return func(c *gin.Context) {
+			result, err := limiter.Allow(c.Request.Context(), route+":"+rateLimitSubject(c), rule)
+			if err != nil {
+				_ = c.Error(err)
+				c.Next()
+				return
+			}
+			if result.Limit > 0 {
+				c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+				c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			}
+			if !result.Allowed {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+				return
+			}
+
+			c.Next()
+		}
+	}
+}
+
+func rateLimitSubject(c *gin.Context) string {
+	if userID, ok := c.Get("user_id"); ok {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	rateLimit := RateLimit(ratelimit.New(ratelimit.NewMemoryCounter()), config.RateLimit{
+		Limit: config.RateLimitRule{Requests: 3, Window: time.Hour},
+		Routes: map[string]config.RateLimitRule{
+			"exchange": {Requests: 1, Window: time.Hour},
+		},
+	})
+
+	router := gin.New()
+	api := router.Group("/", func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Set("user_id", user)
+		}
+	}, rateLimit("api"))
+	api.GET("/balance", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.POST("/exchange", rateLimit("exchange"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	call := func(method, path, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// у маршрута обмена свой, более строгий лимит
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/exchange", "1").Code)
+	w := call(http.MethodPost, "/exchange", "1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// общий лимит учёл оба запроса к обмену
+	w = call(http.MethodGet, "/balance", "1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, http.StatusTooManyRequests, call(http.MethodGet, "/balance", "1").Code)
+
+	// другой пользователь и анонимный клиент считаются отдельно
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/balance", "2").Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/balance", "").Code)
+}
@@ -0,0 +1,113 @@
+package quotes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrQuoteNotFound = errors.New("quote not found or expired")
+	ErrUnavailable   = errors.New("quote storage is unavailable")
+)
+
+// Storage keeps the quotes. GetDelBytes returns nil for a missing key.
+type Storage interface {
+	SetBytes(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	GetDelBytes(ctx context.Context, key string) ([]byte, error)
+}
+
+// Quote is an exchange offer with a locked rate: the user pays From and
+// receives To, which is Gross less Fee, if the quote is executed before
+// ExpiresAt.
+type Quote struct {
+	ID            string          `json:"id"`
+	UserID        int64           `json:"user_id"`
+	From          money.Money     `json:"from"`
+	Gross         money.Money     `json:"gross"`
+	Fee           money.Money     `json:"fee"`
+	To            money.Money     `json:"to"`
+	Rate          decimal.Decimal `json:"rate"`
+	EffectiveRate decimal.Decimal `json:"effective_rate"`
+	ExpiresAt     time.Time       `json:"expires_at"`
+}
+
+type Store struct {
+	storage Storage
+	ttl     time.Duration
+}
+
+func New(storage Storage, ttl time.Duration) *Store {
+	return &Store{
+		storage: storage,
+		ttl:     ttl,
+	}
+}
+
+// Create assigns the quote an id and an expiry and saves it.
+func (s *Store) Create(ctx context.Context, quote *Quote) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return errors.Wrap(err, "failed to generate quote id")
+	}
+	quote.ID = hex.EncodeToString(id)
+	quote.ExpiresAt = time.Now().Add(s.ttl)
+
+	return s.save(ctx, quote, s.ttl)
+}
+
+// Take removes the user's quote and returns it. A quote can be taken only
+// once, so concurrent executions of the same quote cannot both succeed; an
+// execution that fails gives the quote back with Restore.
+func (s *Store) Take(ctx context.Context, userid int64, id string) (*Quote, error) {
+	raw, err := s.storage.GetDelBytes(ctx, key(userid, id))
+	if err != nil {
+		return nil, errors.Wrap(ErrUnavailable, err.Error())
+	}
+	if raw == nil {
+		return nil, ErrQuoteNotFound
+	}
+
+	var quote Quote
+	if err = json.Unmarshal(raw, &quote); err != nil {
+		return nil, errors.Wrap(err, "failed to decode quote")
+	}
+	if time.Now().After(quote.ExpiresAt) {
+		return nil, ErrQuoteNotFound
+	}
+	return &quote, nil
+}
+
+// Restore saves a taken quote again for the rest of its lifetime, so it can
+// still be executed after a failed attempt. An expired quote stays gone.
+func (s *Store) Restore(ctx context.Context, quote *Quote) error {
+	left := time.Until(quote.ExpiresAt)
+	if left <= 0 {
+		return nil
+	}
+	return s.save(ctx, quote, left)
+}
+
+func (s *Store) save(ctx context.Context, quote *Quote, ttl time.Duration) error {
+	raw, err := json.Marshal(quote)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode quote")
+	}
+
+	err = s.storage.SetBytes(ctx, key(quote.UserID, quote.ID), raw, ttl)
+	if err != nil {
+		return errors.Wrap(err, "failed to save quote")
+	}
+	return nil
+}
+
+func key(userid int64, id string) string {
+	return fmt.Sprintf("quote:%d:%s", userid, id)
+}
@@ -0,0 +1,113 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryStorage struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	err  error
+}
+
+func (m *memoryStorage) SetBytes(_ context.Context, key string, value []byte, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+func (m *memoryStorage) GetDelBytes(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	value, ok := m.data[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(m.data, key)
+	return value, nil
+}
+
+func TestQuoteIsTakenOnce(t *testing.T) {
+	ctx := context.Background()
+	store := New(&memoryStorage{data: map[string][]byte{}}, time.Minute)
+
+	quote := &Quote{
+		UserID: 1,
+		From:   money.New(decimal.NewFromInt(100), "USD"),
+		To:     money.New(decimal.RequireFromString("92.5"), "EUR"),
+		Rate:   decimal.RequireFromString("0.925"),
+	}
+	err := store.Create(ctx, quote)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, quote.ID)
+
+	// Чужой пользователь не может исполнить котировку
+	_, err = store.Take(ctx, 2, quote.ID)
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+
+	taken, err := store.Take(ctx, 1, quote.ID)
+	assert.NoError(t, err)
+	assert.True(t, quote.To.Amount.Equal(taken.To.Amount))
+	assert.True(t, quote.Rate.Equal(taken.Rate))
+
+	_, err = store.Take(ctx, 1, quote.ID)
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+}
+
+func TestExpiredQuote(t *testing.T) {
+	ctx := context.Background()
+	store := New(&memoryStorage{data: map[string][]byte{}}, -time.Second)
+
+	quote := &Quote{UserID: 1, From: money.New(decimal.NewFromInt(1), "USD"), To: money.New(decimal.NewFromInt(1), "EUR"), Rate: decimal.NewFromInt(1)}
+	err := store.Create(ctx, quote)
+	assert.NoError(t, err)
+
+	_, err = store.Take(ctx, 1, quote.ID)
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	storage := &memoryStorage{data: map[string][]byte{}}
+	store := New(storage, time.Minute)
+
+	quote := &Quote{UserID: 1, From: money.New(decimal.NewFromInt(1), "USD"), To: money.New(decimal.NewFromInt(1), "EUR"), Rate: decimal.NewFromInt(1)}
+	err := store.Create(ctx, quote)
+	assert.NoError(t, err)
+
+	// Неудачный обмен возвращает котировку, её можно исполнить снова
+	taken, err := store.Take(ctx, 1, quote.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Restore(ctx, taken))
+	_, err = store.Take(ctx, 1, quote.ID)
+	assert.NoError(t, err)
+
+	// Истёкшая котировка не возвращается
+	taken.ExpiresAt = time.Now().Add(-time.Second)
+	assert.NoError(t, store.Restore(ctx, taken))
+	_, err = store.Take(ctx, 1, quote.ID)
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+}
+
+func TestStorageError(t *testing.T) {
+	ctx := context.Background()
+	storage := &memoryStorage{data: map[string][]byte{}, err: errors.New("connection refused")}
+	store := New(storage, time.Minute)
+
+	// Ошибка Redis — не «котировка не найдена»
+	_, err := store.Take(ctx, 1, "id")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.NotErrorIs(t, err, ErrQuoteNotFound)
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepEvery = 1024
+
+type memoryEntry struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// MemoryCounter keeps the counters in the process. Limits hold only within
+// one instance, which is enough for single-instance deployments and tests.
+type MemoryCounter struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	incrs   int
+	now     func() time.Time
+}
+
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{
+		entries: make(map[string]*memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryCounter) Incr(_ context.Context, key string, expiration time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.incrs++
+	if m.incrs%sweepEvery == 0 {
+		m.sweep(now)
+	}
+
+	entry, ok := m.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		entry = &memoryEntry{expiresAt: now.Add(expiration)}
+		m.entries[key] = entry
+	}
+	entry.count++
+	return entry.count, nil
+}
+
+func (m *MemoryCounter) GetInt64(_ context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok || !m.now().Before(entry.expiresAt) {
+		return 0, nil
+	}
+	return entry.count, nil
+}
+
+func (m *MemoryCounter) sweep(now time.Time) {
+	for key, entry := range m.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(m.entries, key)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/pkg/errors"
+)
+
+type Counter interface {
+	Incr(ctx context.Context, key string, expiration time.Duration) (int64, error)
+	GetInt64(ctx context.Context, key string) (int64, error)
+}
+
+// Result tells whether a request is allowed and, if not, when the client may
+// retry.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Limiter implements a sliding window: a request counts in the current fixed
+// window, and the previous window's count is weighted by the part of it
+// still covered by the sliding window. Two counters per key are enough, so
+// the counters can live in Redis and be shared by all replicas.
+type Limiter struct {
+	counter Counter
+	now     func() time.Time
+}
+
+func New(counter Counter) *Limiter {
+	return &Limiter{
+		counter: counter,
+		now:     time.Now,
+	}
+}
+
+// Allow counts the request under the key. A rule without requests does not
+// limit anything.
+func (l *Limiter) Allow(ctx context.Context, key string, rule config.RateLimitRule) (*Result, error) {
+	if rule.Requests <= 0 || rule.Window <= 0 {
+		return &Result{Allowed: true}, nil
+	}
+
+	now := l.now()
+	start := now.Truncate(rule.Window)
+	elapsed := now.Sub(start)
+
+	current, err := l.counter.Incr(ctx, windowKey(key, start), 2*rule.Window)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count request")
+	}
+	previous, err := l.counter.GetInt64(ctx, windowKey(key, start.Add(-rule.Window)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count request")
+	}
+
+	weight := 1 - float64(elapsed)/float64(rule.Window)
+	estimated := float64(previous)*weight + float64(current)
+	limit := float64(rule.Requests)
+
+	result := &Result{
+		Allowed:   estimated <= limit,
+		Limit:     rule.Requests,
+		Remaining: int(math.Max(0, math.Floor(limit-estimated))),
+	}
+	if result.Allowed {
+		return result, nil
+	}
+
+	// the wait until the previous window's share drops enough, or until the
+	// current window ends if its own count is already over the limit
+	result.RetryAfter = rule.Window - elapsed
+	if float64(current) < limit && previous > 0 {
+		share := 1 - (limit-float64(current))/float64(previous)
+		wait := time.Duration(share*float64(rule.Window)) - elapsed
+		if wait < result.RetryAfter {
+			result.RetryAfter = wait
+		}
+	}
+	if result.RetryAfter < time.Second {
+		result.RetryAfter = time.Second
+	}
+	return result, nil
+}
+
+func windowKey(key string, start time.Time) string {
+	return fmt.Sprintf("ratelimit:%s:%d", key, start.Unix())
+}
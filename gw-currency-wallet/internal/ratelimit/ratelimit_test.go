@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestLimiter(c *clock) *Limiter {
+	counter := NewMemoryCounter()
+	counter.now = c.Now
+	limiter := New(counter)
+	limiter.now = c.Now
+	return limiter
+}
+
+func TestSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := newTestLimiter(c)
+	rule := config.RateLimitRule{Requests: 4, Window: time.Minute}
+
+	for i := 0; i < 4; i++ {
+		result, err := limiter.Allow(ctx, "user:1", rule)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3-i, result.Remaining)
+	}
+
+	result, err := limiter.Allow(ctx, "user:1", rule)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Minute, result.RetryAfter)
+
+	// у другого ключа свой счётчик
+	result, err = limiter.Allow(ctx, "user:2", rule)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// в начале следующего окна предыдущее учитывается почти целиком
+	c.now = c.now.Add(time.Minute + 15*time.Second)
+	result, err = limiter.Allow(ctx, "user:1", rule)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	// 5 запросов прошлого окна * 0.75 + 1 > 4; ждать, пока доля прошлого окна не упадёт до 3/5
+	assert.Equal(t, 9*time.Second, result.RetryAfter)
+
+	c.now = c.now.Add(30 * time.Second)
+	result, err = limiter.Allow(ctx, "user:1", rule)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
+
+func TestNoLimit(t *testing.T) {
+	limiter := newTestLimiter(&clock{now: time.Now()})
+
+	for i := 0; i < 10; i++ {
+		result, err := limiter.Allow(context.Background(), "ip:10.0.0.1", config.RateLimitRule{})
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+}
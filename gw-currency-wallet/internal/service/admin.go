@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/mappers"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+)
+
+const defaultAdminListLimit = 20
+
+// Every admin method records what the actor did. Reads are recorded before
+// the data is returned and changes in the same transaction as the change,
+// so nothing is done without a trace.
+
+func (ws *WalletService) AdminFindUsers(ctx context.Context, actorID int64, req *domain.AdminUsersRequest) ([]*domain.AdminUserResponse, error) {
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultAdminListLimit
+	}
+
+	err := ws.repo.RecordAudit(ctx, &store.AuditEntry{
+		ActorID: actorID,
+		Action:  store.AuditUserSearch,
+		Details: map[string]string{"query": req.Query},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := ws.repo.FindUsers(ctx, req.Query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return mappers.ToDomainAdminUsers(users), nil
+}
+
+func (ws *WalletService) AdminGetUser(ctx context.Context, actorID, userid int64) (*domain.AdminUserResponse, error) {
+	err := ws.repo.RecordAudit(ctx, auditEntry(actorID, store.AuditUserView, userid, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := ws.repo.GetUser(ctx, userid)
+	if err != nil {
+		return nil, err
+	}
+	return mappers.ToDomainAdminUser(user), nil
+}
+
+func (ws *WalletService) AdminGetBalance(ctx context.Context, actorID, userid, walletID int64) ([]*domain.BalanceResponse, error) {
+	err := ws.repo.RecordAudit(ctx, auditEntry(actorID, store.AuditUserBalance, userid, nil))
+	if err != nil {
+		return nil, err
+	}
+	return ws.GetBalance(ctx, userid, walletID)
+}
+
+func (ws *WalletService) AdminTransactions(ctx context.Context, actorID, userid int64, req *domain.TransactionsRequest) (*domain.TransactionsResponse, error) {
+	err := ws.repo.RecordAudit(ctx, auditEntry(actorID, store.AuditUserTransactions, userid, nil))
+	if err != nil {
+		return nil, err
+	}
+	return ws.Transactions(ctx, userid, req)
+}
+
+// FreezeUser stops the user from logging in, refreshing tokens and moving
+// money. Access tokens already issued keep authenticating until they
+// expire, but every operation checks the account.
+func (ws *WalletService) FreezeUser(ctx context.Context, actorID, userid int64, req *domain.AdminActionRequest) error {
+	if actorID == userid {
+		return domain.ErrOwnAccount
+	}
+	return ws.repo.FreezeUser(ctx, userid, auditEntry(actorID, store.AuditUserFreeze, userid, map[string]string{"reason": req.Reason}))
+}
+
+func (ws *WalletService) UnfreezeUser(ctx context.Context, actorID, userid int64, req *domain.AdminActionRequest) error {
+	return ws.repo.UnfreezeUser(ctx, userid, auditEntry(actorID, store.AuditUserUnfreeze, userid, map[string]string{"reason": req.Reason}))
+}
+
+// SetUserRole changes the role; it reaches the user's tokens at the next
+// login, as the user's refresh tokens are revoked.
+func (ws *WalletService) SetUserRole(ctx context.Context, actorID, userid int64, req *domain.SetRoleRequest) error {
+	if actorID == userid {
+		return domain.ErrOwnAccount
+	}
+	details := map[string]string{"role": req.Role, "reason": req.Reason}
+	return ws.repo.SetUserRole(ctx, userid, req.Role, auditEntry(actorID, store.AuditUserRole, userid, details))
+}
+
+// SetWalletStatus freezes, unfreezes or closes one of the user's wallets,
+// the primary one unless the request names another. The status is checked
+// by the repository inside every balance change.
+func (ws *WalletService) SetWalletStatus(ctx context.Context, actorID, userid int64, req *domain.WalletStatusRequest) error {
+	if actorID == userid {
+		return domain.ErrOwnAccount
+	}
+	details := map[string]string{"status": req.Status, "reason": req.Reason}
+	return ws.repo.SetWalletStatus(ctx, userid, req.WalletID, req.Status, auditEntry(actorID, store.AuditWalletStatus, userid, details))
+}
+
+// UnlockUser lifts the login lockout of the user.
+func (ws *WalletService) UnlockUser(ctx context.Context, actorID, userid int64) error {
+	user, err := ws.repo.GetUser(ctx, userid)
+	if err != nil {
+		return err
+	}
+
+	err = ws.repo.RecordAudit(ctx, auditEntry(actorID, store.AuditUserUnlock, userid, nil))
+	if err != nil {
+		return err
+	}
+	return ws.loginGuard.Unlock(ctx, user.Username)
+}
+
+func (ws *WalletService) AuditLog(ctx context.Context, actorID int64, req *domain.AuditLogRequest) (*domain.AuditLogResponse, error) {
+	filter, err := mappers.ToStoreAuditFilter(req)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAdminListLimit
+	}
+	limit := filter.Limit
+
+	// one extra row tells whether there is a next page
+	filter.Limit++
+
+	var details map[string]string
+	if req.UserID != 0 {
+		details = map[string]string{"user_id": strconv.FormatInt(req.UserID, 10)}
+	}
+	err = ws.repo.RecordAudit(ctx, &store.AuditEntry{ActorID: actorID, Action: store.AuditLogView, Details: details})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ws.repo.GetAuditLog(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return mappers.ToDomainAuditLog(entries, limit), nil
+}
+
+func auditEntry(actorID int64, action string, userid int64, details map[string]string) *store.AuditEntry {
+	return &store.AuditEntry{
+		ActorID:      actorID,
+		Action:       action,
+		TargetUserID: &userid,
+		Details:      details,
+	}
+}
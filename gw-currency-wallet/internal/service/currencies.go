@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/mappers"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+)
+
+// Currencies returns the enabled currencies of the catalogue.
+func (ws *WalletService) Currencies(ctx context.Context) ([]*domain.CurrencyResponse, error) {
+	enabled, err := ws.currencies.Enabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mappers.ToDomainCurrencies(enabled), nil
+}
+
+// SetCurrency adds a currency to the catalogue or changes an existing one.
+// Wallets get a balance in a newly enabled currency with their first credit
+// in it. Only currencies the rate provider publishes can be enabled.
+func (ws *WalletService) SetCurrency(ctx context.Context, actorID int64, code string, req *domain.SetCurrencyRequest) error {
+	currency, err := mappers.ToStoreCurrency(code, req)
+	if err != nil {
+		return err
+	}
+	if currency.Enabled {
+		if err := ws.currencies.Quoted(ctx, currency.Code); err != nil {
+			return err
+		}
+	}
+
+	err = ws.repo.SetCurrency(ctx, currency, &store.AuditEntry{
+		ActorID: actorID,
+		Action:  store.AuditCurrencySet,
+		Details: map[string]string{
+			"code":        currency.Code,
+			"name":        currency.Name,
+			"minor_units": strconv.Itoa(int(currency.MinorUnits)),
+			"enabled":     strconv.FormatBool(currency.Enabled),
+			"reason":      req.Reason,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	ws.currencies.Invalidate()
+	return nil
+}
+
+// checkMoney validates an amount against the catalogue: the currency has to
+// be known, enabled if funds come into it, and the amount has to fit its
+// minor units.
+func (ws *WalletService) checkMoney(ctx context.Context, amount money.Money, incoming bool) error {
+	if err := ws.currencies.Check(ctx, amount.Currency, incoming); err != nil {
+		return err
+	}
+	return amount.Validate()
+}
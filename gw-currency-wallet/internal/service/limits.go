@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/mappers"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/shopspring/decimal"
+)
+
+// Limits returns how much the user may still withdraw and exchange. The
+// repository checks the same limits again inside the operation.
+func (ws *WalletService) Limits(ctx context.Context, userid int64) ([]*domain.LimitResponse, error) {
+	overrides, err := ws.repo.GetUserLimits(ctx, userid)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := ws.repo.GetLimitUsage(ctx, userid)
+	if err != nil {
+		return nil, err
+	}
+	return mappers.ToDomainLimits(ws.limits.Limits(overrides), usage), nil
+}
+
+// SetUserLimit gives the user a limit of their own, or removes it.
+func (ws *WalletService) SetUserLimit(ctx context.Context, actorID, userid int64, req *domain.SetLimitRequest) error {
+	if actorID == userid {
+		return domain.ErrOwnAccount
+	}
+
+	// the catalogue is loaded first, the amounts are checked against the
+	// currency's minor units
+	err := ws.currencies.Check(ctx, strings.ToUpper(req.Currency), false)
+	if err != nil {
+		return err
+	}
+
+	limit, err := mappers.ToStoreLimit(req)
+	if err != nil {
+		return err
+	}
+
+	details := map[string]string{
+		"operation": limit.Operation,
+		"currency":  limit.Currency,
+		"daily":     limitAmount(limit.Daily),
+		"monthly":   limitAmount(limit.Monthly),
+		"reason":    req.Reason,
+	}
+	return ws.repo.SetUserLimit(ctx, userid, limit, auditEntry(actorID, store.AuditUserLimits, userid, details))
+}
+
+// limitFor returns the limit the operation is checked against, nil if there
+// is none.
+func (ws *WalletService) limitFor(ctx context.Context, userid int64, operation, currency string) (*store.Limit, error) {
+	overrides, err := ws.repo.GetUserLimits(ctx, userid)
+	if err != nil {
+		return nil, err
+	}
+	return ws.limits.Limit(operation, currency, overrides), nil
+}
+
+func limitAmount(amount decimal.NullDecimal) string {
+	if !amount.Valid {
+		return "default"
+	}
+	return amount.Decimal.String()
+}
@@ -4,38 +4,98 @@ import (
 	"context"
 	"time"
 
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/currencies"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/mappers"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/quotes"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
 	jwttoken "github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/jwtToken"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 )
 
 func (ws *WalletService) RegisterUser(ctx context.Context, user *domain.RegisterRequest) error {
+	err := ws.validator.Validate(user)
+	if err != nil {
+		return err
+	}
+
 	storeUser, err := mappers.ToStoreUserFromRegister(user)
 	if err != nil {
 		return err
 	}
 
-	return ws.repo.CreateUser(ctx, storeUser)
+	err = ws.repo.CreateUser(ctx, storeUser)
+	if err != nil {
+		return err
+	}
+
+	err = ws.sendVerification(ctx, storeUser.ID, storeUser.Email)
+	if err != nil {
+		return errors.Wrap(domain.ErrVerificationNotSent, err.Error())
+	}
+	return nil
 }
 
-func (ws *WalletService) LoginUser(ctx context.Context, user *domain.AuthorizationRequest) (*domain.TokenResponse, error) {
+// LoginUser checks the password. Users with two-factor authentication get
+// an MFA token to finish the login with a code instead of the tokens.
+func (ws *WalletService) LoginUser(ctx context.Context, user *domain.AuthorizationRequest, client *domain.Client) (*domain.LoginResponse, error) {
 	storeUser, err := mappers.ToStoreUserFromAuthorize(user)
 	if err != nil {
 		return nil, err
 	}
 	var id int64
 
+	err = ws.loginGuard.Check(ctx, user.Username, client.IP)
+	if err != nil {
+		return nil, err
+	}
+
 	id, err = ws.repo.Authentication(ctx, storeUser)
+	if errors.Is(err, store.ErrInvalidCredentials) {
+		if guardErr := ws.loginGuard.Fail(ctx, user.Username, client.IP); guardErr != nil {
+			return nil, guardErr
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = ws.loginGuard.Succeed(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := ws.activeUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := ws.enabledMFA(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if mfa != nil {
+		return ws.mfaChallenge(id)
+	}
+
+	tokens, err := ws.issueTokens(ctx, account, client)
 	if err != nil {
 		return nil, err
 	}
-	access, refresh, err := ws.generateTokens(id)
+	return &domain.LoginResponse{
+		Access:  tokens.Access,
+		Refresh: tokens.Refresh,
+	}, nil
+}
+
+func (ws *WalletService) issueTokens(ctx context.Context, user *store.User, client *domain.Client) (*domain.TokenResponse, error) {
+	access, refresh, err := ws.generateTokens(user)
 	if err != nil {
 		return nil, err
 	}
-	err = ws.storeRefreshToken(ctx, id, refresh)
+	err = ws.repo.SetToken(ctx, ws.newRefreshToken(user.ID, refresh, client))
 	if err != nil {
 		return nil, err
 	}
@@ -45,13 +105,16 @@ func (ws *WalletService) LoginUser(ctx context.Context, user *domain.Authorizati
 	}, nil
 }
 
-func (ws *WalletService) generateTokens(userid int64) (string, string, error) {
+func (ws *WalletService) generateTokens(user *store.User) (string, string, error) {
 	tokenOpts := &jwttoken.TokensOption{
-		UserID:        userid,
-		AccessExp:     ws.optsJWT.AccessExpiresTime,
-		RefreshExp:    ws.optsJWT.RefreshExpiresTime,
-		SecretAccess:  ws.optsJWT.AccessSecret,
-		SecretRefresh: ws.optsJWT.RefreshSecret,
+		UserID:      user.ID,
+		Role:        user.Role,
+		AccessExp:   ws.optsJWT.AccessExpiresTime,
+		RefreshExp:  ws.optsJWT.RefreshExpiresTime,
+		Issuer:      ws.optsJWT.Issuer,
+		Audience:    ws.optsJWT.Audience,
+		AccessKeys:  ws.accessKeys,
+		RefreshKeys: ws.refreshKeys,
 	}
 
 	access, refresh, err := jwttoken.GenerateTokens(tokenOpts)
@@ -61,19 +124,27 @@ func (ws *WalletService) generateTokens(userid int64) (string, string, error) {
 	return access, refresh, nil
 }
 
-func (ws *WalletService) storeRefreshToken(ctx context.Context, userid int64, tokenHash string) error {
-	refreshToken := &store.RefreshToken{
-		Hash:      tokenHash,
+func (ws *WalletService) expected(typ string) jwttoken.Expected {
+	return jwttoken.Expected{
+		Type:     typ,
+		Issuer:   ws.optsJWT.Issuer,
+		Audience: ws.optsJWT.Audience,
+	}
+}
+
+func (ws *WalletService) newRefreshToken(userid int64, token string, client *domain.Client) *store.RefreshToken {
+	return &store.RefreshToken{
+		Token:     token,
 		UserID:    userid,
 		ExpiresAt: time.Now().Add(ws.optsJWT.RefreshExpiresTime),
 		Revoked:   false,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
 	}
-
-	return ws.repo.SetToken(ctx, refreshToken)
 }
 
-func (ws *WalletService) GetBalance(ctx context.Context, userid int64) ([]*domain.BalanceResponse, error) {
-	balance, err := ws.repo.GetBalance(ctx, userid)
+func (ws *WalletService) GetBalance(ctx context.Context, userid, walletID int64) ([]*domain.BalanceResponse, error) {
+	balance, err := ws.repo.GetBalance(ctx, userid, walletID)
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +152,14 @@ func (ws *WalletService) GetBalance(ctx context.Context, userid int64) ([]*domai
 }
 
 func (ws *WalletService) Deposit(ctx context.Context, userid int64, req *domain.DepositRequest) ([]*domain.BalanceResponse, error) {
+	if err := ws.checkMoney(ctx, req.Money, true); err != nil {
+		return nil, err
+	}
+
+	if err := ws.requireActiveUser(ctx, userid, false); err != nil {
+		return nil, err
+	}
+
 	depositInStore := mappers.ToStoreDepositBalance(userid, req)
 
 	err := ws.repo.UpdateBalance(ctx, depositInStore)
@@ -88,7 +167,7 @@ func (ws *WalletService) Deposit(ctx context.Context, userid int64, req *domain.
 		return nil, err
 	}
 
-	newBalance, err := ws.repo.GetBalance(ctx, userid)
+	newBalance, err := ws.repo.GetBalance(ctx, userid, req.WalletID)
 	if err != nil {
 		return nil, err
 	}
@@ -96,41 +175,54 @@ func (ws *WalletService) Deposit(ctx context.Context, userid int64, req *domain.
 }
 
 func (ws *WalletService) Withdraw(ctx context.Context, userid int64, req *domain.WithdrawRequest) ([]*domain.BalanceResponse, error) {
-	isEnough, err := ws.isBalanceEnough(ctx, userid, req.Currency, req.Amount)
-	if err != nil {
+	if err := ws.checkMoney(ctx, req.Money, false); err != nil {
 		return nil, err
 	}
-	if !isEnough {
-		return nil, errors.New("Insufficient funds")
+	if err := ws.requireActiveUser(ctx, userid, true); err != nil {
+		return nil, err
+	}
+	if err := ws.requireOutgoingMFA(ctx, userid, req.Money, req.MFACode); err != nil {
+		return nil, err
 	}
 
 	withdrawInStore := mappers.ToStoreWithdrawBalance(userid, req)
 
+	limit, err := ws.limitFor(ctx, userid, store.OperationWithdraw, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	withdrawInStore.Limit = limit
+
 	err = ws.repo.UpdateBalance(ctx, withdrawInStore)
 	if err != nil {
 		return nil, err
 	}
 
-	newBalance, err := ws.repo.GetBalance(ctx, userid)
+	newBalance, err := ws.repo.GetBalance(ctx, userid, req.WalletID)
 	if err != nil {
 		return nil, err
 	}
 	return mappers.ToDomainBalance(newBalance), nil
 }
 
-func (ws *WalletService) isBalanceEnough(ctx context.Context, userid int64, currencyCode string, amount float64) (bool, error) {
-	getCurrencyReq := &store.CurrencyRequest{
-		CurrencyCode: currencyCode,
-		UserID:       userid,
-	}
-	currency, err := ws.repo.GetSpecificCurrency(ctx, getCurrencyReq)
+func (ws *WalletService) Transactions(ctx context.Context, userid int64, req *domain.TransactionsRequest) (*domain.TransactionsResponse, error) {
+	filter, err := mappers.ToStoreTransactionFilter(userid, req)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	if currency.Balance < amount {
-		return false, nil
+	if filter.Limit == 0 {
+		filter.Limit = defaultTransactionsLimit
+	}
+	limit := filter.Limit
+
+	// one extra row tells whether there is a next page
+	filter.Limit++
+
+	transactions, err := ws.repo.GetTransactions(ctx, filter)
+	if err != nil {
+		return nil, err
 	}
-	return true, nil
+	return mappers.ToDomainTransactions(transactions, limit), nil
 }
 
 func (ws *WalletService) ExchangeRates(ctx context.Context) ([]*domain.RateResponse, error) {
@@ -142,89 +234,317 @@ func (ws *WalletService) ExchangeRates(ctx context.Context) ([]*domain.RateRespo
 	return response, nil
 }
 
-func (ws *WalletService) Exchange(ctx context.Context, userid int64, req *domain.ExchangeRequest) (*domain.ExchangeResponse, error) {
-	isEnough, err := ws.isBalanceEnough(ctx, userid, req.BaseCurrency, req.Amount)
+func (ws *WalletService) ExchangeQuote(ctx context.Context, userid int64, req *domain.ExchangeQuoteRequest) (*domain.ExchangeQuoteResponse, error) {
+	quote, err := ws.quote(ctx, money.New(req.Amount, req.BaseCurrency), req.TargetCurrency)
 	if err != nil {
 		return nil, err
 	}
-	if !isEnough {
-		return nil, errors.New("Insufficient funds")
-	}
+	quote.UserID = userid
 
-	baseCurrencyRate, err := ws.exchanger.GetExchangeRate(ctx, req.BaseCurrency)
+	err = ws.quotes.Create(ctx, quote)
 	if err != nil {
 		return nil, err
 	}
 
-	targetCurrencyRate, err := ws.exchanger.GetExchangeRate(ctx, req.TargetCurrency)
-	if err != nil {
+	return &domain.ExchangeQuoteResponse{
+		QuoteID:        quote.ID,
+		BaseCurrency:   quote.From.Currency,
+		TargetCurrency: quote.To.Currency,
+		Amount:         quote.From.Amount,
+		GrossAmount:    quote.Gross.Amount,
+		Fee:            quote.Fee.Amount,
+		ExchangeAmount: quote.To.Amount,
+		Rate:           quote.Rate,
+		EffectiveRate:  quote.EffectiveRate,
+		ExpiresAt:      quote.ExpiresAt,
+	}, nil
+}
+
+// Exchange executes the quote given by its id, or prices the exchange at the
+// current rate when no quote is passed.
+func (ws *WalletService) Exchange(ctx context.Context, userid int64, req *domain.ExchangeRequest) (*domain.ExchangeResponse, error) {
+	var (
+		quote *quotes.Quote
+		err   error
+	)
+	if err = ws.requireActiveUser(ctx, userid, true); err != nil {
 		return nil, err
 	}
-
-	valueTpDeposit := ws.convertCurrency(req.Amount, baseCurrencyRate.Value, targetCurrencyRate.Value)
-
-	err = ws.makeTransfer(ctx, req.BaseCurrency, req.TargetCurrency, req.Amount, valueTpDeposit, userid)
+	if req.QuoteID != "" {
+		quote, err = ws.quotes.Take(ctx, userid, req.QuoteID)
+		if err == nil {
+			// the target may have been disabled since the quote was given
+			err = ws.currencies.Check(ctx, quote.To.Currency, true)
+			if err == nil {
+				err = ws.makeTransfer(ctx, quote, userid, req.WalletID)
+			}
+			// a refused exchange can be retried with the quote until it
+			// expires; after any other error, a failed commit among them,
+			// the exchange may have gone through and the quote stays used
+			if refusedBeforeCommit(err) {
+				_ = ws.quotes.Restore(context.WithoutCancel(ctx), quote)
+			}
+		}
+	} else {
+		quote, err = ws.quote(ctx, money.New(req.Amount, req.BaseCurrency), req.TargetCurrency)
+		if err == nil {
+			err = ws.makeTransfer(ctx, quote, userid, req.WalletID)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
-	newBalance, err := ws.repo.GetBalance(ctx, userid)
+	newBalance, err := ws.repo.GetBalance(ctx, userid, req.WalletID)
 	if err != nil {
 		return nil, err
 	}
 
 	return &domain.ExchangeResponse{
 		Message:        "Exchange successful",
-		ExchangeAmount: valueTpDeposit,
+		GrossAmount:    quote.Gross.Amount,
+		Fee:            quote.Fee.Amount,
+		ExchangeAmount: quote.To.Amount,
+		Rate:           quote.Rate,
+		EffectiveRate:  quote.EffectiveRate,
 		NewBalance:     mappers.ToDomainBalance(newBalance),
 	}, nil
 }
 
-func (ws *WalletService) convertCurrency(amount float64, rateFrom float64, rateTo float64) float64 {
-	return amount * (rateTo / rateFrom)
+func (ws *WalletService) quote(ctx context.Context, amount money.Money, target string) (*quotes.Quote, error) {
+	if err := ws.checkMoney(ctx, amount, false); err != nil {
+		return nil, err
+	}
+	if err := ws.currencies.Check(ctx, target, true); err != nil {
+		return nil, err
+	}
+
+	baseCurrencyRate, err := ws.exchanger.GetExchangeRate(ctx, amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	targetCurrencyRate, err := ws.exchanger.GetExchangeRate(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	charge, err := ws.fees.Charge(amount, money.Rate(baseCurrencyRate.Value, targetCurrencyRate.Value), target)
+	if err != nil {
+		return nil, err
+	}
+
+	return &quotes.Quote{
+		From:          amount,
+		Gross:         charge.Gross,
+		Fee:           charge.Fee,
+		To:            charge.Net,
+		Rate:          charge.Rate,
+		EffectiveRate: charge.EffectiveRate,
+	}, nil
+}
+
+// refusedBeforeCommit reports the errors an exchange is refused with before
+// anything is written.
+func refusedBeforeCommit(err error) bool {
+	for _, refused := range []error{
+		store.ErrInsufficientFunds, store.ErrLimitExceeded, store.ErrWalletNotFound,
+		store.ErrWalletFrozen, store.ErrWalletClosed, store.ErrAccountFrozen,
+		currencies.ErrDisabled, currencies.ErrUnsupported,
+	} {
+		if errors.Is(err, refused) {
+			return true
+		}
+	}
+	return false
 }
 
-func (ws *WalletService) makeTransfer(ctx context.Context,
-	fromCurrencyCode, toCurrencyCode string, amountFrom, amountTo float64, userid int64,
-) error {
+func (ws *WalletService) makeTransfer(ctx context.Context, quote *quotes.Quote, userid, walletID int64) error {
+	limit, err := ws.limitFor(ctx, userid, store.OperationExchange, quote.From.Currency)
+	if err != nil {
+		return err
+	}
+
 	storeExchangeReq := &store.ExchangeBalance{
 		UserID:       userid,
-		FromCurrency: fromCurrencyCode,
-		ToCurrency:   toCurrencyCode,
-		ToAmount:     amountTo,
-		FromAmount:   amountFrom,
+		WalletID:     walletID,
+		FromCurrency: quote.From.Currency,
+		ToCurrency:   quote.To.Currency,
+		ToAmount:     quote.To.Amount,
+		FromAmount:   quote.From.Amount,
+		Fee:          quote.Fee.Amount,
+		Rate:         quote.Rate,
+		Limit:        limit,
 	}
 
 	return ws.repo.ExchangeCurrency(ctx, storeExchangeReq)
 }
 
-func (ws *WalletService) Refresh(ctx context.Context, req *domain.RefreshRequest) (*domain.TokenResponse, error) {
-	err := jwttoken.Validate(req.TokenHash, []byte(ws.optsJWT.RefreshSecret))
+func (ws *WalletService) Transfer(ctx context.Context, userid int64, req *domain.TransferRequest) (*domain.TransferResponse, error) {
+	if err := ws.checkMoney(ctx, req.Money, false); err != nil {
+		return nil, err
+	}
+	target := req.TargetCurrency
+	if target == "" {
+		target = req.Currency
+	}
+	if err := ws.currencies.Check(ctx, target, true); err != nil {
+		return nil, err
+	}
+	if err := ws.requireActiveUser(ctx, userid, true); err != nil {
+		return nil, err
+	}
+	if err := ws.requireOutgoingMFA(ctx, userid, req.Money, req.MFACode); err != nil {
+		return nil, err
+	}
+
+	var (
+		received = req.Money
+		rate     decimal.NullDecimal
+		fee      decimal.NullDecimal
+	)
+	// a converted transfer is priced like an exchange, spread and fee
+	// included, so it is no cheaper way to change currency
+	if req.TargetCurrency != "" && req.TargetCurrency != req.Currency {
+		baseCurrencyRate, err := ws.exchanger.GetExchangeRate(ctx, req.Currency)
+		if err != nil {
+			return nil, err
+		}
+
+		targetCurrencyRate, err := ws.exchanger.GetExchangeRate(ctx, req.TargetCurrency)
+		if err != nil {
+			return nil, err
+		}
+
+		charge, err := ws.fees.Charge(req.Money, money.Rate(baseCurrencyRate.Value, targetCurrencyRate.Value), req.TargetCurrency)
+		if err != nil {
+			return nil, err
+		}
+		received = charge.Net
+		rate = decimal.NewNullDecimal(charge.Rate)
+		if charge.Fee.Amount.IsPositive() {
+			fee = decimal.NewNullDecimal(charge.Fee.Amount)
+		}
+	}
+
+	transfer := mappers.ToStoreTransfer(userid, req, received, rate, fee)
+
+	limit, err := ws.limitFor(ctx, userid, store.OperationWithdraw, req.Currency)
 	if err != nil {
-		return nil, errors.Wrap(err, "The time of existence has expired. You need to log in again")
+		return nil, err
 	}
+	transfer.Limit = limit
 
-	userID, err := jwttoken.GetUserID(req.TokenHash, []byte(ws.optsJWT.RefreshSecret))
+	err = ws.repo.Transfer(ctx, transfer)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get user id")
+		return nil, err
 	}
 
-	tokenToCheck := &store.RefreshToken{
-		Hash:   req.TokenHash,
-		UserID: userID,
+	newBalance, err := ws.repo.GetBalance(ctx, userid, req.WalletID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &domain.TransferResponse{
+		Message:          "Transfer successful",
+		Recipient:        req.Recipient,
+		ReceivedAmount:   received.Amount,
+		ReceivedCurrency: received.Currency,
+		NewBalance:       mappers.ToDomainBalance(newBalance),
+	}
+	if rate.Valid {
+		response.Rate = &rate.Decimal
+	}
+	if fee.Valid {
+		response.Fee = &fee.Decimal
 	}
+	return response, nil
+}
 
-	err = ws.repo.CheckRefreshToken(ctx, tokenToCheck)
+func (ws *WalletService) Refresh(ctx context.Context, req *domain.RefreshRequest, client *domain.Client) (*domain.TokenResponse, error) {
+	claims, err := jwttoken.Parse(req.TokenHash, ws.refreshKeys, ws.expected(jwttoken.TypeRefresh))
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid refresh token")
+		return nil, errors.Wrap(err, "The time of existence has expired. You need to log in again")
+	}
+	userID := claims.UserID
+
+	// the role and the account state are read again, a refresh must not
+	// keep a demoted or frozen user going
+	user, err := ws.activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	access, _, err := ws.generateTokens(userID)
+	access, refresh, err := ws.generateTokens(user)
 	if err != nil {
 		return nil, err
 	}
 
+	// the presented token is exchanged for a new one, so a leaked token
+	// stops working after the owner's next refresh
+	err = ws.repo.RotateRefreshToken(ctx,
+		&store.RefreshToken{
+			Token:  req.TokenHash,
+			UserID: userID,
+		},
+		ws.newRefreshToken(userID, refresh, client))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid refresh token")
+	}
+
 	return &domain.TokenResponse{
 		Access:  access,
-		Refresh: req.TokenHash,
+		Refresh: refresh,
 	}, nil
 }
+
+func (ws *WalletService) Logout(ctx context.Context, req *domain.RefreshRequest, accessToken string) error {
+	userID, err := jwttoken.GetUserID(req.TokenHash, ws.refreshKeys, ws.expected(jwttoken.TypeRefresh))
+	if err != nil {
+		return errors.Wrap(err, "failed to get user id")
+	}
+
+	err = ws.repo.RevokeRefreshToken(ctx, &store.RefreshToken{
+		Token:  req.TokenHash,
+		UserID: userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	// an expired or foreign access token has nothing left to revoke
+	if accessToken == "" {
+		return nil
+	}
+	claims, err := jwttoken.Parse(accessToken, ws.accessKeys, ws.expected(jwttoken.TypeAccess))
+	if err != nil || claims.UserID != userID {
+		return nil
+	}
+	return ws.denylist.Add(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// JWKS returns the public keys access tokens are verified with.
+func (ws *WalletService) JWKS() *jwttoken.JWKS {
+	return ws.accessKeys.JWKS()
+}
+
+// LogoutAll revokes every refresh token of the user and denylists the
+// access token of the request; other access tokens live until they expire.
+func (ws *WalletService) LogoutAll(ctx context.Context, userid int64, access *domain.AccessToken) error {
+	err := ws.repo.RevokeUserTokens(ctx, userid)
+	if err != nil {
+		return err
+	}
+	return ws.denylist.Add(ctx, access.ID, access.ExpiresAt)
+}
+
+func (ws *WalletService) Sessions(ctx context.Context, userid int64) ([]*domain.SessionResponse, error) {
+	sessions, err := ws.repo.GetSessions(ctx, userid)
+	if err != nil {
+		return nil, err
+	}
+	return mappers.ToDomainSessions(sessions), nil
+}
+
+func (ws *WalletService) RevokeSession(ctx context.Context, userid, sessionID int64) error {
+	return ws.repo.RevokeSession(ctx, userid, sessionID)
+}
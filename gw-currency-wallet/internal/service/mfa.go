@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	jwttoken "github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/jwtToken"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/totp"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const recoveryCodesCount = 10
+
+// EnrollMFA generates a new secret for the user. Two-factor authentication
+// is enabled only after the secret is confirmed with a code.
+func (ws *WalletService) EnrollMFA(ctx context.Context, userid int64) (*domain.MFAEnrollResponse, error) {
+	user, err := ws.repo.GetUser(ctx, userid)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ws.repo.SetMFASecret(ctx, userid, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.MFAEnrollResponse{
+		Secret: secret,
+		URI:    totp.URI(ws.mfa.OTPIssuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmMFA enables two-factor authentication if the code matches the
+// enrolled secret and returns the recovery codes, which are shown only once.
+func (ws *WalletService) ConfirmMFA(ctx context.Context, userid int64, req *domain.MFACodeRequest) (*domain.RecoveryCodesResponse, error) {
+	mfa, err := ws.repo.GetMFA(ctx, userid)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.EnabledAt != nil {
+		return nil, store.ErrMFAAlreadyEnabled
+	}
+
+	step, ok := totp.Match(mfa.Secret, req.Code, time.Now())
+	if !ok {
+		return nil, store.ErrInvalidMFACode
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ws.repo.EnableMFA(ctx, userid, step, normalizeRecoveryCodes(codes))
+	if err != nil {
+		return nil, err
+	}
+	return &domain.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableMFA turns two-factor authentication off; it takes a TOTP code or a
+// recovery code.
+func (ws *WalletService) DisableMFA(ctx context.Context, userid int64, req *domain.MFACodeRequest) error {
+	mfa, err := ws.enabledMFA(ctx, userid)
+	if err != nil {
+		return err
+	}
+	if mfa == nil {
+		return store.ErrMFANotEnabled
+	}
+
+	err = ws.verifyMFACode(ctx, mfa, req.Code, true)
+	if err != nil {
+		return err
+	}
+	return ws.repo.DisableMFA(ctx, userid)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user; it takes
+// a TOTP code.
+func (ws *WalletService) RegenerateRecoveryCodes(ctx context.Context, userid int64, req *domain.MFACodeRequest) (*domain.RecoveryCodesResponse, error) {
+	mfa, err := ws.enabledMFA(ctx, userid)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, store.ErrMFANotEnabled
+	}
+
+	err = ws.verifyMFACode(ctx, mfa, req.Code, false)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = ws.repo.ReplaceRecoveryCodes(ctx, userid, normalizeRecoveryCodes(codes))
+	if err != nil {
+		return nil, err
+	}
+	return &domain.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// LoginMFA finishes a login started with the password. Wrong codes count as
+// failed logins of the username, and an MFA token works only once.
+func (ws *WalletService) LoginMFA(ctx context.Context, req *domain.MFALoginRequest, client *domain.Client) (*domain.TokenResponse, error) {
+	claims, err := jwttoken.Parse(req.MFAToken, ws.refreshKeys, ws.expected(jwttoken.TypeMFA))
+	if err != nil {
+		return nil, errors.Wrap(domain.ErrInvalidMFAToken, err.Error())
+	}
+
+	used, err := ws.denylist.Contains(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if used {
+		return nil, domain.ErrInvalidMFAToken
+	}
+
+	user, err := ws.activeUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ws.loginGuard.Check(ctx, user.Username, client.IP)
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := ws.enabledMFA(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa == nil {
+		return nil, domain.ErrInvalidMFAToken
+	}
+
+	err = ws.verifyMFACode(ctx, mfa, req.Code, true)
+	if errors.Is(err, store.ErrInvalidMFACode) {
+		if guardErr := ws.loginGuard.Fail(ctx, user.Username, client.IP); guardErr != nil {
+			return nil, guardErr
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = ws.denylist.Add(ctx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	err = ws.loginGuard.Succeed(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+	return ws.issueTokens(ctx, user, client)
+}
+
+func (ws *WalletService) mfaChallenge(userid int64) (*domain.LoginResponse, error) {
+	token, err := jwttoken.GenerateMFAToken(&jwttoken.TokensOption{
+		UserID:      userid,
+		Issuer:      ws.optsJWT.Issuer,
+		Audience:    ws.optsJWT.Audience,
+		RefreshKeys: ws.refreshKeys,
+	}, ws.mfa.ChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.LoginResponse{
+		MFARequired: true,
+		MFAToken:    token,
+	}, nil
+}
+
+// requireOutgoingMFA asks for a fresh TOTP code when funds leaving the
+// user, by a withdrawal or a transfer, are above the threshold of their
+// currency. Two-factor authentication is optional, so users who have not
+// enabled it go without a code.
+func (ws *WalletService) requireOutgoingMFA(ctx context.Context, userid int64, amount money.Money, code string) error {
+	threshold, ok := ws.mfa.WithdrawThresholds[strings.ToLower(amount.Currency)]
+	if !ok || amount.Amount.LessThanOrEqual(decimal.NewFromFloat(threshold)) {
+		return nil
+	}
+
+	mfa, err := ws.enabledMFA(ctx, userid)
+	if err != nil {
+		return err
+	}
+	if mfa == nil {
+		return nil
+	}
+	if code == "" {
+		return domain.ErrMFACodeRequired
+	}
+	return ws.verifyMFACode(ctx, mfa, code, false)
+}
+
+// enabledMFA returns the confirmed MFA of the user or nil if the user has
+// none.
+func (ws *WalletService) enabledMFA(ctx context.Context, userid int64) (*store.MFA, error) {
+	mfa, err := ws.repo.GetMFA(ctx, userid)
+	if errors.Is(err, store.ErrMFANotEnabled) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if mfa.EnabledAt == nil {
+		return nil, nil
+	}
+	return mfa, nil
+}
+
+// verifyMFACode accepts a TOTP code not used before and, if allowed, an
+// unused recovery code.
+func (ws *WalletService) verifyMFACode(ctx context.Context, mfa *store.MFA, code string, allowRecovery bool) error {
+	if step, ok := totp.Match(mfa.Secret, code, time.Now()); ok {
+		return ws.repo.UseTOTPStep(ctx, mfa.UserID, step)
+	}
+	if allowRecovery {
+		return ws.repo.UseRecoveryCode(ctx, mfa.UserID, normalizeRecoveryCode(code))
+	}
+	return store.ErrInvalidMFACode
+}
+
+// generateRecoveryCodes returns codes formatted as xxxxx-xxxxx for reading.
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, errors.Wrap(err, "failed to generate recovery code")
+		}
+		code := hex.EncodeToString(raw)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCodes(codes []string) []string {
+	normalized := make([]string, len(codes))
+	for i, code := range codes {
+		normalized[i] = normalizeRecoveryCode(code)
+	}
+	return normalized
+}
+
+// normalizeRecoveryCode accepts recovery codes typed without the dash or in
+// upper case.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/mailer"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+// ForgotPassword mails a reset link if the email belongs to a user. An
+// unknown email is not an error, so the endpoint does not reveal which
+// emails are registered.
+func (ws *WalletService) ForgotPassword(ctx context.Context, req *domain.ForgotPasswordRequest) error {
+	user, err := ws.repo.GetUserByEmail(ctx, strings.TrimSpace(req.Email))
+	if errors.Is(err, store.ErrUserNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return errors.Wrap(err, "failed to generate password reset token")
+	}
+	token := hex.EncodeToString(raw)
+
+	err = ws.repo.CreatePasswordReset(ctx, &store.PasswordReset{
+		UserID:    user.ID,
+		Token:     token,
+		ExpiresAt: time.Now().Add(ws.reset.ResetTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	// a failed send is logged by the mailer and not reported: the answer
+	// has to be the same as for an unknown email, or it would tell which
+	// emails are registered
+	_ = ws.mailer.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("To set a new password, open the link below. It is valid for %s.\n\n%s%s\n\nIf you did not ask to reset your password, ignore this email.\n",
+			ws.reset.ResetTokenTTL, ws.reset.ResetURL, token),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token and ends every
+// session of the user.
+func (ws *WalletService) ResetPassword(ctx context.Context, req *domain.ResetPasswordRequest) error {
+	user, err := ws.repo.GetPasswordReset(ctx, req.Token)
+	if err != nil {
+		return err
+	}
+
+	err = ws.validator.ValidatePassword(req.NewPassword, user.Username, user.Email)
+	if err != nil {
+		return err
+	}
+
+	_, err = ws.repo.ResetPassword(ctx, req.Token, req.NewPassword)
+	return err
+}
+
+// ChangePassword replaces the password of the user if the old one is right
+// and ends every session of the user; access tokens already issued live
+// until they expire.
+func (ws *WalletService) ChangePassword(ctx context.Context, userid int64, req *domain.ChangePasswordRequest) error {
+	user, err := ws.repo.GetUser(ctx, userid)
+	if err != nil {
+		return err
+	}
+
+	err = ws.validator.ValidatePassword(req.NewPassword, user.Username, user.Email)
+	if err != nil {
+		return err
+	}
+
+	return ws.repo.ChangePassword(ctx, userid, req.OldPassword, req.NewPassword)
+}
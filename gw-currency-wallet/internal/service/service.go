@@ -2,21 +2,65 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/fees"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/mailer"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/quotes"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	jwttoken "github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/jwtToken"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/shopspring/decimal"
 )
 
+const defaultTransactionsLimit = 20
+
 type Repository interface {
 	CreateUser(ctx context.Context, user *store.User) error
 	Authentication(ctx context.Context, user *store.User) (int64, error)
 	SetToken(ctx context.Context, refresh *store.RefreshToken) error
-	GetBalance(ctx context.Context, userid int64) ([]*store.WalletCurrency, error)
+	GetBalance(ctx context.Context, userid, walletID int64) ([]*store.WalletCurrency, error)
+	GetWallets(ctx context.Context, userid int64) ([]*store.Wallet, error)
+	CreateWallet(ctx context.Context, wallet *store.Wallet, maxWallets int) error
+	MoveFunds(ctx context.Context, move *store.Move) error
 	UpdateBalance(ctx context.Context, newBalance *store.UpdateBalance) error
 	ExchangeCurrency(ctx context.Context, exchangeBody *store.ExchangeBalance) error
+	Transfer(ctx context.Context, transfer *store.Transfer) error
 	GetSpecificCurrency(ctx context.Context, req *store.CurrencyRequest) (*store.WalletCurrency, error)
-	CheckRefreshToken(ctx context.Context, token *store.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, old, next *store.RefreshToken) error
+	RevokeRefreshToken(ctx context.Context, token *store.RefreshToken) error
+	RevokeUserTokens(ctx context.Context, userid int64) error
+	GetSessions(ctx context.Context, userid int64) ([]*store.Session, error)
+	RevokeSession(ctx context.Context, userid, sessionID int64) error
+	GetTransactions(ctx context.Context, filter *store.TransactionFilter) ([]*store.Transaction, error)
+	GetUser(ctx context.Context, userid int64) (*store.User, error)
+	CreateEmailVerification(ctx context.Context, verification *store.EmailVerification) error
+	VerifyEmail(ctx context.Context, token string) (int64, error)
+	GetUserByEmail(ctx context.Context, email string) (*store.User, error)
+	CreatePasswordReset(ctx context.Context, reset *store.PasswordReset) error
+	GetPasswordReset(ctx context.Context, token string) (*store.User, error)
+	ResetPassword(ctx context.Context, token, password string) (int64, error)
+	ChangePassword(ctx context.Context, userid int64, oldPassword, newPassword string) error
+	GetMFA(ctx context.Context, userid int64) (*store.MFA, error)
+	SetMFASecret(ctx context.Context, userid int64, secret string) error
+	EnableMFA(ctx context.Context, userid, step int64, recoveryCodes []string) error
+	DisableMFA(ctx context.Context, userid int64) error
+	UseTOTPStep(ctx context.Context, userid, step int64) error
+	UseRecoveryCode(ctx context.Context, userid int64, code string) error
+	ReplaceRecoveryCodes(ctx context.Context, userid int64, codes []string) error
+	FindUsers(ctx context.Context, query string, limit int) ([]*store.User, error)
+	SetUserRole(ctx context.Context, userid int64, role string, entry *store.AuditEntry) error
+	FreezeUser(ctx context.Context, userid int64, entry *store.AuditEntry) error
+	UnfreezeUser(ctx context.Context, userid int64, entry *store.AuditEntry) error
+	SetWalletStatus(ctx context.Context, userid, walletID int64, status string, entry *store.AuditEntry) error
+	GetUserLimits(ctx context.Context, userid int64) ([]*store.Limit, error)
+	SetUserLimit(ctx context.Context, userid int64, limit *store.Limit, entry *store.AuditEntry) error
+	SetCurrency(ctx context.Context, currency *store.Currency, entry *store.AuditEntry) error
+	GetLimitUsage(ctx context.Context, userid int64) ([]*store.LimitUsage, error)
+	RecordAudit(ctx context.Context, entry *store.AuditEntry) error
+	GetAuditLog(ctx context.Context, filter *store.AuditFilter) ([]*store.AuditEntry, error)
 }
 
 type RateExchanger interface {
@@ -24,16 +68,89 @@ type RateExchanger interface {
 	GetExchangeRates(ctx context.Context) ([]*domain.RateResponse, error)
 }
 
+type CurrencyCatalogue interface {
+	Enabled(ctx context.Context) ([]*store.Currency, error)
+	Check(ctx context.Context, code string, incoming bool) error
+	Quoted(ctx context.Context, code string) error
+	Invalidate()
+}
+
+type QuoteStore interface {
+	Create(ctx context.Context, quote *quotes.Quote) error
+	Take(ctx context.Context, userid int64, id string) (*quotes.Quote, error)
+	Restore(ctx context.Context, quote *quotes.Quote) error
+}
+
+type FeeSchedule interface {
+	Charge(amount money.Money, midRate decimal.Decimal, target string) (*fees.Charge, error)
+}
+
+type LimitSchedule interface {
+	Limit(operation, currency string, overrides []*store.Limit) *store.Limit
+	Limits(overrides []*store.Limit) []*store.Limit
+}
+
+type TokenDenylist interface {
+	Add(ctx context.Context, tokenID string, expiresAt time.Time) error
+	Contains(ctx context.Context, tokenID string) (bool, error)
+}
+
+type LoginGuard interface {
+	Check(ctx context.Context, username, ip string) error
+	Fail(ctx context.Context, username, ip string) error
+	Succeed(ctx context.Context, username string) error
+	Unlock(ctx context.Context, username string) error
+}
+
+type RegistrationValidator interface {
+	Validate(req *domain.RegisterRequest) error
+	ValidatePassword(password, username, email string) error
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg *mailer.Message) error
+}
+
 type WalletService struct {
-	repo      Repository
-	optsJWT   config.JWTtokens
-	exchanger RateExchanger
+	repo       Repository
+	optsJWT    config.JWTtokens
+	exchanger  RateExchanger
+	currencies CurrencyCatalogue
+	quotes     QuoteStore
+	fees       FeeSchedule
+	limits     LimitSchedule
+	// access tokens may be signed with an asymmetric key, refresh tokens
+	// never leave the service and stay on the shared secret
+	accessKeys   *jwttoken.KeySet
+	refreshKeys  *jwttoken.KeySet
+	denylist     TokenDenylist
+	loginGuard   LoginGuard
+	validator    RegistrationValidator
+	mailer       Mailer
+	verification config.EmailVerification
+	reset        config.PasswordReset
+	mfa          config.MFA
+	wallets      config.Wallets
 }
 
-func New(repo Repository, exch RateExchanger, tokensOpt config.JWTtokens) *WalletService {
+func New(repo Repository, exch RateExchanger, catalogue CurrencyCatalogue, quoteStore QuoteStore, feeSchedule FeeSchedule, limitSchedule LimitSchedule, tokensOpt config.JWTtokens, accessKeys *jwttoken.KeySet, denylist TokenDenylist, loginGuard LoginGuard, validator RegistrationValidator, mail Mailer, verification config.EmailVerification, reset config.PasswordReset, mfa config.MFA, wallets config.Wallets) *WalletService {
 	return &WalletService{
-		repo:      repo,
-		exchanger: exch,
-		optsJWT:   tokensOpt,
+		repo:         repo,
+		exchanger:    exch,
+		currencies:   catalogue,
+		quotes:       quoteStore,
+		fees:         feeSchedule,
+		limits:       limitSchedule,
+		optsJWT:      tokensOpt,
+		accessKeys:   accessKeys,
+		refreshKeys:  jwttoken.NewHMACKeySet(tokensOpt.RefreshSecret),
+		denylist:     denylist,
+		loginGuard:   loginGuard,
+		validator:    validator,
+		mailer:       mail,
+		verification: verification,
+		reset:        reset,
+		mfa:          mfa,
+		wallets:      wallets,
 	}
 }
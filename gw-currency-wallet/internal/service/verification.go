@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/mailer"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+// sendVerification issues a new verification token and mails the link to
+// the user.
+func (ws *WalletService) sendVerification(ctx context.Context, userid int64, email string) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return errors.Wrap(err, "failed to generate verification token")
+	}
+	token := hex.EncodeToString(raw)
+
+	err := ws.repo.CreateEmailVerification(ctx, &store.EmailVerification{
+		UserID:    userid,
+		Token:     token,
+		ExpiresAt: time.Now().Add(ws.verification.TokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return ws.mailer.Send(ctx, &mailer.Message{
+		To:      email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("To confirm your email, open the link below. It is valid for %s.\n\n%s%s\n",
+			ws.verification.TokenTTL, ws.verification.VerifyURL, token),
+	})
+}
+
+func (ws *WalletService) VerifyEmail(ctx context.Context, token string) error {
+	_, err := ws.repo.VerifyEmail(ctx, token)
+	return err
+}
+
+func (ws *WalletService) ResendVerification(ctx context.Context, userid int64) error {
+	user, err := ws.repo.GetUser(ctx, userid)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return domain.ErrEmailAlreadyVerified
+	}
+	return ws.sendVerification(ctx, user.ID, user.Email)
+}
+
+// requireActiveUser refuses every operation of a frozen account and keeps
+// money from leaving the wallets of users who have not confirmed their
+// email.
+func (ws *WalletService) requireActiveUser(ctx context.Context, userid int64, outgoing bool) error {
+	user, err := ws.activeUser(ctx, userid)
+	if err != nil {
+		return err
+	}
+	if outgoing && user.EmailVerifiedAt == nil {
+		return store.ErrEmailNotVerified
+	}
+	return nil
+}
+
+// activeUser returns the user unless the account is frozen.
+func (ws *WalletService) activeUser(ctx context.Context, userid int64) (*store.User, error) {
+	user, err := ws.repo.GetUser(ctx, userid)
+	if err != nil {
+		return nil, err
+	}
+	if user.FrozenAt != nil {
+		return nil, store.ErrAccountFrozen
+	}
+	return user, nil
+}
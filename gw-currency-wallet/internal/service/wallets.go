@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/mappers"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+)
+
+// Wallets returns the user's wallets with their balances.
+func (ws *WalletService) Wallets(ctx context.Context, userid int64) ([]*domain.WalletResponse, error) {
+	wallets, err := ws.repo.GetWallets(ctx, userid)
+	if err != nil {
+		return nil, err
+	}
+	return mappers.ToDomainWallets(wallets), nil
+}
+
+// CreateWallet opens another named wallet for the user. Names are unique
+// per user regardless of case.
+func (ws *WalletService) CreateWallet(ctx context.Context, userid int64, req *domain.CreateWalletRequest) (*domain.WalletResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, domain.ErrInvalidWalletName
+	}
+	if err := ws.requireActiveUser(ctx, userid, false); err != nil {
+		return nil, err
+	}
+
+	wallet := &store.Wallet{
+		UserID: userid,
+		Name:   name,
+	}
+	err := ws.repo.CreateWallet(ctx, wallet, ws.wallets.MaxPerUser)
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := ws.repo.GetBalance(ctx, userid, wallet.ID)
+	if err != nil {
+		return nil, err
+	}
+	wallet.Balances = balances
+	return mappers.ToDomainWallet(wallet), nil
+}
+
+// MoveFunds moves funds between two of the user's wallets. The funds stay
+// with the user, so neither limits nor email verification apply; the
+// wallet statuses do.
+func (ws *WalletService) MoveFunds(ctx context.Context, userid int64, req *domain.MoveRequest) ([]*domain.WalletResponse, error) {
+	if err := ws.checkMoney(ctx, req.Money, true); err != nil {
+		return nil, err
+	}
+	if err := ws.requireActiveUser(ctx, userid, false); err != nil {
+		return nil, err
+	}
+
+	err := ws.repo.MoveFunds(ctx, mappers.ToStoreMove(userid, req))
+	if err != nil {
+		return nil, err
+	}
+	return ws.Wallets(ctx, userid)
+}
@@ -0,0 +1,35 @@
+package store
+
+import "errors"
+
+var (
+	ErrInsufficientFunds  = errors.New("Insufficient funds")
+	ErrRecipientNotFound  = errors.New("recipient not found")
+	ErrTransferToYourself = errors.New("cannot transfer to yourself")
+	ErrTokenReused        = errors.New("refresh token reuse detected")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUsernameTaken      = errors.New("username is already taken")
+	ErrEmailTaken         = errors.New("email is already registered")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrEmailNotVerified   = errors.New("email is not verified")
+	ErrVerificationFailed = errors.New("verification token is invalid or expired")
+	ErrResetFailed        = errors.New("password reset token is invalid or expired")
+	ErrWrongPassword      = errors.New("current password is incorrect")
+	ErrMFANotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrInvalidMFACode     = errors.New("invalid two-factor authentication code")
+	ErrAccountFrozen      = errors.New("account is frozen")
+	ErrAccountNotFrozen   = errors.New("account is not frozen")
+	ErrWalletFrozen       = errors.New("wallet is frozen")
+	ErrWalletClosed       = errors.New("wallet is closed")
+	ErrWalletStatusSame   = errors.New("wallet already has this status")
+	ErrWalletNotEmpty     = errors.New("wallet still holds funds")
+	ErrRecipientClosed    = errors.New("recipient wallet is closed")
+	ErrLimitExceeded      = errors.New("limit exceeded")
+	ErrMinorUnitsFixed    = errors.New("minor units of an existing currency cannot change")
+	ErrWalletNotFound     = errors.New("wallet not found")
+	ErrWalletNameTaken    = errors.New("wallet name is already taken")
+	ErrTooManyWallets     = errors.New("maximum number of wallets reached")
+	ErrMoveToSameWallet   = errors.New("cannot move funds to the same wallet")
+)
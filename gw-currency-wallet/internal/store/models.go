@@ -2,57 +2,278 @@ package store
 
 import (
 	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	OperationDeposit  = "deposit"
+	OperationWithdraw = "withdraw"
+	OperationExchange = "exchange"
+	OperationTransfer = "transfer"
+	OperationMove     = "move"
+	OperationOpening  = "opening"
+)
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// Wallet statuses. A frozen wallet only accepts incoming funds, a closed one
+// accepts nothing and cannot be reopened.
+const (
+	WalletActive = "active"
+	WalletFrozen = "frozen"
+	WalletClosed = "closed"
+)
+
+// Actions recorded in the admin audit log.
+const (
+	AuditUserSearch       = "user.search"
+	AuditUserView         = "user.view"
+	AuditUserBalance      = "user.balance"
+	AuditUserTransactions = "user.transactions"
+	AuditUserFreeze       = "user.freeze"
+	AuditUserUnfreeze     = "user.unfreeze"
+	AuditUserRole         = "user.role"
+	AuditUserUnlock       = "user.unlock"
+	AuditWalletStatus     = "wallet.status"
+	AuditUserLimits       = "user.limits"
+	AuditCurrencySet      = "currency.set"
+	AuditLogView          = "audit.view"
+)
+
+const (
+	AccountWallet   = "wallet"
+	AccountCash     = "cash"
+	AccountExchange = "exchange"
+	AccountTransfer = "transfer"
+	AccountFee      = "fee"
 )
 
 type User struct {
-	ID        int64
-	Username  string
-	Email     string
-	Password  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID              int64
+	Username        string
+	Email           string
+	Password        string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	EmailVerifiedAt *time.Time
+	Role            string
+	FrozenAt        *time.Time
+}
+
+// AuditEntry records an action of a support or admin user. TargetUserID is
+// nil for actions not about a single user.
+type AuditEntry struct {
+	ID           int64
+	ActorID      int64
+	Action       string
+	TargetUserID *int64
+	Details      map[string]string
+	CreatedAt    time.Time
+}
+
+type AuditFilter struct {
+	TargetUserID int64
+	BeforeID     int64
+	Limit        int
 }
 
+// EmailVerification is a one-time token confirming the user's email; like a
+// refresh token only its digest is stored.
+type EmailVerification struct {
+	UserID    int64
+	Token     string
+	ExpiresAt time.Time
+}
+
+// PasswordReset is a one-time token allowing to set a new password without
+// the old one; only its digest is stored.
+type PasswordReset struct {
+	UserID    int64
+	Token     string
+	ExpiresAt time.Time
+}
+
+// MFA is the TOTP secret of a user. EnabledAt is nil until the secret is
+// confirmed with a first code; LastUsedStep is the time step of the last
+// accepted code, so no code works twice.
+type MFA struct {
+	UserID       int64
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep int64
+}
+
+// Currency is an entry of the currency catalogue. MinorUnits is the number
+// of decimal places an amount in the currency may have.
+type Currency struct {
+	Code       string
+	Name       string
+	MinorUnits int32
+	Enabled    bool
+}
+
+// Wallet is one of the user's named wallets. The primary wallet is created
+// with the account and is used when a request names no wallet.
 type Wallet struct {
 	ID        int64
 	UserID    int64
+	Name      string
+	Primary   bool
+	Status    string
+	Balances  []*WalletCurrency
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// UpdateBalance is refused if it would take the usage over Limit; a nil
+// Limit means the operation is not limited. A zero WalletID means the
+// primary wallet, as in the other requests.
 type UpdateBalance struct {
-	UserID    int64
+	UserID   int64
+	WalletID int64
+	money.Money
+	Operation string
+	Limit     *Limit
+}
+
+// Limit caps an operation in a currency over the last day and the last 30
+// days; a null amount leaves the period unlimited.
+type Limit struct {
+	Operation string
 	Currency  string
-	Amount    float64
+	Daily     decimal.NullDecimal
+	Monthly   decimal.NullDecimal
+}
+
+// LimitUsage is what an operation took out of a currency balance over the
+// last day and the last 30 days.
+type LimitUsage struct {
 	Operation string
+	Currency  string
+	Daily     decimal.Decimal
+	Monthly   decimal.Decimal
 }
 
 type WalletCurrency struct {
-	ID        int64
-	WalletID  int64
-	Currency  string
-	Balance   float64
-	UpdatedAt time.Time
+	ID           int64
+	WalletID     int64
+	WalletStatus string
+	Currency     string
+	Balance      decimal.Decimal
+	UpdatedAt    time.Time
 }
 
+// RefreshToken carries the raw token to the repository, which stores only
+// its digest.
 type RefreshToken struct {
-	ID        int64
-	UserID    int64
-	Hash      string
-	ExpiresAt time.Time
-	Revoked   bool
-	CreatedAt time.Time
+	ID         int64
+	UserID     int64
+	FamilyID   int64
+	Token      string
+	ExpiresAt  time.Time
+	Revoked    bool
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// Session is a refresh token family: everything issued from one login.
+type Session struct {
+	ID         int64
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
 }
 
 type ExchangeBalance struct {
 	UserID       int64
+	WalletID     int64
 	FromCurrency string
-	FromAmount   float64
+	FromAmount   decimal.Decimal
 	ToCurrency   string
-	ToAmount     float64
+	ToAmount     decimal.Decimal
+	Fee          decimal.Decimal
+	Rate         decimal.Decimal
+	Limit        *Limit
+}
+
+// Transfer leaves the sender's wallet FromWalletID and always arrives in
+// the recipient's primary wallet. It counts towards the sender's withdrawal
+// Limit; a nil Limit means the transfer is not limited. A converted transfer
+// pays Fee in ToCurrency on top of ToAmount.
+type Transfer struct {
+	FromUserID   int64
+	FromWalletID int64
+	Recipient    string
+	FromCurrency string
+	FromAmount   decimal.Decimal
+	ToCurrency   string
+	ToAmount     decimal.Decimal
+	Rate         decimal.NullDecimal
+	Fee          decimal.NullDecimal
+	Limit        *Limit
+}
+
+// Move takes funds from one of the user's wallets to another, in the same
+// currency.
+type Move struct {
+	UserID       int64
+	FromWalletID int64
+	ToWalletID   int64
+	money.Money
 }
 
 type CurrencyRequest struct {
 	UserID       int64
+	WalletID     int64
 	CurrencyCode string
 }
+
+type Transaction struct {
+	ID        int64
+	WalletID  int64
+	Operation string
+	Rate      decimal.NullDecimal
+	Fee       decimal.NullDecimal
+	Entries   []*LedgerEntry
+	CreatedAt time.Time
+}
+
+type LedgerEntry struct {
+	ID            int64
+	TransactionID int64
+	Account       string
+	BalanceID     int64
+	WalletID      int64
+	Currency      string
+	Debit         decimal.Decimal
+	Credit        decimal.Decimal
+	BalanceAfter  decimal.Decimal
+}
+
+type BalanceMismatch struct {
+	BalanceID     int64
+	WalletID      int64
+	Currency      string
+	Balance       decimal.Decimal
+	LedgerBalance decimal.Decimal
+}
+
+type TransactionFilter struct {
+	UserID    int64
+	WalletID  int64
+	Operation string
+	Currency  string
+	From      *time.Time
+	To        *time.Time
+	BeforeID  int64
+	Limit     int
+}
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func (repo *PostgresRepo) RecordAudit(ctx context.Context, entry *store.AuditEntry) error {
+	err := repo.recordAudit(ctx, repo.db, entry)
+	if err != nil {
+		repo.log.Error().Err(err).Int64("actorID", entry.ActorID).Str("action", entry.Action).Msg("Failed to record admin action")
+	}
+	return err
+}
+
+func (repo *PostgresRepo) recordAudit(ctx context.Context, q execer, entry *store.AuditEntry) error {
+	sql := `INSERT INTO admin_audit_log (actor_id, action, target_user_id, details) VALUES ($1, $2, $3, $4)`
+
+	details := entry.Details
+	if details == nil {
+		details = map[string]string{}
+	}
+	_, err := q.Exec(ctx, sql, entry.ActorID, entry.Action, entry.TargetUserID, details)
+	return errors.Wrap(err, "failed to record admin action")
+}
+
+// GetAuditLog returns the newest entries first, before filter.BeforeID if
+// it is set.
+func (repo *PostgresRepo) GetAuditLog(ctx context.Context, filter *store.AuditFilter) ([]*store.AuditEntry, error) {
+	sql := `SELECT id, actor_id, action, target_user_id, details, created_at FROM admin_audit_log
+	WHERE ($1 = 0 OR target_user_id = $1) AND ($2 = 0 OR id < $2)
+	ORDER BY id DESC LIMIT $3`
+
+	rows, err := repo.db.Query(ctx, sql, filter.TargetUserID, filter.BeforeID, filter.Limit)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to get audit log")
+		return nil, errors.Wrap(err, "failed to get audit log")
+	}
+	defer rows.Close()
+
+	entries := []*store.AuditEntry{}
+	for rows.Next() {
+		entry := &store.AuditEntry{}
+		err = rows.Scan(&entry.ID, &entry.ActorID, &entry.Action, &entry.TargetUserID, &entry.Details, &entry.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan audit entry")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
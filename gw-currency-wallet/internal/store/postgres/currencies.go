@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+// GetCurrencies returns the whole currency catalogue, disabled currencies
+// included.
+func (repo *PostgresRepo) GetCurrencies(ctx context.Context) ([]*store.Currency, error) {
+	sql := `SELECT code, name, minor_units, enabled FROM currencies ORDER BY code`
+
+	rows, err := repo.db.Query(ctx, sql)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to query currencies")
+		return nil, errors.Wrap(err, "failed to query currencies")
+	}
+	defer rows.Close()
+
+	var currencies []*store.Currency
+	for rows.Next() {
+		var currency store.Currency
+		err = rows.Scan(&currency.Code, &currency.Name, &currency.MinorUnits, &currency.Enabled)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		currencies = append(currencies, &currency)
+	}
+	return currencies, rows.Err()
+}
+
+// SetCurrency adds a currency to the catalogue or renames, enables or
+// disables an existing one. The minor units are fixed once the currency
+// exists: balances and limits are already rounded to them.
+func (repo *PostgresRepo) SetCurrency(ctx context.Context, currency *store.Currency, entry *store.AuditEntry) error {
+	var (
+		sqlSelect = `SELECT minor_units FROM currencies WHERE code = $1 FOR UPDATE`
+		sqlInsert = `INSERT INTO currencies (code, name, minor_units, enabled) VALUES ($1, $2, $3, $4)`
+		sqlUpdate = `UPDATE currencies SET name = $2, enabled = $3 WHERE code = $1`
+	)
+
+	return repo.adminUpdate(ctx, entry, func(tx pgx.Tx) error {
+		var minorUnits int32
+		err := tx.QueryRow(ctx, sqlSelect, currency.Code).Scan(&minorUnits)
+		if err == pgx.ErrNoRows {
+			_, err = tx.Exec(ctx, sqlInsert, currency.Code, currency.Name, currency.MinorUnits, currency.Enabled)
+			return errors.Wrap(err, "failed to add currency")
+		} else if err != nil {
+			return errors.Wrap(err, "failed to query currency")
+		}
+
+		if minorUnits != currency.MinorUnits {
+			return store.ErrMinorUnitsFixed
+		}
+		_, err = tx.Exec(ctx, sqlUpdate, currency.Code, currency.Name, currency.Enabled)
+		return errors.Wrap(err, "failed to update currency")
+	})
+}
+
+// ensureBalance gives the wallet a zero balance in the currency if it has
+// none yet, so a currency enabled after the wallet was created can be
+// credited. Nothing is created for a disabled or unknown currency.
+func (repo *PostgresRepo) ensureBalance(ctx context.Context, tx pgx.Tx, walletID int64, currency string) error {
+	sql := `INSERT INTO wallet_balances (wallet_id, currency, balance)
+	SELECT $1, code, 0
+	FROM currencies
+	WHERE code = $2 AND enabled
+	ON CONFLICT (wallet_id, currency) DO NOTHING`
+
+	_, err := tx.Exec(ctx, sql, walletID, currency)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s balance", currency)
+	}
+	return nil
+}
@@ -0,0 +1,434 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+func (repo *PostgresRepo) inTransaction(ctx context.Context, fn func(tx pgx.Tx) error) (err error) {
+	tx, err := repo.db.Begin(ctx)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to begin transaction")
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer func() {
+		if err != nil {
+			repo.log.Error().Err(err).Msg("Rolling back transaction")
+			_ = tx.Rollback(ctx)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to commit transaction")
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+	return nil
+}
+
+func balanceChangeTransaction(operation string, balance *store.WalletCurrency, amount decimal.Decimal) *store.Transaction {
+	wallet := &store.LedgerEntry{
+		Account:      store.AccountWallet,
+		BalanceID:    balance.ID,
+		Currency:     balance.Currency,
+		BalanceAfter: balance.Balance,
+	}
+	cash := &store.LedgerEntry{
+		Account:  store.AccountCash,
+		Currency: balance.Currency,
+	}
+
+	if operation == store.OperationDeposit {
+		wallet.Credit, cash.Debit = amount, amount
+	} else {
+		wallet.Debit, cash.Credit = amount, amount
+	}
+
+	return &store.Transaction{
+		WalletID:  balance.WalletID,
+		Operation: operation,
+		Entries:   []*store.LedgerEntry{wallet, cash},
+	}
+}
+
+// exchangeTransaction buys the gross amount on the exchange account and
+// splits it between the wallet and the fee account.
+func exchangeTransaction(from, to *store.WalletCurrency, exchangeBody *store.ExchangeBalance) *store.Transaction {
+	transaction := &store.Transaction{
+		WalletID:  from.WalletID,
+		Operation: store.OperationExchange,
+		Rate:      decimal.NewNullDecimal(exchangeBody.Rate),
+		Entries: []*store.LedgerEntry{
+			{
+				Account:      store.AccountWallet,
+				BalanceID:    from.ID,
+				Currency:     from.Currency,
+				Debit:        exchangeBody.FromAmount,
+				BalanceAfter: from.Balance,
+			},
+			{
+				Account:  store.AccountExchange,
+				Currency: from.Currency,
+				Credit:   exchangeBody.FromAmount,
+			},
+			{
+				Account:  store.AccountExchange,
+				Currency: to.Currency,
+				Debit:    exchangeBody.ToAmount.Add(exchangeBody.Fee),
+			},
+			{
+				Account:      store.AccountWallet,
+				BalanceID:    to.ID,
+				Currency:     to.Currency,
+				Credit:       exchangeBody.ToAmount,
+				BalanceAfter: to.Balance,
+			},
+		},
+	}
+	if exchangeBody.Fee.IsPositive() {
+		transaction.Fee = decimal.NewNullDecimal(exchangeBody.Fee)
+		transaction.Entries = append(transaction.Entries, &store.LedgerEntry{
+			Account:  store.AccountFee,
+			Currency: to.Currency,
+			Credit:   exchangeBody.Fee,
+		})
+	}
+	return transaction
+}
+
+// transferTransactions splits a transfer into one transaction per wallet, so
+// each side only ever sees its own entries in the history. Both are balanced
+// against the transfer clearing account.
+func transferTransactions(from, to *store.WalletCurrency, transfer *store.Transfer) (outgoing, incoming *store.Transaction) {
+	outgoing = &store.Transaction{
+		WalletID:  from.WalletID,
+		Operation: store.OperationTransfer,
+		Rate:      transfer.Rate,
+		Entries: []*store.LedgerEntry{
+			{
+				Account:      store.AccountWallet,
+				BalanceID:    from.ID,
+				Currency:     from.Currency,
+				Debit:        transfer.FromAmount,
+				BalanceAfter: from.Balance,
+			},
+			{
+				Account:  store.AccountTransfer,
+				Currency: from.Currency,
+				Credit:   transfer.FromAmount,
+			},
+		},
+	}
+	// the fee is the sender's cost, so it is shown in the outgoing
+	// transaction; the clearing account still pays out ToAmount plus Fee
+	if transfer.Fee.Valid {
+		outgoing.Fee = transfer.Fee
+		outgoing.Entries = append(outgoing.Entries,
+			&store.LedgerEntry{
+				Account:  store.AccountTransfer,
+				Currency: transfer.ToCurrency,
+				Debit:    transfer.Fee.Decimal,
+			},
+			&store.LedgerEntry{
+				Account:  store.AccountFee,
+				Currency: transfer.ToCurrency,
+				Credit:   transfer.Fee.Decimal,
+			})
+	}
+	incoming = &store.Transaction{
+		WalletID:  to.WalletID,
+		Operation: store.OperationTransfer,
+		Rate:      transfer.Rate,
+		Entries: []*store.LedgerEntry{
+			{
+				Account:  store.AccountTransfer,
+				Currency: to.Currency,
+				Debit:    transfer.ToAmount,
+			},
+			{
+				Account:      store.AccountWallet,
+				BalanceID:    to.ID,
+				Currency:     to.Currency,
+				Credit:       transfer.ToAmount,
+				BalanceAfter: to.Balance,
+			},
+		},
+	}
+	return outgoing, incoming
+}
+
+// moveTransaction debits one of the user's balances and credits another,
+// both entries point at wallet balances so no clearing account is needed.
+func moveTransaction(from, to *store.WalletCurrency, amount decimal.Decimal) *store.Transaction {
+	return &store.Transaction{
+		WalletID:  from.WalletID,
+		Operation: store.OperationMove,
+		Entries: []*store.LedgerEntry{
+			{
+				Account:      store.AccountWallet,
+				BalanceID:    from.ID,
+				Currency:     from.Currency,
+				Debit:        amount,
+				BalanceAfter: from.Balance,
+			},
+			{
+				Account:      store.AccountWallet,
+				BalanceID:    to.ID,
+				Currency:     to.Currency,
+				Credit:       amount,
+				BalanceAfter: to.Balance,
+			},
+		},
+	}
+}
+
+// recordTransaction writes the transaction with its entries and makes sure
+// every wallet balance it touched still matches the ledger. Balancing of
+// debits and credits is enforced by a deferred trigger on commit.
+func (repo *PostgresRepo) recordTransaction(ctx context.Context, tx pgx.Tx, transaction *store.Transaction) error {
+	var (
+		sqlTransaction = `INSERT INTO transactions (wallet_id, operation, rate) VALUES ($1, $2, $3) RETURNING id, created_at`
+		sqlEntry       = `INSERT INTO ledger_entries (transaction_id, account, balance_id, currency, debit, credit, balance_after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		balanceIDs []int64
+	)
+
+	err := tx.QueryRow(ctx, sqlTransaction, transaction.WalletID, transaction.Operation, transaction.Rate).Scan(&transaction.ID, &transaction.CreatedAt)
+	if err != nil {
+		repo.log.Error().Err(err).Int64("walletID", transaction.WalletID).Msg("Failed to create transaction")
+		return errors.Wrap(err, "failed to create transaction")
+	}
+
+	for _, entry := range transaction.Entries {
+		entry.TransactionID = transaction.ID
+
+		var (
+			balanceID    *int64
+			balanceAfter *decimal.Decimal
+		)
+		if entry.Account == store.AccountWallet {
+			balanceID, balanceAfter = &entry.BalanceID, &entry.BalanceAfter
+			balanceIDs = append(balanceIDs, entry.BalanceID)
+		}
+
+		_, err = tx.Exec(ctx, sqlEntry,
+			transaction.ID, entry.Account, balanceID, entry.Currency,
+			entry.Debit, entry.Credit, balanceAfter)
+		if err != nil {
+			repo.log.Error().Err(err).Int64("transactionID", transaction.ID).Msg("Failed to write ledger entry")
+			return errors.Wrap(err, "failed to write ledger entry")
+		}
+	}
+
+	mismatches, err := repo.findMismatches(ctx, tx, balanceIDs)
+	if err != nil {
+		return err
+	}
+	if len(mismatches) > 0 {
+		repo.log.Error().Int64("transactionID", transaction.ID).Interface("mismatches", mismatches).Msg("Balance diverged from ledger")
+		return errors.New("balance diverged from ledger")
+	}
+
+	repo.log.Debug().Int64("transactionID", transaction.ID).Str("operation", transaction.Operation).Msg("Transaction recorded")
+	return nil
+}
+
+// ReconcileLedger returns every wallet balance whose stored value differs
+// from the sum of its ledger entries.
+func (repo *PostgresRepo) ReconcileLedger(ctx context.Context) ([]*store.BalanceMismatch, error) {
+	repo.log.Info().Msg("Reconciling balances against the ledger")
+
+	return repo.findMismatches(ctx, repo.db, nil)
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func (repo *PostgresRepo) findMismatches(ctx context.Context, q querier, balanceIDs []int64) ([]*store.BalanceMismatch, error) {
+	var (
+		sql = `SELECT
+		balance_id,
+		wallet_id,
+		currency,
+		balance,
+		ledger_balance
+		FROM
+		wallet_balance_reconciliation
+		WHERE
+		balance <> ledger_balance`
+		args       []any
+		mismatches []*store.BalanceMismatch
+	)
+	if balanceIDs != nil {
+		sql += ` AND balance_id = ANY($1)`
+		args = append(args, balanceIDs)
+	}
+
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to query ledger reconciliation")
+		return nil, errors.Wrap(err, "failed to query ledger reconciliation")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mismatch store.BalanceMismatch
+		err = rows.Scan(&mismatch.BalanceID, &mismatch.WalletID, &mismatch.Currency, &mismatch.Balance, &mismatch.LedgerBalance)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		mismatches = append(mismatches, &mismatch)
+	}
+	return mismatches, rows.Err()
+}
+
+// GetTransactions returns a page of the user's operations, newest first,
+// each with its wallet entries. Pagination is keyset based on the
+// transaction id.
+func (repo *PostgresRepo) GetTransactions(ctx context.Context, filter *store.TransactionFilter) ([]*store.Transaction, error) {
+	repo.log.Info().Int64("userID", filter.UserID).Msg("Fetching transactions")
+
+	var (
+		conditions = []string{"w.user_id = $1", "t.operation <> '" + store.OperationOpening + "'"}
+		args       = []any{filter.UserID}
+	)
+	addCondition := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Operation != "" {
+		addCondition("t.operation = $%d", filter.Operation)
+	}
+	if filter.WalletID != 0 {
+		addCondition(`EXISTS (SELECT 1 FROM ledger_entries le
+		INNER JOIN wallet_balances wb ON le.balance_id = wb.id
+		WHERE le.transaction_id = t.id AND wb.wallet_id = $%d)`, filter.WalletID)
+	}
+	if filter.Currency != "" {
+		addCondition(`EXISTS (SELECT 1 FROM ledger_entries le
+		WHERE le.transaction_id = t.id AND le.account = '`+store.AccountWallet+`' AND le.currency = $%d)`, filter.Currency)
+	}
+	if filter.From != nil {
+		addCondition("t.created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		addCondition("t.created_at < $%d", *filter.To)
+	}
+	if filter.BeforeID != 0 {
+		addCondition("t.id < $%d", filter.BeforeID)
+	}
+	args = append(args, filter.Limit)
+
+	sql := fmt.Sprintf(`SELECT
+		t.id,
+		t.wallet_id,
+		t.operation,
+		t.rate,
+		(SELECT SUM(le.credit) FROM ledger_entries le
+		WHERE le.transaction_id = t.id AND le.account = '`+store.AccountFee+`') AS fee,
+		t.created_at
+		FROM
+		transactions t
+		INNER JOIN
+		wallets w
+		ON
+		t.wallet_id = w.id
+		WHERE
+		%s
+		ORDER BY t.id DESC
+		LIMIT $%d`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := repo.db.Query(ctx, sql, args...)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to query transactions")
+		return nil, errors.Wrap(err, "failed to query transactions")
+	}
+	defer rows.Close()
+
+	var (
+		transactions []*store.Transaction
+		byID         = make(map[int64]*store.Transaction)
+		ids          []int64
+	)
+	for rows.Next() {
+		var transaction store.Transaction
+		err = rows.Scan(&transaction.ID, &transaction.WalletID, &transaction.Operation, &transaction.Rate, &transaction.Fee, &transaction.CreatedAt)
+		if err != nil {
+			repo.log.Error().Err(err).Msg("Failed to scan row")
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		transactions = append(transactions, &transaction)
+		byID[transaction.ID] = &transaction
+		ids = append(ids, transaction.ID)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read transactions")
+	}
+	if len(ids) == 0 {
+		return transactions, nil
+	}
+
+	err = repo.loadWalletEntries(ctx, byID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	repo.log.Debug().Int("count", len(transactions)).Msg("Transactions fetched successfully")
+	return transactions, nil
+}
+
+func (repo *PostgresRepo) loadWalletEntries(ctx context.Context, byID map[int64]*store.Transaction, ids []int64) error {
+	sql := `SELECT
+	le.id,
+	le.transaction_id,
+	le.balance_id,
+	wb.wallet_id,
+	le.currency,
+	le.debit,
+	le.credit,
+	le.balance_after
+	FROM
+	ledger_entries le
+	INNER JOIN
+	wallet_balances wb
+	ON
+	le.balance_id = wb.id
+	WHERE
+	le.transaction_id = ANY($1) AND
+	le.account = '` + store.AccountWallet + `'
+	ORDER BY le.id`
+
+	rows, err := repo.db.Query(ctx, sql, ids)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to query ledger entries")
+		return errors.Wrap(err, "failed to query ledger entries")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry store.LedgerEntry
+		err = rows.Scan(&entry.ID, &entry.TransactionID, &entry.BalanceID, &entry.WalletID, &entry.Currency, &entry.Debit, &entry.Credit, &entry.BalanceAfter)
+		if err != nil {
+			repo.log.Error().Err(err).Msg("Failed to scan row")
+			return errors.Wrap(err, "failed to scan row")
+		}
+		entry.Account = store.AccountWallet
+
+		transaction := byID[entry.TransactionID]
+		transaction.Entries = append(transaction.Entries, &entry)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// GetUserLimits returns the limits an admin set for the user.
+func (repo *PostgresRepo) GetUserLimits(ctx context.Context, userid int64) ([]*store.Limit, error) {
+	sql := `SELECT operation, currency, daily, monthly FROM user_limits WHERE user_id = $1`
+
+	rows, err := repo.db.Query(ctx, sql, userid)
+	if err != nil {
+		repo.log.Error().Err(err).Int64("userID", userid).Msg("Failed to query user limits")
+		return nil, errors.Wrap(err, "failed to query user limits")
+	}
+	defer rows.Close()
+
+	var limits []*store.Limit
+	for rows.Next() {
+		var limit store.Limit
+		err = rows.Scan(&limit.Operation, &limit.Currency, &limit.Daily, &limit.Monthly)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		limits = append(limits, &limit)
+	}
+	return limits, rows.Err()
+}
+
+// SetUserLimit stores the user's own limit of the operation in the
+// currency. A limit without amounts removes it, so the configured limit
+// applies again.
+func (repo *PostgresRepo) SetUserLimit(ctx context.Context, userid int64, limit *store.Limit, entry *store.AuditEntry) error {
+	var (
+		sqlUser   = `SELECT 1 FROM users WHERE id = $1`
+		sqlDelete = `DELETE FROM user_limits WHERE user_id = $1 AND operation = $2 AND currency = $3`
+		sqlUpsert = `INSERT INTO user_limits (user_id, operation, currency, daily, monthly) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, operation, currency) DO UPDATE
+		SET daily = EXCLUDED.daily, monthly = EXCLUDED.monthly, updated_at = NOW()`
+	)
+
+	return repo.adminUpdate(ctx, entry, func(tx pgx.Tx) error {
+		var exists int
+		err := tx.QueryRow(ctx, sqlUser, userid).Scan(&exists)
+		if err == pgx.ErrNoRows {
+			return store.ErrUserNotFound
+		} else if err != nil {
+			return errors.Wrap(err, "failed to check user")
+		}
+
+		if !limit.Daily.Valid && !limit.Monthly.Valid {
+			_, err = tx.Exec(ctx, sqlDelete, userid, limit.Operation, limit.Currency)
+			return errors.Wrap(err, "failed to remove user limit")
+		}
+		_, err = tx.Exec(ctx, sqlUpsert, userid, limit.Operation, limit.Currency, limit.Daily, limit.Monthly)
+		return errors.Wrap(err, "failed to set user limit")
+	})
+}
+
+// limitOperation is the limited operation a transaction counts towards.
+// Funds sent to another user leave the user just like a withdrawal, so
+// transfers use up the withdrawal limit.
+const limitOperation = `CASE t.operation WHEN '` + store.OperationTransfer + `' THEN '` + store.OperationWithdraw + `' ELSE t.operation END`
+
+// GetLimitUsage returns what the user's withdrawals, transfers and exchanges
+// took out of every currency over the last day and the last 30 days.
+func (repo *PostgresRepo) GetLimitUsage(ctx context.Context, userid int64) ([]*store.LimitUsage, error) {
+	repo.log.Info().Int64("userID", userid).Msg("Fetching limit usage")
+
+	return repo.limitUsage(ctx, repo.db, userid, "", "")
+}
+
+// limitUsage sums the wallet debits of the limited operations, optionally
+// of one operation and currency only.
+func (repo *PostgresRepo) limitUsage(ctx context.Context, q querier, userid int64, operation, currency string) ([]*store.LimitUsage, error) {
+	sql := `SELECT
+	` + limitOperation + `,
+	le.currency,
+	COALESCE(SUM(le.debit) FILTER (WHERE t.created_at > NOW() - INTERVAL '1 day'), 0),
+	COALESCE(SUM(le.debit), 0)
+	FROM
+	ledger_entries le
+	INNER JOIN
+	transactions t
+	ON
+	le.transaction_id = t.id
+	INNER JOIN
+	wallets w
+	ON
+	t.wallet_id = w.id
+	WHERE
+	w.user_id = $1 AND
+	le.account = '` + store.AccountWallet + `' AND
+	t.operation IN ('` + store.OperationWithdraw + `', '` + store.OperationTransfer + `', '` + store.OperationExchange + `') AND
+	($2 = '' OR ` + limitOperation + ` = $2) AND
+	($3 = '' OR le.currency = $3) AND
+	t.created_at > NOW() - INTERVAL '30 days'
+	GROUP BY 1, le.currency`
+
+	rows, err := q.Query(ctx, sql, userid, operation, currency)
+	if err != nil {
+		repo.log.Error().Err(err).Int64("userID", userid).Msg("Failed to query limit usage")
+		return nil, errors.Wrap(err, "failed to query limit usage")
+	}
+	defer rows.Close()
+
+	var usage []*store.LimitUsage
+	for rows.Next() {
+		var u store.LimitUsage
+		err = rows.Scan(&u.Operation, &u.Currency, &u.Daily, &u.Monthly)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		usage = append(usage, &u)
+	}
+	return usage, rows.Err()
+}
+
+// checkLimit refuses a debit that would take the usage of the operation
+// over the limit. The usage spans all of the user's wallets, so the user
+// row is locked first and limited operations of one user are counted one
+// after another.
+func (repo *PostgresRepo) checkLimit(ctx context.Context, tx pgx.Tx, userid int64, limit *store.Limit, amount decimal.Decimal) error {
+	if limit == nil {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR NO KEY UPDATE`, userid)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock user")
+	}
+
+	usage, err := repo.limitUsage(ctx, tx, userid, limit.Operation, limit.Currency)
+	if err != nil {
+		return err
+	}
+	used := &store.LimitUsage{}
+	if len(usage) > 0 {
+		used = usage[0]
+	}
+
+	var period string
+	switch {
+	case limit.Daily.Valid && used.Daily.Add(amount).GreaterThan(limit.Daily.Decimal):
+		period = "daily"
+	case limit.Monthly.Valid && used.Monthly.Add(amount).GreaterThan(limit.Monthly.Decimal):
+		period = "monthly"
+	default:
+		return nil
+	}
+
+	repo.log.Warn().Int64("userID", userid).Str("operation", limit.Operation).Str("currency", limit.Currency).Str("period", period).Msg("Limit exceeded")
+	return errors.Wrapf(store.ErrLimitExceeded, "%s %s limit for %s", period, limit.Operation, limit.Currency)
+}
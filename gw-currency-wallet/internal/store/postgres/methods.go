@@ -2,25 +2,26 @@ package postgres
 
 import (
 	"context"
-	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/hasher"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 )
 
+// CreateUser creates the user with the primary wallet and its balances in
+// one transaction, so a failure leaves no half-created account behind. A
+// wallet gets a balance per enabled currency; with none enabled it starts
+// without balances and gets them with its first credits.
 func (repo *PostgresRepo) CreateUser(ctx context.Context, user *store.User) error {
 	var (
-		userID          int64
 		walletID        int64
 		sqlCreateUser   = `INSERT INTO users (username, email, password) VALUES ($1, $2, $3) returning id`
-		sqlCreateWallet = `INSERT INTO wallets (user_id) VALUES ($1) returning id`
+		sqlCreateWallet = `INSERT INTO wallets (user_id, is_primary) VALUES ($1, TRUE) returning id`
 		sqlSetBalances  = `INSERT INTO wallet_balances (wallet_id,currency,balance)
-            VALUES
-            ($1, 'RUB', 0),
-            ($1, 'EUR', 0),
-            ($1, 'USD', 0)`
+            SELECT $1, code, 0 FROM currencies WHERE enabled`
 	)
 
 	repo.log.Info().Str("username", user.Username).Str("email", user.Email).Msg("Starting user creation")
@@ -31,34 +32,49 @@ func (repo *PostgresRepo) CreateUser(ctx context.Context, user *store.User) erro
 		return err
 	}
 
-	repo.log.Info().Msg(hashedPassword)
+	err = repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, sqlCreateUser, user.Username, user.Email, hashedPassword).Scan(&user.ID)
+		if err != nil {
+			repo.log.Error().Err(err).Str("username", user.Username).Msg("Failed to insert user into database")
+			return explainUserConflict(err)
+		}
 
-	err = repo.db.QueryRow(ctx, sqlCreateUser, user.Username, user.Email, hashedPassword).Scan(&userID)
-	if err != nil {
-		repo.log.Error().Err(err).Str("username", user.Username).Msg("Failed to insert user into database")
-		return err
-	}
-	repo.log.Info().Int64("userID", userID).Msg("User created successfully")
+		err = tx.QueryRow(ctx, sqlCreateWallet, user.ID).Scan(&walletID)
+		if err != nil {
+			return errors.Wrap(err, "failed to create wallet")
+		}
 
-	err = repo.db.QueryRow(ctx, sqlCreateWallet, userID).Scan(&walletID)
+		_, err = tx.Exec(ctx, sqlSetBalances, walletID)
+		if err != nil {
+			return errors.Wrap(err, "failed to set initial wallet balances")
+		}
+		return nil
+	})
 	if err != nil {
-		repo.log.Error().Err(err).Int64("userID", userID).Msg("Failed to create wallet")
+		user.ID = 0
 		return err
 	}
-	repo.log.Info().Int64("walletID", walletID).Msg("Wallet created successfully")
 
-	row, err := repo.db.Exec(ctx, sqlSetBalances, walletID)
-	if err != nil {
-		repo.log.Error().Err(err).Int64("walletID", walletID).Msg("Failed to set initial wallet balances")
+	repo.log.Info().Int64("userID", user.ID).Int64("walletID", walletID).Msg("User and wallet setup completed successfully")
+	return nil
+}
+
+const uniqueViolation = "23505"
+
+// explainUserConflict turns a unique violation on users into the error of
+// the taken field.
+func explainUserConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
 		return err
 	}
-	if row.RowsAffected() == 0 {
-		repo.log.Warn().Int64("walletID", walletID).Msg("No balances were set, possible issue with wallet balance initialization")
-		return errors.New("setting wallet balance failed")
+	switch pgErr.ConstraintName {
+	case "users_username_key":
+		return store.ErrUsernameTaken
+	case "users_email_lower_key":
+		return store.ErrEmailTaken
 	}
-
-	repo.log.Info().Int64("userID", userID).Int64("walletID", walletID).Msg("User and wallet setup completed successfully")
-	return nil
+	return err
 }
 
 func (repo *PostgresRepo) Authentication(ctx context.Context, user *store.User) (int64, error) {
@@ -71,16 +87,19 @@ func (repo *PostgresRepo) Authentication(ctx context.Context, user *store.User)
 	repo.log.Info().Str("username", user.Username).Msg("Starting authentication")
 
 	err := repo.db.QueryRow(ctx, sql, user.Username).Scan(&userID, &password)
-	if err != nil {
-		repo.log.Warn().Str("username", user.Username).Err(err).Msg("Invalid credentials")
-		return 0, errors.Wrap(err, "invalid credentials")
+	if err == pgx.ErrNoRows {
+		repo.log.Warn().Str("username", user.Username).Msg("Invalid credentials")
+		return 0, store.ErrInvalidCredentials
+	} else if err != nil {
+		repo.log.Error().Str("username", user.Username).Err(err).Msg("Failed to authenticate")
+		return 0, errors.Wrap(err, "failed to authenticate")
 	}
 
 	repo.log.Debug().Int64("userID", userID).Msg("User found in database")
 
 	if !hasher.CheckPassword(user.Password, password) {
 		repo.log.Warn().Str("username", user.Username).Msg("Incorrect password")
-		return 0, errors.New("password is not correct")
+		return 0, store.ErrInvalidCredentials
 	}
 
 	repo.log.Info().Int64("userID", userID).Msg("Authentication successful")
@@ -89,7 +108,7 @@ func (repo *PostgresRepo) Authentication(ctx context.Context, user *store.User)
 
 func (repo *PostgresRepo) SetToken(ctx context.Context, refresh *store.RefreshToken) error {
 	repo.log.Info().Int64("userID", refresh.UserID).Msg("Setting refresh token")
-	err := repo.createRefreshToken(ctx, refresh.ExpiresAt, refresh.Hash, refresh.UserID)
+	err := repo.createRefreshToken(ctx, refresh)
 	if err != nil {
 		repo.log.Error().Err(err).Msg("Failed to set refresh token")
 		return errors.Wrap(err, "invalid refresh token")
@@ -97,11 +116,11 @@ func (repo *PostgresRepo) SetToken(ctx context.Context, refresh *store.RefreshTo
 	return nil
 }
 
-func (repo *PostgresRepo) createRefreshToken(ctx context.Context, expTime time.Time, refreshToken string, userid int64) error {
-	repo.log.Debug().Int64("userID", userid).Msg("Creating refresh token")
-	sql := `INSERT into refresh_tokens(user_id,token_hash,expires_at, revoked) VALUES
-	($1,$2,$3,false)`
-	_, err := repo.db.Exec(ctx, sql, userid, refreshToken, expTime)
+func (repo *PostgresRepo) createRefreshToken(ctx context.Context, refresh *store.RefreshToken) error {
+	repo.log.Debug().Int64("userID", refresh.UserID).Msg("Creating refresh token")
+	sql := `INSERT into refresh_tokens(user_id,token_hash,expires_at, revoked, user_agent, ip) VALUES
+	($1,$2,$3,false,$4,$5)`
+	_, err := repo.db.Exec(ctx, sql, refresh.UserID, tokenDigest(refresh.Token), refresh.ExpiresAt, refresh.UserAgent, refresh.IP)
 	if err != nil {
 		repo.log.Error().Err(err).Msg("Failed to create refresh token")
 	}
@@ -113,6 +132,7 @@ func (repo *PostgresRepo) GetSpecificCurrency(ctx context.Context, req *store.Cu
 	var (
 		sql = `SELECT
     	wb.id,
+    	wb.wallet_id,
     	wb.currency,
     	wb.balance
 		FROM
@@ -122,11 +142,11 @@ func (repo *PostgresRepo) GetSpecificCurrency(ctx context.Context, req *store.Cu
 		ON
     	wb.wallet_id = w.id
 		WHERE
-    	w.user_id = $1 AND
-    	wb.currency = $2;`
+    	` + walletCondition + ` AND
+    	wb.currency = $3;`
 		balance store.WalletCurrency
 	)
-	err := repo.db.QueryRow(ctx, sql, req.UserID, req.CurrencyCode).Scan(&balance.ID, &balance.Currency, &balance.Balance)
+	err := repo.db.QueryRow(ctx, sql, req.UserID, req.WalletID, req.CurrencyCode).Scan(&balance.ID, &balance.WalletID, &balance.Currency, &balance.Balance)
 	if err == pgx.ErrNoRows {
 		repo.log.Warn().Msg("Currency not found")
 		return nil, errors.New("currency not found")
@@ -138,25 +158,57 @@ func (repo *PostgresRepo) GetSpecificCurrency(ctx context.Context, req *store.Cu
 	return &balance, nil
 }
 
-func (repo *PostgresRepo) GetBalance(ctx context.Context, userid int64) ([]*store.WalletCurrency, error) {
-	repo.log.Info().Int64("userID", userid).Msg("Fetching wallet balance")
+// GetBalance returns the balances of one of the user's wallets, the primary
+// one for a zero wallet id.
+func (repo *PostgresRepo) GetBalance(ctx context.Context, userid, walletID int64) ([]*store.WalletCurrency, error) {
+	repo.log.Info().Int64("userID", userid).Int64("walletID", walletID).Msg("Fetching wallet balance")
 
+	balance, err := repo.balances(ctx, walletCondition, userid, walletID)
+	if err != nil {
+		return nil, err
+	}
+	if len(balance) > 0 {
+		return balance, nil
+	}
+
+	// no rows also means no enabled currency, the wallet itself may exist
+	var exists int
+	err = repo.db.QueryRow(ctx, `SELECT 1 FROM wallets w WHERE `+walletCondition, userid, walletID).Scan(&exists)
+	if err == pgx.ErrNoRows {
+		return nil, store.ErrWalletNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to query wallet")
+	}
+	return balance, nil
+}
+
+// balances lists the balances of the wallets w matching the condition.
+// Enabled currencies a wallet has no row in yet are listed with a zero
+// balance, the row itself is created by the first credit.
+func (repo *PostgresRepo) balances(ctx context.Context, condition string, args ...any) ([]*store.WalletCurrency, error) {
 	var (
 		sql = `SELECT
-    	wb.id,
-    	wb.currency,
-    	wb.balance
+    	COALESCE(wb.id, 0),
+    	w.id,
+    	c.code,
+    	COALESCE(wb.balance, 0),
+    	w.status
 		FROM
-    	wallet_balances wb
-		INNER JOIN
     	wallets w
+		CROSS JOIN
+    	currencies c
+		LEFT JOIN
+    	wallet_balances wb
 		ON
-    	wb.wallet_id = w.id
+    	wb.wallet_id = w.id AND wb.currency = c.code
 		WHERE
-    	w.user_id = $1;`
+    	` + condition + ` AND
+    	(c.enabled OR wb.id IS NOT NULL)
+		ORDER BY
+    	w.id, c.code;`
 		balance []*store.WalletCurrency
 	)
-	rows, err := repo.db.Query(ctx, sql, userid)
+	rows, err := repo.db.Query(ctx, sql, args...)
 	if err != nil {
 		repo.log.Error().Err(err).Msg("Failed to query wallet balances")
 		return nil, errors.Wrap(err, "failed to query wallet balances")
@@ -165,20 +217,23 @@ func (repo *PostgresRepo) GetBalance(ctx context.Context, userid int64) ([]*stor
 
 	for rows.Next() {
 		var currency store.WalletCurrency
-		err = rows.Scan(&currency.ID, &currency.Currency, &currency.Balance)
+		err = rows.Scan(&currency.ID, &currency.WalletID, &currency.Currency, &currency.Balance, &currency.WalletStatus)
 		if err != nil {
 			repo.log.Error().Err(err).Msg("Failed to scan row")
 			return nil, errors.Wrap(err, "failed to scan row")
 		}
 		balance = append(balance, &currency)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read wallet balances")
+	}
 	repo.log.Debug().Int("count", len(balance)).Msg("Wallet balance fetched successfully")
 	return balance, nil
 }
 
 func (repo *PostgresRepo) UpdateBalance(ctx context.Context, newBalance *store.UpdateBalance) error {
 	operator, err := repo.getOperator(newBalance.Operation)
-	repo.log.Info().Int64("userID", newBalance.UserID).Str("currency", newBalance.Currency).Str("operation", newBalance.Operation).Msg("Updating balance")
+	repo.log.Info().Int64("userID", newBalance.UserID).Int64("walletID", newBalance.WalletID).Str("currency", newBalance.Currency).Str("operation", newBalance.Operation).Msg("Updating balance")
 
 	if err != nil {
 
@@ -186,18 +241,46 @@ func (repo *PostgresRepo) UpdateBalance(ctx context.Context, newBalance *store.U
 		return err
 	}
 
-	return repo.updateBalance(
-		ctx, newBalance.Amount,
-		newBalance.UserID, newBalance.Currency,
-		operator)
+	return repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		walletID, err := repo.walletFor(ctx, tx, newBalance.UserID, newBalance.WalletID, operator == "-")
+		if err != nil {
+			return err
+		}
+		if operator == "+" {
+			err = repo.ensureBalance(ctx, tx, walletID, newBalance.Currency)
+			if err != nil {
+				return err
+			}
+		}
+		if newBalance.Limit != nil {
+			err = repo.lockBalances(ctx, tx, walletID, newBalance.Currency)
+			if err != nil {
+				return err
+			}
+			err = repo.checkLimit(ctx, tx, newBalance.UserID, newBalance.Limit, newBalance.Amount)
+			if err != nil {
+				return err
+			}
+		}
+
+		balance, err := repo.updateBalance(
+			ctx, tx, newBalance.Amount,
+			walletID, newBalance.Currency,
+			operator)
+		if err != nil {
+			return err
+		}
+
+		return repo.recordTransaction(ctx, tx, balanceChangeTransaction(newBalance.Operation, balance, newBalance.Amount))
+	})
 }
 
 func (repo *PostgresRepo) getOperator(operation string) (string, error) {
 	var operator string
 	switch operation {
-	case "deposit":
+	case store.OperationDeposit:
 		operator = "+"
-	case "withdraw":
+	case store.OperationWithdraw:
 		operator = "-"
 	default:
 		return "", errors.New("invalid operation")
@@ -205,81 +288,218 @@ func (repo *PostgresRepo) getOperator(operation string) (string, error) {
 	return operator, nil
 }
 
-func (repo *PostgresRepo) updateBalance(ctx context.Context, amount float64, userid int64, currency, operator string) error {
-	sql := repo.getSqlForChangeBalance(operator)
+// updateBalance applies the change with a single UPDATE. Debits only match
+// when the balance covers the amount, so the check and the write cannot be
+// split by a concurrent transaction.
+func (repo *PostgresRepo) updateBalance(ctx context.Context, tx pgx.Tx, amount decimal.Decimal, walletID int64, currency, operator string) (*store.WalletCurrency, error) {
+	var (
+		sql     = repo.getSqlForChangeBalance(operator)
+		balance store.WalletCurrency
+	)
 
-	row, err := repo.db.Exec(ctx, sql, amount, currency, userid)
-	if err != nil {
-		return errors.Wrap(err, "failed to update balance")
+	err := tx.QueryRow(ctx, sql, amount, currency, walletID).Scan(&balance.ID, &balance.WalletID, &balance.Currency, &balance.Balance)
+	if err == pgx.ErrNoRows {
+		return nil, repo.explainNotUpdated(ctx, tx, walletID, currency)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to update %s balance", currency)
 	}
-	if row.RowsAffected() == 0 {
+	return &balance, nil
+}
+
+func (repo *PostgresRepo) explainNotUpdated(ctx context.Context, tx pgx.Tx, walletID int64, currency string) error {
+	sql := `SELECT 1 FROM wallet_balances WHERE wallet_id = $1 AND currency = $2`
+
+	var exists int
+	err := tx.QueryRow(ctx, sql, walletID, currency).Scan(&exists)
+	if err == pgx.ErrNoRows {
 		return errors.New("user or currency not found")
+	} else if err != nil {
+		return errors.Wrap(err, "failed to query currency")
 	}
-	return nil
+	repo.log.Warn().Int64("walletID", walletID).Str("currency", currency).Msg("Insufficient funds")
+	return store.ErrInsufficientFunds
 }
 
 func (repo *PostgresRepo) getSqlForChangeBalance(operator string) string {
-	return `WITH wallet_ids AS (
-    SELECT id
-    FROM wallets
-    WHERE user_id = $3
-)
-UPDATE wallet_balances
-SET balance = balance ` + operator + ` $1
+	condition := ""
+	if operator == "-" {
+		condition = `
+AND balance >= $1::numeric`
+	}
+
+	return `UPDATE wallet_balances
+SET balance = balance ` + operator + ` $1::numeric
 WHERE currency = $2
-AND wallet_id IN (SELECT id FROM wallet_ids);`
+AND wallet_id = $3` + condition + `
+RETURNING id, wallet_id, currency, balance;`
 }
 
-func (repo *PostgresRepo) ExchangeCurrency(ctx context.Context, exchangeBody *store.ExchangeBalance) error {
-	repo.log.Info().Int64("userID", exchangeBody.UserID).Str("from", exchangeBody.FromCurrency).Str("to", exchangeBody.ToCurrency).Msg("Starting currency exchange")
-	tx, err := repo.db.Begin(ctx)
+// lockBalances takes row locks on the given currencies of the wallet in id
+// order, so concurrent multi-row updates never deadlock.
+func (repo *PostgresRepo) lockBalances(ctx context.Context, tx pgx.Tx, walletID int64, currencies ...string) error {
+	sql := `SELECT id
+	FROM wallet_balances
+	WHERE wallet_id = $1 AND currency = ANY($2)
+	ORDER BY id
+	FOR UPDATE`
+
+	rows, err := tx.Query(ctx, sql, walletID, currencies)
 	if err != nil {
-		repo.log.Error().Err(err).Msg("Failed to begin transaction")
-		return errors.Wrap(err, "failed to begin transaction")
+		return errors.Wrap(err, "failed to lock balances")
 	}
-	defer func() {
-		if err != nil {
-			repo.log.Error().Err(err).Msg("Rolling back transaction")
-			_ = tx.Rollback(ctx)
-		}
-	}()
-	err = repo.makeExchange(ctx, tx, exchangeBody)
+	rows.Close()
+	return rows.Err()
+}
+
+func (repo *PostgresRepo) ExchangeCurrency(ctx context.Context, exchangeBody *store.ExchangeBalance) error {
+	repo.log.Info().Int64("userID", exchangeBody.UserID).Str("from", exchangeBody.FromCurrency).Str("to", exchangeBody.ToCurrency).Msg("Starting currency exchange")
+
+	err := repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		return repo.makeExchange(ctx, tx, exchangeBody)
+	})
 	if err != nil {
 		return err
 	}
-	err = tx.Commit(ctx)
-	if err != nil {
-		repo.log.Error().Err(err).Msg("Failed to commit transaction")
-		return errors.Wrap(err, "failed to commit transaction")
-	}
 	repo.log.Info().Msg("Currency exchange completed successfully")
 	return nil
 }
 
 func (repo *PostgresRepo) makeExchange(ctx context.Context, tx pgx.Tx, exchangeBody *store.ExchangeBalance) error {
-	_, err := tx.Exec(ctx, repo.getSqlForChangeBalance("-"), exchangeBody.FromAmount, exchangeBody.FromCurrency, exchangeBody.UserID)
+	walletID, err := repo.walletFor(ctx, tx, exchangeBody.UserID, exchangeBody.WalletID, true)
+	if err != nil {
+		return err
+	}
+	err = repo.ensureBalance(ctx, tx, walletID, exchangeBody.ToCurrency)
 	if err != nil {
-		return errors.Wrapf(err, "failed to update %s balance", exchangeBody.FromCurrency)
+		return err
 	}
-	_, err = tx.Exec(ctx, repo.getSqlForChangeBalance("+"), exchangeBody.ToAmount, exchangeBody.ToCurrency, exchangeBody.UserID)
+	err = repo.lockBalances(ctx, tx, walletID, exchangeBody.FromCurrency, exchangeBody.ToCurrency)
+	if err != nil {
+		return err
+	}
+	err = repo.checkLimit(ctx, tx, exchangeBody.UserID, exchangeBody.Limit, exchangeBody.FromAmount)
+	if err != nil {
+		return err
+	}
+	from, err := repo.updateBalance(ctx, tx, exchangeBody.FromAmount, walletID, exchangeBody.FromCurrency, "-")
+	if err != nil {
+		return err
+	}
+	to, err := repo.updateBalance(ctx, tx, exchangeBody.ToAmount, walletID, exchangeBody.ToCurrency, "+")
 	if err != nil {
 		return errors.Wrap(err, "failed to update target currency balance")
 	}
+	return repo.recordTransaction(ctx, tx, exchangeTransaction(from, to, exchangeBody))
+}
+
+func (repo *PostgresRepo) Transfer(ctx context.Context, transfer *store.Transfer) error {
+	repo.log.Info().Int64("userID", transfer.FromUserID).Str("from", transfer.FromCurrency).Str("to", transfer.ToCurrency).Msg("Starting transfer")
+
+	err := repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		return repo.makeTransfer(ctx, tx, transfer)
+	})
+	if err != nil {
+		return err
+	}
+	repo.log.Info().Msg("Transfer completed successfully")
 	return nil
 }
 
+func (repo *PostgresRepo) makeTransfer(ctx context.Context, tx pgx.Tx, transfer *store.Transfer) error {
+	recipientID, err := repo.findRecipient(ctx, tx, transfer.Recipient)
+	if err != nil {
+		return err
+	}
+	if recipientID == transfer.FromUserID {
+		return store.ErrTransferToYourself
+	}
+
+	fromWalletID, err := repo.walletFor(ctx, tx, transfer.FromUserID, transfer.FromWalletID, true)
+	if err != nil {
+		return err
+	}
+	toWalletID, err := repo.walletFor(ctx, tx, recipientID, 0, false)
+	if errors.Is(err, store.ErrWalletClosed) {
+		return store.ErrRecipientClosed
+	} else if err != nil {
+		return err
+	}
+
+	err = repo.ensureBalance(ctx, tx, toWalletID, transfer.ToCurrency)
+	if err != nil {
+		return err
+	}
+	err = repo.lockTransferBalances(ctx, tx, fromWalletID, transfer.FromCurrency, toWalletID, transfer.ToCurrency)
+	if err != nil {
+		return err
+	}
+	err = repo.checkLimit(ctx, tx, transfer.FromUserID, transfer.Limit, transfer.FromAmount)
+	if err != nil {
+		return err
+	}
+	from, err := repo.updateBalance(ctx, tx, transfer.FromAmount, fromWalletID, transfer.FromCurrency, "-")
+	if err != nil {
+		return err
+	}
+	to, err := repo.updateBalance(ctx, tx, transfer.ToAmount, toWalletID, transfer.ToCurrency, "+")
+	if err != nil {
+		return errors.Wrap(err, "failed to update recipient balance")
+	}
+
+	outgoing, incoming := transferTransactions(from, to, transfer)
+	err = repo.recordTransaction(ctx, tx, outgoing)
+	if err != nil {
+		return err
+	}
+	return repo.recordTransaction(ctx, tx, incoming)
+}
+
+// findRecipient resolves a username or an email to the user id. Emails are
+// matched regardless of case.
+func (repo *PostgresRepo) findRecipient(ctx context.Context, tx pgx.Tx, recipient string) (int64, error) {
+	sql := `SELECT id FROM users WHERE username = $1 OR lower(email) = lower($1) ORDER BY username = $1 DESC LIMIT 1`
+
+	var userID int64
+	err := tx.QueryRow(ctx, sql, recipient).Scan(&userID)
+	if err == pgx.ErrNoRows {
+		repo.log.Warn().Str("recipient", recipient).Msg("Recipient not found")
+		return 0, store.ErrRecipientNotFound
+	} else if err != nil {
+		return 0, errors.Wrap(err, "failed to query recipient")
+	}
+	return userID, nil
+}
+
+// lockTransferBalances locks the source and the target balance rows in id
+// order, so transfers and moves running in opposite directions never
+// deadlock.
+func (repo *PostgresRepo) lockTransferBalances(ctx context.Context, tx pgx.Tx, fromWalletID int64, fromCurrency string, toWalletID int64, toCurrency string) error {
+	sql := `SELECT id
+	FROM wallet_balances
+	WHERE (wallet_id = $1 AND currency = $2) OR (wallet_id = $3 AND currency = $4)
+	ORDER BY id
+	FOR UPDATE`
+
+	rows, err := tx.Query(ctx, sql, fromWalletID, fromCurrency, toWalletID, toCurrency)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock balances")
+	}
+	rows.Close()
+	return rows.Err()
+}
+
 func (repo *PostgresRepo) CheckRefreshToken(ctx context.Context, token *store.RefreshToken) error {
-	repo.log.Debug().Int64("user_id", token.UserID).Str("token_hash", token.Hash).Msg("Checking refresh token")
+	repo.log.Debug().Int64("user_id", token.UserID).Msg("Checking refresh token")
 
-	sql := `SELECT 1
+	sql := `SELECT revoked
 FROM refresh_tokens
 WHERE user_id = $1
   AND token_hash = $2
   AND expires_at > NOW()
 LIMIT 1;`
 
-	var exists int
-	err := repo.db.QueryRow(ctx, sql, token.UserID, token.Hash).Scan(&exists)
+	var revoked bool
+	err := repo.db.QueryRow(ctx, sql, token.UserID, tokenDigest(token.Token)).Scan(&revoked)
 	if err == pgx.ErrNoRows {
 		repo.log.Warn().Int64("user_id", token.UserID).Msg("Refresh token not found or expired")
 		return errors.New("token not found")
@@ -288,7 +508,7 @@ LIMIT 1;`
 		return errors.Wrap(err, "failed to check refresh token")
 	}
 
-	if exists == 0 {
+	if revoked {
 		repo.log.Warn().Int64("user_id", token.UserID).Msg("Token has been revoked")
 		return errors.New("token has been revoked")
 	}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+func (repo *PostgresRepo) GetMFA(ctx context.Context, userid int64) (*store.MFA, error) {
+	sql := `SELECT user_id, secret, enabled_at, last_used_step FROM user_mfa WHERE user_id = $1`
+
+	mfa := &store.MFA{}
+	err := repo.db.QueryRow(ctx, sql, userid).Scan(&mfa.UserID, &mfa.Secret, &mfa.EnabledAt, &mfa.LastUsedStep)
+	if err == pgx.ErrNoRows {
+		return nil, store.ErrMFANotEnabled
+	} else if err != nil {
+		repo.log.Error().Err(err).Int64("userID", userid).Msg("Failed to get MFA")
+		return nil, errors.Wrap(err, "failed to get MFA")
+	}
+	return mfa, nil
+}
+
+// SetMFASecret stores a new secret waiting for confirmation, replacing an
+// unconfirmed one. A confirmed secret is never replaced.
+func (repo *PostgresRepo) SetMFASecret(ctx context.Context, userid int64, secret string) error {
+	repo.log.Info().Int64("userID", userid).Msg("Setting MFA secret")
+
+	sql := `INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+	WHERE user_mfa.enabled_at IS NULL`
+
+	tag, err := repo.db.Exec(ctx, sql, userid, secret)
+	if err != nil {
+		repo.log.Error().Err(err).Int64("userID", userid).Msg("Failed to set MFA secret")
+		return errors.Wrap(err, "failed to set MFA secret")
+	}
+	if tag.RowsAffected() == 0 {
+		return store.ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableMFA confirms the secret with the step of the first code and stores
+// the recovery codes.
+func (repo *PostgresRepo) EnableMFA(ctx context.Context, userid, step int64, recoveryCodes []string) error {
+	sql := `UPDATE user_mfa SET enabled_at = NOW(), last_used_step = $2
+	WHERE user_id = $1 AND enabled_at IS NULL AND last_used_step < $2`
+
+	err := repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sql, userid, step)
+		if err != nil {
+			return errors.Wrap(err, "failed to enable MFA")
+		}
+		if tag.RowsAffected() == 0 {
+			return store.ErrInvalidMFACode
+		}
+		return repo.replaceRecoveryCodes(ctx, tx, userid, recoveryCodes)
+	})
+	if err != nil {
+		repo.log.Warn().Err(err).Int64("userID", userid).Msg("Failed to enable MFA")
+		return err
+	}
+
+	repo.log.Info().Int64("userID", userid).Msg("MFA enabled")
+	return nil
+}
+
+func (repo *PostgresRepo) DisableMFA(ctx context.Context, userid int64) error {
+	repo.log.Info().Int64("userID", userid).Msg("Disabling MFA")
+
+	return repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userid); err != nil {
+			return errors.Wrap(err, "failed to delete recovery codes")
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userid); err != nil {
+			return errors.Wrap(err, "failed to disable MFA")
+		}
+		return nil
+	})
+}
+
+// UseTOTPStep accepts a code of the step only if no code of this or a later
+// step was accepted before.
+func (repo *PostgresRepo) UseTOTPStep(ctx context.Context, userid, step int64) error {
+	sql := `UPDATE user_mfa SET last_used_step = $2
+	WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2`
+
+	tag, err := repo.db.Exec(ctx, sql, userid, step)
+	if err != nil {
+		repo.log.Error().Err(err).Int64("userID", userid).Msg("Failed to use TOTP code")
+		return errors.Wrap(err, "failed to use TOTP code")
+	}
+	if tag.RowsAffected() == 0 {
+		repo.log.Warn().Int64("userID", userid).Msg("TOTP code reused")
+		return store.ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (repo *PostgresRepo) UseRecoveryCode(ctx context.Context, userid int64, code string) error {
+	sql := `UPDATE mfa_recovery_codes SET used_at = NOW()
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	tag, err := repo.db.Exec(ctx, sql, userid, tokenDigest(code))
+	if err != nil {
+		repo.log.Error().Err(err).Int64("userID", userid).Msg("Failed to use recovery code")
+		return errors.Wrap(err, "failed to use recovery code")
+	}
+	if tag.RowsAffected() == 0 {
+		return store.ErrInvalidMFACode
+	}
+
+	repo.log.Info().Int64("userID", userid).Msg("Recovery code used")
+	return nil
+}
+
+func (repo *PostgresRepo) ReplaceRecoveryCodes(ctx context.Context, userid int64, codes []string) error {
+	repo.log.Info().Int64("userID", userid).Msg("Replacing recovery codes")
+
+	return repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		return repo.replaceRecoveryCodes(ctx, tx, userid, codes)
+	})
+}
+
+func (repo *PostgresRepo) replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userid int64, codes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userid); err != nil {
+		return errors.Wrap(err, "failed to delete recovery codes")
+	}
+
+	sql := `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, code := range codes {
+		if _, err := tx.Exec(ctx, sql, userid, tokenDigest(code)); err != nil {
+			return errors.Wrap(err, "failed to store recovery code")
+		}
+	}
+	return nil
+}
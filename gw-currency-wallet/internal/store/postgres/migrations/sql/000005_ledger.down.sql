@@ -0,0 +1,4 @@
+DROP VIEW IF EXISTS wallet_balance_reconciliation;
+DROP TABLE IF EXISTS ledger_entries;
+DROP FUNCTION IF EXISTS check_transaction_balanced();
+DROP TABLE IF EXISTS transactions;
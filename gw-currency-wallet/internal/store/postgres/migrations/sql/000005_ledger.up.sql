@@ -0,0 +1,88 @@
+-- migrations/005_ledger.up.sql
+
+CREATE TABLE transactions (
+    id BIGSERIAL PRIMARY KEY,
+    wallet_id BIGINT NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (wallet_id) REFERENCES wallets(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_transactions_wallet_id ON transactions(wallet_id, created_at);
+
+-- Every balance change is written as a set of entries that sum to zero per
+-- currency. Wallet entries point at the balance row they move, the
+-- counterpart accounts ('cash', 'exchange', 'opening') are external.
+CREATE TABLE ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL,
+    account VARCHAR(20) NOT NULL,
+    balance_id BIGINT,
+    currency VARCHAR(10) NOT NULL,
+    debit DECIMAL(20, 2) NOT NULL DEFAULT 0.00,
+    credit DECIMAL(20, 2) NOT NULL DEFAULT 0.00,
+    balance_after DECIMAL(20, 2),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (debit >= 0 AND credit >= 0 AND (debit = 0) <> (credit = 0)),
+    CHECK ((account = 'wallet') = (balance_id IS NOT NULL)),
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE,
+    FOREIGN KEY (balance_id) REFERENCES wallet_balances(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_ledger_entries_transaction_id ON ledger_entries(transaction_id);
+CREATE INDEX idx_ledger_entries_balance_id ON ledger_entries(balance_id);
+
+CREATE OR REPLACE FUNCTION check_transaction_balanced()
+RETURNS TRIGGER AS $$
+BEGIN
+  IF EXISTS (
+    SELECT 1
+    FROM ledger_entries
+    WHERE transaction_id = NEW.transaction_id
+    GROUP BY currency
+    HAVING SUM(debit) <> SUM(credit)
+  ) THEN
+    RAISE EXCEPTION 'transaction % is not balanced', NEW.transaction_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced
+AFTER INSERT ON ledger_entries
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW
+EXECUTE FUNCTION check_transaction_balanced();
+
+CREATE VIEW wallet_balance_reconciliation AS
+SELECT
+    wb.id AS balance_id,
+    wb.wallet_id,
+    wb.currency,
+    wb.balance,
+    COALESCE(SUM(le.credit - le.debit), 0) AS ledger_balance
+FROM
+    wallet_balances wb
+LEFT JOIN
+    ledger_entries le
+ON
+    le.balance_id = wb.id
+GROUP BY
+    wb.id;
+
+-- Balances that existed before the ledger are brought in as opening entries.
+WITH opening AS (
+    INSERT INTO transactions (wallet_id, operation)
+    SELECT DISTINCT wallet_id, 'opening'
+    FROM wallet_balances
+    WHERE balance <> 0
+    RETURNING id, wallet_id
+)
+INSERT INTO ledger_entries (transaction_id, account, balance_id, currency, debit, credit, balance_after)
+SELECT o.id, 'wallet', wb.id, wb.currency, GREATEST(-wb.balance, 0), GREATEST(wb.balance, 0), wb.balance
+FROM opening o
+INNER JOIN wallet_balances wb ON wb.wallet_id = o.wallet_id AND wb.balance <> 0
+UNION ALL
+SELECT o.id, 'opening', NULL, wb.currency, GREATEST(wb.balance, 0), GREATEST(-wb.balance, 0), NULL
+FROM opening o
+INNER JOIN wallet_balances wb ON wb.wallet_id = o.wallet_id AND wb.balance <> 0;
@@ -0,0 +1,5 @@
+-- migrations/006_transactions_history.up.sql
+
+ALTER TABLE transactions ADD COLUMN rate DECIMAL(20, 8);
+
+CREATE INDEX idx_transactions_wallet_id_id ON transactions(wallet_id, id DESC);
@@ -0,0 +1 @@
+ALTER TABLE wallet_balances DROP CONSTRAINT IF EXISTS wallet_balances_balance_non_negative;
@@ -0,0 +1,4 @@
+-- migrations/007_non_negative_balance.up.sql
+
+ALTER TABLE wallet_balances
+    ADD CONSTRAINT wallet_balances_balance_non_negative CHECK (balance >= 0);
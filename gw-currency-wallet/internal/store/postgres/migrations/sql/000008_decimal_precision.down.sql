@@ -0,0 +1,26 @@
+DROP VIEW IF EXISTS wallet_balance_reconciliation;
+
+ALTER TABLE transactions ALTER COLUMN rate TYPE DECIMAL(20, 8);
+
+ALTER TABLE ledger_entries
+    ALTER COLUMN debit TYPE DECIMAL(20, 2),
+    ALTER COLUMN credit TYPE DECIMAL(20, 2),
+    ALTER COLUMN balance_after TYPE DECIMAL(20, 2);
+
+ALTER TABLE wallet_balances ALTER COLUMN balance TYPE DECIMAL(20, 2);
+
+CREATE VIEW wallet_balance_reconciliation AS
+SELECT
+    wb.id AS balance_id,
+    wb.wallet_id,
+    wb.currency,
+    wb.balance,
+    COALESCE(SUM(le.credit - le.debit), 0) AS ledger_balance
+FROM
+    wallet_balances wb
+LEFT JOIN
+    ledger_entries le
+ON
+    le.balance_id = wb.id
+GROUP BY
+    wb.id;
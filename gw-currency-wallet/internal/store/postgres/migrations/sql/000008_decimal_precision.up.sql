@@ -0,0 +1,30 @@
+-- migrations/008_decimal_precision.up.sql
+
+-- Amounts are rounded per currency by the application, the columns only
+-- have to be wide enough for any currency's minor units.
+DROP VIEW IF EXISTS wallet_balance_reconciliation;
+
+ALTER TABLE wallet_balances ALTER COLUMN balance TYPE DECIMAL(28, 8);
+
+ALTER TABLE ledger_entries
+    ALTER COLUMN debit TYPE DECIMAL(28, 8),
+    ALTER COLUMN credit TYPE DECIMAL(28, 8),
+    ALTER COLUMN balance_after TYPE DECIMAL(28, 8);
+
+ALTER TABLE transactions ALTER COLUMN rate TYPE DECIMAL(30, 10);
+
+CREATE VIEW wallet_balance_reconciliation AS
+SELECT
+    wb.id AS balance_id,
+    wb.wallet_id,
+    wb.currency,
+    wb.balance,
+    COALESCE(SUM(le.credit - le.debit), 0) AS ledger_balance
+FROM
+    wallet_balances wb
+LEFT JOIN
+    ledger_entries le
+ON
+    le.balance_id = wb.id
+GROUP BY
+    wb.id;
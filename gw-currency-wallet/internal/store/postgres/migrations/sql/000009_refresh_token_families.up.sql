@@ -0,0 +1,15 @@
+-- migrations/009_refresh_token_families.up.sql
+
+-- A family is the chain of refresh tokens issued from one login: every
+-- rotation keeps the family, so a reused token can revoke the whole chain.
+CREATE SEQUENCE refresh_token_family_seq;
+
+ALTER TABLE refresh_tokens ADD COLUMN family_id BIGINT;
+
+UPDATE refresh_tokens SET family_id = nextval('refresh_token_family_seq');
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN family_id SET DEFAULT nextval('refresh_token_family_seq'),
+    ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,12 @@
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS ip,
+    DROP COLUMN IF EXISTS last_used_at;
+
+DROP INDEX IF EXISTS idx_refresh_tokens_user_id;
+DROP INDEX IF EXISTS idx_refresh_tokens_token_hash;
+
+-- digests cannot be turned back into tokens, every session has to log in again
+DELETE FROM refresh_tokens;
+
+CREATE INDEX idx_refresh_tokens ON refresh_tokens (user_id, token_hash, expires_at);
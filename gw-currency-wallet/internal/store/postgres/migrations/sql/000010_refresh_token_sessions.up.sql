@@ -0,0 +1,28 @@
+-- migrations/010_refresh_token_sessions.up.sql
+
+-- Only a SHA-256 digest of a refresh token is kept. Tokens issued before
+-- this migration are digested in place, so existing sessions survive.
+UPDATE refresh_tokens SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+-- The old index did not make tokens unique, and two logins of one user in
+-- the same second were issued the same token. One row is kept per token,
+-- revoked if any of its copies was, before the unique index is built.
+UPDATE refresh_tokens r SET revoked = TRUE
+WHERE r.revoked IS NOT TRUE AND EXISTS (
+    SELECT 1 FROM refresh_tokens d
+    WHERE d.token_hash = r.token_hash AND d.id <> r.id AND d.revoked
+);
+
+DELETE FROM refresh_tokens r
+USING refresh_tokens d
+WHERE r.token_hash = d.token_hash AND r.id < d.id;
+
+DROP INDEX IF EXISTS idx_refresh_tokens;
+
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens(token_hash);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id, expires_at);
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+    ADD COLUMN ip VARCHAR(45) NOT NULL DEFAULT '',
+    ADD COLUMN last_used_at TIMESTAMP;
@@ -0,0 +1,29 @@
+-- migrations/011_case_insensitive_email.up.sql
+
+-- Emails are stored case-folded and unique regardless of case. Addresses
+-- that differ only in case belong to separate accounts, possibly with funds,
+-- and have to be merged by hand: the migration stops and names them before
+-- anything is changed.
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(email, ', ' ORDER BY email) INTO duplicates
+    FROM (
+        SELECT lower(btrim(email)) AS email
+        FROM users
+        GROUP BY 1
+        HAVING COUNT(*) > 1
+    ) d;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'emails used by more than one account regardless of case: %', duplicates
+            USING HINT = 'merge or change these accounts before running the migration';
+    END IF;
+END $$;
+
+UPDATE users SET email = lower(btrim(email));
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+
+CREATE UNIQUE INDEX users_email_lower_key ON users (lower(email));
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS admin_audit_log;
+
+ALTER TABLE users DROP COLUMN IF EXISTS frozen_at;
+
+ALTER TABLE users DROP COLUMN IF EXISTS role;
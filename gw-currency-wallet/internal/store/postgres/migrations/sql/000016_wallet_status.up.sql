@@ -0,0 +1,4 @@
+-- migrations/016_wallet_status.up.sql
+
+ALTER TABLE wallets ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'frozen', 'closed'));
@@ -0,0 +1,13 @@
+-- migrations/017_user_limits.up.sql
+
+-- Limits an admin set for a single user. A null amount falls back to the
+-- configured limit of the period.
+CREATE TABLE user_limits (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    operation VARCHAR(20) NOT NULL CHECK (operation IN ('withdraw', 'exchange')),
+    currency VARCHAR(10) NOT NULL,
+    daily DECIMAL(28, 8) CHECK (daily >= 0),
+    monthly DECIMAL(28, 8) CHECK (monthly >= 0),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, operation, currency)
+);
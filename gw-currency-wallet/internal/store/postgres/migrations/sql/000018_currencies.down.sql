@@ -0,0 +1,2 @@
+ALTER TABLE wallet_balances DROP CONSTRAINT IF EXISTS wallet_balances_currency_fkey;
+DROP TABLE IF EXISTS currencies;
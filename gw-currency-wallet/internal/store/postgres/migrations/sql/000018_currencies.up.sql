@@ -0,0 +1,20 @@
+-- migrations/018_currencies.up.sql
+
+-- The currencies the service works with. Wallets get a balance in every
+-- enabled currency; a disabled currency can still be withdrawn and
+-- exchanged from, but no funds come into it.
+CREATE TABLE currencies (
+    code VARCHAR(10) PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    minor_units SMALLINT NOT NULL DEFAULT 2 CHECK (minor_units BETWEEN 0 AND 8),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO currencies (code, name, minor_units) VALUES
+    ('RUB', 'Russian ruble', 2),
+    ('EUR', 'Euro', 2),
+    ('USD', 'US dollar', 2);
+
+ALTER TABLE wallet_balances ADD CONSTRAINT wallet_balances_currency_fkey
+    FOREIGN KEY (currency) REFERENCES currencies(code);
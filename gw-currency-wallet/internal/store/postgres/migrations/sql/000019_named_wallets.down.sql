@@ -0,0 +1,48 @@
+-- Additional wallets are merged into the primary wallet of their user before
+-- they are removed: their funds are added to the primary balances and their
+-- ledger entries and transactions move along, so the ledger still matches
+-- the balances. Moves between the wallets of one user have nothing left to
+-- record once the wallets are merged and are removed as a whole.
+INSERT INTO wallet_balances (wallet_id, currency, balance)
+SELECT DISTINCT p.id, wb.currency, 0
+FROM wallet_balances wb
+JOIN wallets w ON w.id = wb.wallet_id AND NOT w.is_primary
+JOIN wallets p ON p.user_id = w.user_id AND p.is_primary
+ON CONFLICT (wallet_id, currency) DO NOTHING;
+
+UPDATE wallet_balances pb
+SET balance = pb.balance + merged.total
+FROM (
+    SELECT p.id AS wallet_id, wb.currency, SUM(wb.balance) AS total
+    FROM wallet_balances wb
+    JOIN wallets w ON w.id = wb.wallet_id AND NOT w.is_primary
+    JOIN wallets p ON p.user_id = w.user_id AND p.is_primary
+    GROUP BY p.id, wb.currency
+) merged
+WHERE pb.wallet_id = merged.wallet_id AND pb.currency = merged.currency;
+
+UPDATE ledger_entries le
+SET balance_id = pb.id
+FROM wallet_balances wb
+JOIN wallets w ON w.id = wb.wallet_id AND NOT w.is_primary
+JOIN wallets p ON p.user_id = w.user_id AND p.is_primary
+JOIN wallet_balances pb ON pb.wallet_id = p.id AND pb.currency = wb.currency
+WHERE le.balance_id = wb.id;
+
+UPDATE transactions t
+SET wallet_id = p.id
+FROM wallets w
+JOIN wallets p ON p.user_id = w.user_id AND p.is_primary
+WHERE t.wallet_id = w.id AND NOT w.is_primary;
+
+DELETE FROM transactions WHERE operation = 'move';
+
+DELETE FROM wallets WHERE NOT is_primary;
+
+DROP INDEX IF EXISTS wallets_user_name_key;
+DROP INDEX IF EXISTS wallets_user_primary_key;
+
+ALTER TABLE wallets DROP COLUMN IF EXISTS is_primary;
+ALTER TABLE wallets DROP COLUMN IF EXISTS name;
+
+ALTER TABLE wallets ADD CONSTRAINT wallets_user_id_key UNIQUE (user_id);
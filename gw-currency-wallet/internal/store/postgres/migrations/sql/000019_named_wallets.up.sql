@@ -0,0 +1,13 @@
+-- migrations/019_named_wallets.up.sql
+
+-- A user can have several named wallets. The wallet created with the
+-- account is the primary one; requests that name no wallet go to it.
+ALTER TABLE wallets DROP CONSTRAINT wallets_user_id_key;
+
+ALTER TABLE wallets ADD COLUMN name VARCHAR(64) NOT NULL DEFAULT 'Main';
+ALTER TABLE wallets ADD COLUMN is_primary BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE wallets SET is_primary = TRUE;
+
+CREATE UNIQUE INDEX wallets_user_primary_key ON wallets(user_id) WHERE is_primary;
+CREATE UNIQUE INDEX wallets_user_name_key ON wallets(user_id, lower(name));
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/hasher"
+	"github.com/pkg/errors"
+)
+
+func (repo *PostgresRepo) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	sql := `SELECT ` + userColumns + ` FROM users u WHERE lower(u.email) = lower($1)`
+
+	user, err := scanUser(repo.db.QueryRow(ctx, sql, email))
+	if err == pgx.ErrNoRows {
+		return nil, store.ErrUserNotFound
+	} else if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to get user by email")
+		return nil, errors.Wrap(err, "failed to get user")
+	}
+	return user, nil
+}
+
+func (repo *PostgresRepo) CreatePasswordReset(ctx context.Context, reset *store.PasswordReset) error {
+	repo.log.Info().Int64("userID", reset.UserID).Msg("Creating password reset token")
+
+	sql := `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	_, err := repo.db.Exec(ctx, sql, reset.UserID, tokenDigest(reset.Token), reset.ExpiresAt)
+	if err != nil {
+		repo.log.Error().Err(err).Int64("userID", reset.UserID).Msg("Failed to create password reset token")
+		return errors.Wrap(err, "failed to create password reset token")
+	}
+	return nil
+}
+
+// GetPasswordReset returns the user a usable reset token belongs to without
+// spending the token.
+func (repo *PostgresRepo) GetPasswordReset(ctx context.Context, token string) (*store.User, error) {
+	sql := `SELECT ` + userColumns + `
+	FROM password_reset_tokens t JOIN users u ON u.id = t.user_id
+	WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > NOW()`
+
+	user, err := scanUser(repo.db.QueryRow(ctx, sql, tokenDigest(token)))
+	if err == pgx.ErrNoRows {
+		return nil, store.ErrResetFailed
+	} else if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to get password reset token")
+		return nil, errors.Wrap(err, "failed to get password reset token")
+	}
+	return user, nil
+}
+
+// ResetPassword spends the token, sets the new password and revokes every
+// refresh token of the user along with the other reset tokens.
+func (repo *PostgresRepo) ResetPassword(ctx context.Context, token, password string) (int64, error) {
+	var (
+		sqlUse = `UPDATE password_reset_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`
+		sqlUseOthers = `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+		userID       int64
+	)
+
+	hashedPassword, err := hasher.MakeHash(password)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to hash password")
+		return 0, err
+	}
+
+	err = repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, sqlUse, tokenDigest(token)).Scan(&userID)
+		if err == pgx.ErrNoRows {
+			return store.ErrResetFailed
+		} else if err != nil {
+			return errors.Wrap(err, "failed to use password reset token")
+		}
+
+		if _, err = tx.Exec(ctx, sqlUseOthers, userID); err != nil {
+			return errors.Wrap(err, "failed to invalidate password reset tokens")
+		}
+		return repo.setPassword(ctx, tx, userID, hashedPassword)
+	})
+	if err != nil {
+		repo.log.Warn().Err(err).Msg("Password reset failed")
+		return 0, err
+	}
+
+	repo.log.Info().Int64("userID", userID).Msg("Password reset")
+	return userID, nil
+}
+
+// ChangePassword replaces the password of the user if the old one matches
+// and revokes every refresh token of the user.
+func (repo *PostgresRepo) ChangePassword(ctx context.Context, userid int64, oldPassword, newPassword string) error {
+	sqlGet := `SELECT password FROM users WHERE id = $1 FOR UPDATE`
+
+	hashedPassword, err := hasher.MakeHash(newPassword)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to hash password")
+		return err
+	}
+
+	err = repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		var current string
+		err := tx.QueryRow(ctx, sqlGet, userid).Scan(&current)
+		if err == pgx.ErrNoRows {
+			return store.ErrUserNotFound
+		} else if err != nil {
+			return errors.Wrap(err, "failed to get password")
+		}
+
+		if !hasher.CheckPassword(oldPassword, current) {
+			return store.ErrWrongPassword
+		}
+		return repo.setPassword(ctx, tx, userid, hashedPassword)
+	})
+	if err != nil {
+		repo.log.Warn().Err(err).Int64("userID", userid).Msg("Password change failed")
+		return err
+	}
+
+	repo.log.Info().Int64("userID", userid).Msg("Password changed")
+	return nil
+}
+
+func (repo *PostgresRepo) setPassword(ctx context.Context, tx pgx.Tx, userid int64, hashedPassword string) error {
+	sql := `UPDATE users SET password = $2 WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, sql, userid, hashedPassword); err != nil {
+		return errors.Wrap(err, "failed to update password")
+	}
+	if _, err := tx.Exec(ctx, sqlRevokeUserTokens, userid); err != nil {
+		return errors.Wrap(err, "failed to revoke refresh tokens")
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
@@ -9,10 +10,11 @@ import (
 )
 
 type PostgresRepo struct {
-	db     *db
-	stop   chan interface{}
-	config *config.Config
-	log    *logger.Logger
+	db       *db
+	stop     chan interface{}
+	stopOnce sync.Once
+	config   *config.Config
+	log      *logger.Logger
 }
 
 func NewPostgresRepo(ctx context.Context) (*PostgresRepo, error) {
@@ -40,6 +42,7 @@ func (repo *PostgresRepo) Start(ctx context.Context) error {
 		return err
 	}
 	go repo.keepAlive(ctx)
+	go repo.purgeTokens(ctx)
 
 	return nil
 }
@@ -79,11 +82,17 @@ func (repo *PostgresRepo) maintainConnection(ctx context.Context) {
 	}
 }
 
+// Stop stops the workers and closes the pool. Only the first call does
+// anything, so the repository can be stopped by both its owner and the
+// shutdown sequence.
 func (repo *PostgresRepo) Stop(_ context.Context) error {
-	repo.log.Info().Msg("Stopping PostgreSQL repository..")
+	repo.stopOnce.Do(func() {
+		repo.log.Info().Msg("Stopping PostgreSQL repository..")
 
-	repo.stop <- struct{}{}
+		// closing the channel stops every worker at once
+		close(repo.stop)
 
-	repo.db.Close()
+		repo.db.Close()
+	})
 	return nil
 }
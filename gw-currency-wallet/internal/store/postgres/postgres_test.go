@@ -2,10 +2,14 @@ package postgres
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/shopspring/decimal"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -45,6 +49,31 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+func TestCreateUserConflicts(t *testing.T) {
+	testStartTime := time.Now()
+
+	ctx := context.Background()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+
+	defer repo.Stop(ctx)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	err = repo.CreateUser(ctx, &store.User{Username: "testconflict", Email: "conflict@example.com", Password: "securepassword"})
+	assert.NoError(t, err)
+
+	// email уникален без учёта регистра
+	err = repo.CreateUser(ctx, &store.User{Username: "testconflict2", Email: "Conflict@Example.com", Password: "securepassword"})
+	assert.ErrorIs(t, err, store.ErrEmailTaken)
+
+	err = repo.CreateUser(ctx, &store.User{Username: "testconflict", Email: "conflict2@example.com", Password: "securepassword"})
+	assert.ErrorIs(t, err, store.ErrUsernameTaken)
+}
+
 func TestAuthentication(t *testing.T) {
 	ctx := context.Background()
 
@@ -73,12 +102,12 @@ func TestAuthentication(t *testing.T) {
 	// Тестирование аутентификации с неверным паролем
 	invalidUser := &store.User{Username: "testuserauth", Password: "wrongpassword"}
 	_, err = repo.Authentication(ctx, invalidUser)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, store.ErrInvalidCredentials)
 
 	// Тестирование аутентификации с несуществующим пользователем
 	nonExistentUser := &store.User{Username: "nonexistentuserauth", Password: "any"}
 	_, err = repo.Authentication(ctx, nonExistentUser)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, store.ErrInvalidCredentials)
 }
 
 func TestSetToken(t *testing.T) {
@@ -91,7 +120,7 @@ func TestSetToken(t *testing.T) {
 	// Создание тестового refresh токена
 	refreshToken := &store.RefreshToken{
 		UserID:    1,
-		Hash:      "samplehash",
+		Token:     "samplehash",
 		ExpiresAt: time.Now().Add(24 * time.Hour),
 		CreatedAt: testStartTime,
 	}
@@ -106,7 +135,7 @@ func TestSetToken(t *testing.T) {
 	// Тестирование ошибки при создании токена
 	invalidToken := &store.RefreshToken{
 		UserID:    0, // Неверный userID
-		Hash:      "invalidhash",
+		Token:     "invalidhash",
 		ExpiresAt: time.Now().Add(-1 * time.Hour), // Истекший токен
 	}
 	err = repo.SetToken(ctx, invalidToken)
@@ -122,7 +151,7 @@ func TestCheckRefreshToken(t *testing.T) {
 
 	refreshToken := &store.RefreshToken{
 		UserID:    2,
-		Hash:      "validtokenhash",
+		Token:     "validtokenhash",
 		ExpiresAt: time.Now().Add(24 * time.Hour),
 		CreatedAt: testStartTime,
 	}
@@ -140,7 +169,7 @@ func TestCheckRefreshToken(t *testing.T) {
 	// Создание валидного refresh токена
 	validToken := &store.RefreshToken{
 		UserID: 2,
-		Hash:   "validtokenhash",
+		Token:  "validtokenhash",
 	}
 
 	// Проверка наличия токена в базе
@@ -150,8 +179,1001 @@ func TestCheckRefreshToken(t *testing.T) {
 	// Тестирование случая, когда токен не найден
 	invalidToken := &store.RefreshToken{
 		UserID: 2,
-		Hash:   "invalidtokenhash",
+		Token:  "invalidtokenhash",
 	}
 	err = repo.CheckRefreshToken(ctx, invalidToken)
 	assert.Error(t, err)
 }
+
+func TestLedgerMatchesBalances(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testledgeruser", Email: "testledger@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	userID, err := repo.Authentication(ctx, user)
+	assert.NoError(t, err)
+
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: userID, Money: money.New(decimal.NewFromInt(100), "USD"), Operation: store.OperationDeposit})
+	assert.NoError(t, err)
+
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: userID, Money: money.New(decimal.RequireFromString("30.5"), "USD"), Operation: store.OperationWithdraw})
+	assert.NoError(t, err)
+
+	err = repo.ExchangeCurrency(ctx, &store.ExchangeBalance{UserID: userID, FromCurrency: "USD", FromAmount: decimal.NewFromInt(50), ToCurrency: "EUR", ToAmount: decimal.RequireFromString("47.25")})
+	assert.NoError(t, err)
+
+	var transactions int
+	err = repo.db.QueryRow(ctx, `SELECT COUNT(*) FROM transactions t
+		INNER JOIN wallets w ON t.wallet_id = w.id
+		WHERE w.user_id = $1`, userID).Scan(&transactions)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, transactions)
+
+	mismatches, err := repo.ReconcileLedger(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	// Изменение баланса в обход леджера должно быть обнаружено
+	_, err = repo.db.Exec(ctx, `UPDATE wallet_balances SET balance = balance + 1
+		WHERE wallet_id = (SELECT id FROM wallets WHERE user_id = $1) AND currency = 'EUR'`, userID)
+	assert.NoError(t, err)
+
+	mismatches, err = repo.ReconcileLedger(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+}
+
+func TestGetTransactions(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testhistoryuser", Email: "testhistory@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	userID, err := repo.Authentication(ctx, user)
+	assert.NoError(t, err)
+
+	for range 3 {
+		err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: userID, Money: money.New(decimal.NewFromInt(10), "USD"), Operation: store.OperationDeposit})
+		assert.NoError(t, err)
+	}
+	err = repo.ExchangeCurrency(ctx, &store.ExchangeBalance{UserID: userID, FromCurrency: "USD", FromAmount: decimal.NewFromInt(10), ToCurrency: "EUR", ToAmount: decimal.NewFromInt(9), Fee: decimal.RequireFromString("0.1"), Rate: decimal.RequireFromString("0.91")})
+	assert.NoError(t, err)
+
+	// Первая страница: самые новые операции
+	page, err := repo.GetTransactions(ctx, &store.TransactionFilter{UserID: userID, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, page, 2)
+	assert.Equal(t, store.OperationExchange, page[0].Operation)
+	assert.Len(t, page[0].Entries, 2)
+	assert.NotNil(t, page[0].Rate)
+	assert.True(t, decimal.RequireFromString("0.1").Equal(page[0].Fee.Decimal))
+	assert.False(t, page[1].Fee.Valid)
+
+	// Следующая страница по курсору
+	next, err := repo.GetTransactions(ctx, &store.TransactionFilter{UserID: userID, Limit: 2, BeforeID: page[1].ID})
+	assert.NoError(t, err)
+	assert.Len(t, next, 2)
+	assert.True(t, decimal.NewFromInt(10).Equal(next[1].Entries[0].BalanceAfter))
+
+	// Фильтр по типу и валюте
+	exchanges, err := repo.GetTransactions(ctx, &store.TransactionFilter{UserID: userID, Operation: store.OperationExchange, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, exchanges, 1)
+
+	eur, err := repo.GetTransactions(ctx, &store.TransactionFilter{UserID: userID, Currency: "EUR", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, eur, 1)
+}
+
+func TestConcurrentWithdraw(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testconcurrentuser", Email: "testconcurrent@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	userID, err := repo.Authentication(ctx, user)
+	assert.NoError(t, err)
+
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: userID, Money: money.New(decimal.NewFromInt(100), "USD"), Operation: store.OperationDeposit})
+	assert.NoError(t, err)
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: userID, Money: money.New(decimal.NewFromInt(100), "EUR"), Operation: store.OperationDeposit})
+	assert.NoError(t, err)
+
+	var (
+		wg           sync.WaitGroup
+		succeeded    atomic.Int32
+		insufficient atomic.Int32
+	)
+
+	// 50 выводов по 10 USD при балансе 100: успешных должно быть ровно 10
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: userID, Money: money.New(decimal.NewFromInt(10), "USD"), Operation: store.OperationWithdraw})
+			switch err {
+			case nil:
+				succeeded.Add(1)
+			case store.ErrInsufficientFunds:
+				insufficient.Add(1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+
+	// встречные обмены одного кошелька не должны приводить к дедлокам
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			from, to := "EUR", "RUB"
+			if i%2 == 0 {
+				from, to = to, from
+			}
+			err := repo.ExchangeCurrency(ctx, &store.ExchangeBalance{UserID: userID, FromCurrency: from, FromAmount: decimal.NewFromInt(1), ToCurrency: to, ToAmount: decimal.NewFromInt(1), Rate: decimal.NewFromInt(1)})
+			if err != nil && err != store.ErrInsufficientFunds {
+				t.Errorf("unexpected exchange error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(10), succeeded.Load())
+	assert.Equal(t, int32(40), insufficient.Load())
+
+	usd, err := repo.GetSpecificCurrency(ctx, &store.CurrencyRequest{UserID: userID, CurrencyCode: "USD"})
+	assert.NoError(t, err)
+	assert.True(t, usd.Balance.IsZero())
+
+	mismatches, err := repo.ReconcileLedger(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches)
+}
+
+func TestTransfer(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	sender := &store.User{Username: "testtransfersender", Email: "testsender@example.com", Password: "securepassword"}
+	recipient := &store.User{Username: "testtransferrecipient", Email: "testrecipient@example.com", Password: "securepassword"}
+	for _, user := range []*store.User{sender, recipient} {
+		err = repo.CreateUser(ctx, user)
+		assert.NoError(t, err)
+	}
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	senderID, err := repo.Authentication(ctx, sender)
+	assert.NoError(t, err)
+	recipientID, err := repo.Authentication(ctx, recipient)
+	assert.NoError(t, err)
+
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: senderID, Money: money.New(decimal.NewFromInt(100), "USD"), Operation: store.OperationDeposit})
+	assert.NoError(t, err)
+
+	// Перевод по имени пользователя в той же валюте
+	err = repo.Transfer(ctx, &store.Transfer{FromUserID: senderID, Recipient: recipient.Username, FromCurrency: "USD", FromAmount: decimal.NewFromInt(40), ToCurrency: "USD", ToAmount: decimal.NewFromInt(40)})
+	assert.NoError(t, err)
+
+	// Перевод по email с конвертацией и комиссией
+	err = repo.Transfer(ctx, &store.Transfer{FromUserID: senderID, Recipient: recipient.Email, FromCurrency: "USD", FromAmount: decimal.NewFromInt(10), ToCurrency: "EUR", ToAmount: decimal.NewFromInt(9), Rate: decimal.NewNullDecimal(decimal.RequireFromString("0.91")), Fee: decimal.NewNullDecimal(decimal.RequireFromString("0.1"))})
+	assert.NoError(t, err)
+
+	err = repo.Transfer(ctx, &store.Transfer{FromUserID: senderID, Recipient: recipient.Username, FromCurrency: "USD", FromAmount: decimal.NewFromInt(100), ToCurrency: "USD", ToAmount: decimal.NewFromInt(100)})
+	assert.Equal(t, store.ErrInsufficientFunds, err)
+
+	err = repo.Transfer(ctx, &store.Transfer{FromUserID: senderID, Recipient: "nosuchuser", FromCurrency: "USD", FromAmount: decimal.NewFromInt(1), ToCurrency: "USD", ToAmount: decimal.NewFromInt(1)})
+	assert.Equal(t, store.ErrRecipientNotFound, err)
+
+	err = repo.Transfer(ctx, &store.Transfer{FromUserID: senderID, Recipient: sender.Username, FromCurrency: "USD", FromAmount: decimal.NewFromInt(1), ToCurrency: "USD", ToAmount: decimal.NewFromInt(1)})
+	assert.Equal(t, store.ErrTransferToYourself, err)
+
+	usd, err := repo.GetSpecificCurrency(ctx, &store.CurrencyRequest{UserID: senderID, CurrencyCode: "USD"})
+	assert.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(50).Equal(usd.Balance))
+
+	eur, err := repo.GetSpecificCurrency(ctx, &store.CurrencyRequest{UserID: recipientID, CurrencyCode: "EUR"})
+	assert.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(9).Equal(eur.Balance))
+
+	// Получатель видит только свои записи
+	history, err := repo.GetTransactions(ctx, &store.TransactionFilter{UserID: recipientID, Operation: store.OperationTransfer, Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	for _, transaction := range history {
+		assert.Len(t, transaction.Entries, 1)
+		assert.False(t, transaction.Fee.Valid)
+	}
+
+	// Комиссию видит отправитель
+	sent, err := repo.GetTransactions(ctx, &store.TransactionFilter{UserID: senderID, Operation: store.OperationTransfer, Limit: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, sent, 1) {
+		assert.True(t, decimal.RequireFromString("0.1").Equal(sent[0].Fee.Decimal))
+	}
+
+	mismatches, err := repo.ReconcileLedger(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches)
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testrevokeuser", Email: "testrevoke@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	userID, err := repo.Authentication(ctx, user)
+	assert.NoError(t, err)
+
+	for _, hash := range []string{"revokehash1", "revokehash2", "revokehash3"} {
+		err = repo.SetToken(ctx, &store.RefreshToken{UserID: userID, Token: hash, ExpiresAt: time.Now().Add(time.Hour)})
+		assert.NoError(t, err)
+	}
+	err = repo.SetToken(ctx, &store.RefreshToken{UserID: userID, Token: "expiredhash", ExpiresAt: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+
+	// Отозванный токен больше не принимается
+	err = repo.RevokeRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: "revokehash1"})
+	assert.NoError(t, err)
+	err = repo.CheckRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: "revokehash1"})
+	assert.Error(t, err)
+	err = repo.CheckRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: "revokehash2"})
+	assert.NoError(t, err)
+
+	// Выход со всех устройств
+	err = repo.RevokeUserTokens(ctx, userID)
+	assert.NoError(t, err)
+	for _, hash := range []string{"revokehash2", "revokehash3"} {
+		err = repo.CheckRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: hash})
+		assert.Error(t, err)
+	}
+
+	purged, err := repo.PurgeExpiredTokens(ctx)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, int64(1))
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testrotateuser", Email: "testrotate@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	userID, err := repo.Authentication(ctx, user)
+	assert.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	err = repo.SetToken(ctx, &store.RefreshToken{UserID: userID, Token: "rotatehash1", ExpiresAt: expiresAt})
+	assert.NoError(t, err)
+
+	second := &store.RefreshToken{UserID: userID, Token: "rotatehash2", ExpiresAt: expiresAt, UserAgent: "test-agent", IP: "127.0.0.1"}
+	err = repo.RotateRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: "rotatehash1"}, second)
+	assert.NoError(t, err)
+	assert.NotZero(t, second.FamilyID)
+
+	// В базе хранится только дайджест токена
+	var stored, userAgent string
+	err = repo.db.QueryRow(ctx, `SELECT token_hash, user_agent FROM refresh_tokens
+		WHERE user_id = $1 AND revoked = false`, userID).Scan(&stored, &userAgent)
+	assert.NoError(t, err)
+	assert.Equal(t, tokenDigest("rotatehash2"), stored)
+	assert.Equal(t, "test-agent", userAgent)
+
+	err = repo.CheckRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: "rotatehash1"})
+	assert.Error(t, err)
+	err = repo.CheckRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: "rotatehash2"})
+	assert.NoError(t, err)
+
+	// Повторное предъявление отозванного токена отзывает всё семейство
+	err = repo.RotateRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: "rotatehash1"}, &store.RefreshToken{UserID: userID, Token: "rotatehash3", ExpiresAt: expiresAt})
+	assert.Equal(t, store.ErrTokenReused, err)
+
+	err = repo.CheckRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: "rotatehash2"})
+	assert.Error(t, err)
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testsessionsuser", Email: "testsessions@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	userID, err := repo.Authentication(ctx, user)
+	assert.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	err = repo.SetToken(ctx, &store.RefreshToken{UserID: userID, Token: "sessionhash1", ExpiresAt: expiresAt, UserAgent: "phone", IP: "10.0.0.1"})
+	assert.NoError(t, err)
+	err = repo.SetToken(ctx, &store.RefreshToken{UserID: userID, Token: "sessionhash2", ExpiresAt: expiresAt, UserAgent: "laptop", IP: "10.0.0.2"})
+	assert.NoError(t, err)
+
+	// Ротация не создаёт новую сессию
+	err = repo.RotateRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: "sessionhash1"}, &store.RefreshToken{UserID: userID, Token: "sessionhash3", ExpiresAt: expiresAt, UserAgent: "phone", IP: "10.0.0.3"})
+	assert.NoError(t, err)
+
+	sessions, err := repo.GetSessions(ctx, userID)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, "10.0.0.3", sessions[0].IP)
+
+	err = repo.RevokeSession(ctx, userID, sessions[0].ID)
+	assert.NoError(t, err)
+	err = repo.CheckRefreshToken(ctx, &store.RefreshToken{UserID: userID, Token: "sessionhash3"})
+	assert.Error(t, err)
+
+	// Чужую или уже завершённую сессию завершить нельзя
+	err = repo.RevokeSession(ctx, userID+1, sessions[1].ID)
+	assert.Equal(t, store.ErrSessionNotFound, err)
+	err = repo.RevokeSession(ctx, userID, sessions[0].ID)
+	assert.Equal(t, store.ErrSessionNotFound, err)
+
+	sessions, err = repo.GetSessions(ctx, userID)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testverifyuser", Email: "testverify@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	// Новый пользователь не подтверждён
+	stored, err := repo.GetUser(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, stored.EmailVerifiedAt)
+
+	err = repo.CreateEmailVerification(ctx, &store.EmailVerification{UserID: user.ID, Token: "expiredtoken", ExpiresAt: time.Now().Add(-time.Minute)})
+	assert.NoError(t, err)
+	err = repo.CreateEmailVerification(ctx, &store.EmailVerification{UserID: user.ID, Token: "verifytoken", ExpiresAt: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+
+	_, err = repo.VerifyEmail(ctx, "expiredtoken")
+	assert.ErrorIs(t, err, store.ErrVerificationFailed)
+
+	userID, err := repo.VerifyEmail(ctx, "verifytoken")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	stored, err = repo.GetUser(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, stored.EmailVerifiedAt)
+
+	// Токен одноразовый
+	_, err = repo.VerifyEmail(ctx, "verifytoken")
+	assert.ErrorIs(t, err, store.ErrVerificationFailed)
+
+	_, err = repo.GetUser(ctx, user.ID+1000000)
+	assert.ErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testresetuser", Email: "testreset@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	err = repo.SetToken(ctx, &store.RefreshToken{UserID: user.ID, Token: "resetrefreshtoken", ExpiresAt: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+
+	found, err := repo.GetUserByEmail(ctx, "TestReset@Example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+
+	err = repo.CreatePasswordReset(ctx, &store.PasswordReset{UserID: user.ID, Token: "resettoken", ExpiresAt: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	err = repo.CreatePasswordReset(ctx, &store.PasswordReset{UserID: user.ID, Token: "otherresettoken", ExpiresAt: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+
+	found, err = repo.GetPasswordReset(ctx, "resettoken")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+
+	userID, err := repo.ResetPassword(ctx, "resettoken", "newsecurepassword")
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+
+	// Новый пароль действует, старый нет
+	_, err = repo.Authentication(ctx, &store.User{Username: user.Username, Password: "securepassword"})
+	assert.ErrorIs(t, err, store.ErrInvalidCredentials)
+	_, err = repo.Authentication(ctx, &store.User{Username: user.Username, Password: "newsecurepassword"})
+	assert.NoError(t, err)
+
+	// Остальные токены сброса и refresh токены отозваны
+	_, err = repo.ResetPassword(ctx, "otherresettoken", "anotherpassword")
+	assert.ErrorIs(t, err, store.ErrResetFailed)
+	err = repo.CheckRefreshToken(ctx, &store.RefreshToken{UserID: user.ID, Token: "resetrefreshtoken"})
+	assert.Error(t, err)
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testchangeuser", Email: "testchange@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	err = repo.ChangePassword(ctx, user.ID, "wrongpassword", "newsecurepassword")
+	assert.ErrorIs(t, err, store.ErrWrongPassword)
+
+	err = repo.ChangePassword(ctx, user.ID, "securepassword", "newsecurepassword")
+	assert.NoError(t, err)
+
+	_, err = repo.Authentication(ctx, &store.User{Username: user.Username, Password: "newsecurepassword"})
+	assert.NoError(t, err)
+}
+
+func TestMFA(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testmfauser", Email: "testmfa@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	_, err = repo.GetMFA(ctx, user.ID)
+	assert.ErrorIs(t, err, store.ErrMFANotEnabled)
+
+	// Неподтверждённый секрет можно заменить, подтверждённый нельзя
+	assert.NoError(t, repo.SetMFASecret(ctx, user.ID, "FIRSTSECRET"))
+	assert.NoError(t, repo.SetMFASecret(ctx, user.ID, "SECONDSECRET"))
+
+	mfa, err := repo.GetMFA(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "SECONDSECRET", mfa.Secret)
+	assert.Nil(t, mfa.EnabledAt)
+
+	err = repo.EnableMFA(ctx, user.ID, 100, []string{"recoverycode1", "recoverycode2"})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, repo.SetMFASecret(ctx, user.ID, "THIRDSECRET"), store.ErrMFAAlreadyEnabled)
+
+	mfa, err = repo.GetMFA(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, mfa.EnabledAt)
+
+	// Код того же или более раннего шага повторно не принимается
+	assert.ErrorIs(t, repo.UseTOTPStep(ctx, user.ID, 100), store.ErrInvalidMFACode)
+	assert.NoError(t, repo.UseTOTPStep(ctx, user.ID, 101))
+
+	// Код восстановления одноразовый
+	assert.NoError(t, repo.UseRecoveryCode(ctx, user.ID, "recoverycode1"))
+	assert.ErrorIs(t, repo.UseRecoveryCode(ctx, user.ID, "recoverycode1"), store.ErrInvalidMFACode)
+
+	assert.NoError(t, repo.ReplaceRecoveryCodes(ctx, user.ID, []string{"recoverycode3"}))
+	assert.ErrorIs(t, repo.UseRecoveryCode(ctx, user.ID, "recoverycode2"), store.ErrInvalidMFACode)
+
+	assert.NoError(t, repo.DisableMFA(ctx, user.ID))
+	_, err = repo.GetMFA(ctx, user.ID)
+	assert.ErrorIs(t, err, store.ErrMFANotEnabled)
+}
+
+func TestAdmin(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	admin := &store.User{Username: "testadminuser", Email: "testadmin@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, admin)
+	assert.NoError(t, err)
+	user := &store.User{Username: "testadmintarget", Email: "testadmintarget@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM admin_audit_log WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	// Поиск по началу имени или почты без учёта регистра
+	users, err := repo.FindUsers(ctx, "TestAdminT", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, user.ID, users[0].ID)
+		assert.Equal(t, store.RoleUser, users[0].Role)
+	}
+
+	// Подстановочные символы LIKE ищутся как обычные
+	users, err = repo.FindUsers(ctx, "testadmin_", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+
+	entry := func(action string) *store.AuditEntry {
+		return &store.AuditEntry{
+			ActorID:      admin.ID,
+			Action:       action,
+			TargetUserID: &user.ID,
+			Details:      map[string]string{"reason": "test"},
+		}
+	}
+
+	assert.NoError(t, repo.FreezeUser(ctx, user.ID, entry(store.AuditUserFreeze)))
+	assert.ErrorIs(t, repo.FreezeUser(ctx, user.ID, entry(store.AuditUserFreeze)), store.ErrAccountFrozen)
+
+	frozen, err := repo.GetUser(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, frozen.FrozenAt)
+
+	assert.NoError(t, repo.UnfreezeUser(ctx, user.ID, entry(store.AuditUserUnfreeze)))
+	assert.ErrorIs(t, repo.UnfreezeUser(ctx, user.ID, entry(store.AuditUserUnfreeze)), store.ErrAccountNotFrozen)
+	assert.ErrorIs(t, repo.FreezeUser(ctx, -1, entry(store.AuditUserFreeze)), store.ErrUserNotFound)
+
+	assert.NoError(t, repo.SetUserRole(ctx, user.ID, store.RoleSupport, entry(store.AuditUserRole)))
+	support, err := repo.GetUser(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, store.RoleSupport, support.Role)
+
+	// В журнале только успешные изменения, новые первыми
+	entries, err := repo.GetAuditLog(ctx, &store.AuditFilter{TargetUserID: user.ID, Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, store.AuditUserRole, entries[0].Action)
+		assert.Equal(t, store.AuditUserUnfreeze, entries[1].Action)
+		assert.Equal(t, store.AuditUserFreeze, entries[2].Action)
+		assert.Equal(t, admin.ID, entries[2].ActorID)
+		assert.Equal(t, "test", entries[2].Details["reason"])
+
+		entries, err = repo.GetAuditLog(ctx, &store.AuditFilter{TargetUserID: user.ID, BeforeID: entries[0].ID, Limit: 1})
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, store.AuditUserUnfreeze, entries[0].Action)
+		}
+	}
+}
+
+func TestWalletStatus(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	admin := &store.User{Username: "testwalletadmin", Email: "testwalletadmin@example.com", Password: "securepassword"}
+	user := &store.User{Username: "testwalletstatus", Email: "testwalletstatus@example.com", Password: "securepassword"}
+	other := &store.User{Username: "testwalletother", Email: "testwalletother@example.com", Password: "securepassword"}
+	for _, u := range []*store.User{admin, user, other} {
+		err = repo.CreateUser(ctx, u)
+		assert.NoError(t, err)
+	}
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM admin_audit_log WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	entry := func(status string) *store.AuditEntry {
+		return &store.AuditEntry{
+			ActorID:      admin.ID,
+			Action:       store.AuditWalletStatus,
+			TargetUserID: &user.ID,
+			Details:      map[string]string{"status": status, "reason": "test"},
+		}
+	}
+	deposit := func(userid int64) error {
+		return repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: userid, Money: money.New(decimal.NewFromInt(100), "USD"), Operation: store.OperationDeposit})
+	}
+	transfer := func(from int64, recipient string) error {
+		return repo.Transfer(ctx, &store.Transfer{FromUserID: from, Recipient: recipient, FromCurrency: "USD", FromAmount: decimal.NewFromInt(10), ToCurrency: "USD", ToAmount: decimal.NewFromInt(10)})
+	}
+
+	assert.NoError(t, deposit(user.ID))
+	assert.NoError(t, deposit(other.ID))
+
+	balance, err := repo.GetBalance(ctx, user.ID, 0)
+	assert.NoError(t, err)
+	for _, b := range balance {
+		assert.Equal(t, store.WalletActive, b.WalletStatus)
+	}
+
+	// Замороженный кошелёк принимает только входящие средства
+	assert.NoError(t, repo.SetWalletStatus(ctx, user.ID, 0, store.WalletFrozen, entry(store.WalletFrozen)))
+	assert.ErrorIs(t, repo.SetWalletStatus(ctx, user.ID, 0, store.WalletFrozen, entry(store.WalletFrozen)), store.ErrWalletStatusSame)
+
+	assert.NoError(t, deposit(user.ID))
+	assert.NoError(t, transfer(other.ID, user.Username))
+
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: user.ID, Money: money.New(decimal.NewFromInt(1), "USD"), Operation: store.OperationWithdraw})
+	assert.ErrorIs(t, err, store.ErrWalletFrozen)
+	assert.ErrorIs(t, transfer(user.ID, other.Username), store.ErrWalletFrozen)
+	err = repo.ExchangeCurrency(ctx, &store.ExchangeBalance{UserID: user.ID, FromCurrency: "USD", ToCurrency: "EUR", FromAmount: decimal.NewFromInt(1), ToAmount: decimal.NewFromInt(1), Rate: decimal.NewFromInt(1)})
+	assert.ErrorIs(t, err, store.ErrWalletFrozen)
+
+	balance, err = repo.GetBalance(ctx, user.ID, 0)
+	assert.NoError(t, err)
+	for _, b := range balance {
+		assert.Equal(t, store.WalletFrozen, b.WalletStatus)
+	}
+
+	// Кошелёк с деньгами не закрывается, его сначала надо опустошить
+	assert.ErrorIs(t, repo.SetWalletStatus(ctx, user.ID, 0, store.WalletClosed, entry(store.WalletClosed)), store.ErrWalletNotEmpty)
+	assert.NoError(t, repo.SetWalletStatus(ctx, user.ID, 0, store.WalletActive, entry(store.WalletActive)))
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: user.ID, Money: money.New(decimal.NewFromInt(210), "USD"), Operation: store.OperationWithdraw})
+	assert.NoError(t, err)
+
+	// Закрытый кошелёк не принимает ничего и не открывается снова
+	assert.NoError(t, repo.SetWalletStatus(ctx, user.ID, 0, store.WalletClosed, entry(store.WalletClosed)))
+	assert.ErrorIs(t, deposit(user.ID), store.ErrWalletClosed)
+	assert.ErrorIs(t, transfer(other.ID, user.Username), store.ErrRecipientClosed)
+	assert.ErrorIs(t, repo.SetWalletStatus(ctx, user.ID, 0, store.WalletActive, entry(store.WalletActive)), store.ErrWalletClosed)
+
+	assert.ErrorIs(t, repo.SetWalletStatus(ctx, -1, 0, store.WalletFrozen, entry(store.WalletFrozen)), store.ErrUserNotFound)
+
+	entries, err := repo.GetAuditLog(ctx, &store.AuditFilter{TargetUserID: user.ID, Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, store.WalletClosed, entries[0].Details["status"])
+		assert.Equal(t, store.WalletActive, entries[0].Details["previous_status"])
+	}
+}
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	admin := &store.User{Username: "testlimitsadmin", Email: "testlimitsadmin@example.com", Password: "securepassword"}
+	user := &store.User{Username: "testlimitsuser", Email: "testlimitsuser@example.com", Password: "securepassword"}
+	other := &store.User{Username: "testlimitsother", Email: "testlimitsother@example.com", Password: "securepassword"}
+	for _, u := range []*store.User{admin, user, other} {
+		err = repo.CreateUser(ctx, u)
+		assert.NoError(t, err)
+	}
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM admin_audit_log WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: user.ID, Money: money.New(decimal.NewFromInt(1000), "USD"), Operation: store.OperationDeposit})
+	assert.NoError(t, err)
+
+	limit := &store.Limit{
+		Operation: store.OperationWithdraw,
+		Currency:  "USD",
+		Daily:     decimal.NewNullDecimal(decimal.NewFromInt(100)),
+		Monthly:   decimal.NewNullDecimal(decimal.NewFromInt(150)),
+	}
+	withdraw := func(amount int64) error {
+		return repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: user.ID, Money: money.New(decimal.NewFromInt(amount), "USD"), Operation: store.OperationWithdraw, Limit: limit})
+	}
+
+	transfer := func(amount int64) error {
+		return repo.Transfer(ctx, &store.Transfer{FromUserID: user.ID, Recipient: other.Username, FromCurrency: "USD", FromAmount: decimal.NewFromInt(amount), ToCurrency: "USD", ToAmount: decimal.NewFromInt(amount), Limit: limit})
+	}
+
+	assert.NoError(t, withdraw(60))
+	assert.NoError(t, withdraw(40))
+	assert.ErrorIs(t, withdraw(1), store.ErrLimitExceeded)
+
+	// Перевод другому пользователю расходует тот же лимит, что и вывод
+	assert.ErrorIs(t, transfer(1), store.ErrLimitExceeded)
+
+	// Обмен учитывается отдельно от вывода
+	exchangeLimit := &store.Limit{Operation: store.OperationExchange, Currency: "USD", Daily: decimal.NewNullDecimal(decimal.NewFromInt(50))}
+	err = repo.ExchangeCurrency(ctx, &store.ExchangeBalance{UserID: user.ID, FromCurrency: "USD", ToCurrency: "EUR", FromAmount: decimal.NewFromInt(50), ToAmount: decimal.NewFromInt(45), Rate: decimal.RequireFromString("0.9"), Limit: exchangeLimit})
+	assert.NoError(t, err)
+	err = repo.ExchangeCurrency(ctx, &store.ExchangeBalance{UserID: user.ID, FromCurrency: "USD", ToCurrency: "EUR", FromAmount: decimal.NewFromInt(1), ToAmount: decimal.RequireFromString("0.9"), Rate: decimal.RequireFromString("0.9"), Limit: exchangeLimit})
+	assert.ErrorIs(t, err, store.ErrLimitExceeded)
+
+	usage, err := repo.GetLimitUsage(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Len(t, usage, 2)
+	for _, u := range usage {
+		assert.Equal(t, "USD", u.Currency)
+		switch u.Operation {
+		case store.OperationWithdraw:
+			assert.True(t, decimal.NewFromInt(100).Equal(u.Daily))
+			assert.True(t, decimal.NewFromInt(100).Equal(u.Monthly))
+		case store.OperationExchange:
+			assert.True(t, decimal.NewFromInt(50).Equal(u.Daily))
+		default:
+			t.Fatalf("unexpected operation %s", u.Operation)
+		}
+	}
+
+	entry := &store.AuditEntry{ActorID: admin.ID, Action: store.AuditUserLimits, TargetUserID: &user.ID}
+
+	// Личные лимиты пользователя
+	assert.NoError(t, repo.SetUserLimit(ctx, user.ID, limit, entry))
+	assert.NoError(t, repo.SetUserLimit(ctx, user.ID, &store.Limit{Operation: store.OperationWithdraw, Currency: "USD", Daily: decimal.NewNullDecimal(decimal.NewFromInt(200))}, entry))
+
+	overrides, err := repo.GetUserLimits(ctx, user.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, overrides, 1) {
+		assert.True(t, decimal.NewFromInt(200).Equal(overrides[0].Daily.Decimal))
+		assert.False(t, overrides[0].Monthly.Valid)
+	}
+
+	// Лимит без сумм удаляется
+	assert.NoError(t, repo.SetUserLimit(ctx, user.ID, &store.Limit{Operation: store.OperationWithdraw, Currency: "USD"}, entry))
+	overrides, err = repo.GetUserLimits(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, overrides)
+
+	assert.ErrorIs(t, repo.SetUserLimit(ctx, -1, limit, entry), store.ErrUserNotFound)
+}
+
+func TestCurrencies(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	admin := &store.User{Username: "testcurrenciesadmin", Email: "testcurrenciesadmin@example.com", Password: "securepassword"}
+	user := &store.User{Username: "testcurrenciesuser", Email: "testcurrenciesuser@example.com", Password: "securepassword"}
+	for _, u := range []*store.User{admin, user} {
+		err = repo.CreateUser(ctx, u)
+		assert.NoError(t, err)
+	}
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM admin_audit_log WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+		_, err = repo.db.Exec(ctx, "DELETE FROM currencies WHERE code = 'XTS'")
+		assert.NoError(t, err)
+	}()
+
+	entry := &store.AuditEntry{ActorID: admin.ID, Action: store.AuditCurrencySet}
+	currency := &store.Currency{Code: "XTS", Name: "Test currency", MinorUnits: 0, Enabled: true}
+	assert.NoError(t, repo.SetCurrency(ctx, currency, entry))
+
+	// Новая валюта показывается с нулевым балансом, строка создаётся первым зачислением
+	balanceOf := func(code string) *store.WalletCurrency {
+		balance, err := repo.GetBalance(ctx, user.ID, 0)
+		assert.NoError(t, err)
+		for _, b := range balance {
+			if b.Currency == code {
+				return b
+			}
+		}
+		return nil
+	}
+	if b := balanceOf("XTS"); assert.NotNil(t, b) {
+		assert.Equal(t, int64(0), b.ID)
+		assert.True(t, b.Balance.IsZero())
+	}
+
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: user.ID, Money: money.New(decimal.NewFromInt(100), "XTS"), Operation: store.OperationDeposit})
+	assert.NoError(t, err)
+	if b := balanceOf("XTS"); assert.NotNil(t, b) {
+		assert.NotZero(t, b.ID)
+		assert.True(t, decimal.NewFromInt(100).Equal(b.Balance))
+	}
+
+	// Обмен в новую валюту тоже создаёт строку баланса
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: admin.ID, Money: money.New(decimal.NewFromInt(10), "USD"), Operation: store.OperationDeposit})
+	assert.NoError(t, err)
+	err = repo.ExchangeCurrency(ctx, &store.ExchangeBalance{UserID: admin.ID, FromCurrency: "USD", ToCurrency: "XTS", FromAmount: decimal.NewFromInt(10), ToAmount: decimal.NewFromInt(7), Rate: decimal.RequireFromString("0.7")})
+	assert.NoError(t, err)
+
+	// Отключённая валюта остаётся у тех, у кого есть баланс, и её можно вывести
+	currency.Enabled = false
+	assert.NoError(t, repo.SetCurrency(ctx, currency, entry))
+	assert.NotNil(t, balanceOf("XTS"))
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: user.ID, Money: money.New(decimal.NewFromInt(100), "XTS"), Operation: store.OperationWithdraw})
+	assert.NoError(t, err)
+
+	currencies, err := repo.GetCurrencies(ctx)
+	assert.NoError(t, err)
+	found := false
+	for _, c := range currencies {
+		if c.Code == "XTS" {
+			found = true
+			assert.False(t, c.Enabled)
+		}
+	}
+	assert.True(t, found)
+
+	currency.MinorUnits = 2
+	assert.ErrorIs(t, repo.SetCurrency(ctx, currency, entry), store.ErrMinorUnitsFixed)
+
+	// Без включённых валют пользователь всё равно создаётся целиком
+	rows, err := repo.db.Query(ctx, "UPDATE currencies SET enabled = FALSE WHERE enabled RETURNING code")
+	assert.NoError(t, err)
+	var disabled []string
+	for rows.Next() {
+		var code string
+		assert.NoError(t, rows.Scan(&code))
+		disabled = append(disabled, code)
+	}
+	rows.Close()
+	defer func() {
+		_, err = repo.db.Exec(ctx, "UPDATE currencies SET enabled = TRUE WHERE code = ANY($1)", disabled)
+		assert.NoError(t, err)
+	}()
+
+	late := &store.User{Username: "testcurrencieslate", Email: "testcurrencieslate@example.com", Password: "securepassword"}
+	assert.NoError(t, repo.CreateUser(ctx, late))
+	wallets, err := repo.GetWallets(ctx, late.ID)
+	assert.NoError(t, err)
+	assert.Len(t, wallets, 1)
+}
+
+func TestWallets(t *testing.T) {
+	ctx := context.Background()
+	testStartTime := time.Now()
+
+	repo, err := getRepo(ctx)
+	assert.NoError(t, err)
+	defer repo.Stop(ctx)
+
+	user := &store.User{Username: "testwalletsuser", Email: "testwalletsuser@example.com", Password: "securepassword"}
+	err = repo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+	defer func() {
+		_, err = repo.db.Exec(ctx, "DELETE FROM users WHERE created_at > $1", testStartTime)
+		assert.NoError(t, err)
+	}()
+
+	savings := &store.Wallet{UserID: user.ID, Name: "Savings"}
+	assert.NoError(t, repo.CreateWallet(ctx, savings, 2))
+	assert.NotZero(t, savings.ID)
+	assert.Equal(t, store.WalletActive, savings.Status)
+
+	// Имена уникальны без учёта регистра, число кошельков ограничено
+	assert.ErrorIs(t, repo.CreateWallet(ctx, &store.Wallet{UserID: user.ID, Name: "savings"}, 3), store.ErrWalletNameTaken)
+	assert.ErrorIs(t, repo.CreateWallet(ctx, &store.Wallet{UserID: user.ID, Name: "Travel"}, 2), store.ErrTooManyWallets)
+
+	wallets, err := repo.GetWallets(ctx, user.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, wallets, 2) {
+		assert.True(t, wallets[0].Primary)
+		assert.Equal(t, savings.ID, wallets[1].ID)
+		assert.NotEmpty(t, wallets[1].Balances)
+	}
+
+	// Без id операции идут в основной кошелёк
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: user.ID, Money: money.New(decimal.NewFromInt(100), "USD"), Operation: store.OperationDeposit})
+	assert.NoError(t, err)
+
+	move := &store.Move{UserID: user.ID, ToWalletID: savings.ID, Money: money.New(decimal.NewFromInt(30), "USD")}
+	assert.NoError(t, repo.MoveFunds(ctx, move))
+
+	usd := func(walletID int64) decimal.Decimal {
+		balance, err := repo.GetBalance(ctx, user.ID, walletID)
+		assert.NoError(t, err)
+		for _, b := range balance {
+			if b.Currency == "USD" {
+				return b.Balance
+			}
+		}
+		return decimal.Zero
+	}
+	assert.True(t, decimal.NewFromInt(70).Equal(usd(0)))
+	assert.True(t, decimal.NewFromInt(30).Equal(usd(savings.ID)))
+
+	assert.ErrorIs(t, repo.MoveFunds(ctx, &store.Move{UserID: user.ID, FromWalletID: savings.ID, ToWalletID: savings.ID, Money: money.New(decimal.NewFromInt(1), "USD")}), store.ErrMoveToSameWallet)
+	assert.ErrorIs(t, repo.MoveFunds(ctx, &store.Move{UserID: user.ID, FromWalletID: savings.ID, Money: money.New(decimal.NewFromInt(31), "USD")}), store.ErrInsufficientFunds)
+
+	// Чужой или несуществующий кошелёк не находится
+	_, err = repo.GetBalance(ctx, user.ID, -1)
+	assert.ErrorIs(t, err, store.ErrWalletNotFound)
+	err = repo.UpdateBalance(ctx, &store.UpdateBalance{UserID: user.ID, WalletID: -1, Money: money.New(decimal.NewFromInt(1), "USD"), Operation: store.OperationDeposit})
+	assert.ErrorIs(t, err, store.ErrWalletNotFound)
+
+	// Перевод между своими кошельками виден в истории обоих
+	history, err := repo.GetTransactions(ctx, &store.TransactionFilter{UserID: user.ID, WalletID: savings.ID, Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, store.OperationMove, history[0].Operation)
+		assert.Len(t, history[0].Entries, 2)
+	}
+}
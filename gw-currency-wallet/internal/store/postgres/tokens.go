@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+// tokenDigest is what is stored and looked up instead of the token itself, so
+// the table alone does not give access to any session.
+func tokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RotateRefreshToken revokes the presented token and stores its successor in
+// the same family. Presenting an already revoked token means it was stolen
+// or replayed, so the whole family is revoked and ErrTokenReused returned.
+func (repo *PostgresRepo) RotateRefreshToken(ctx context.Context, old, next *store.RefreshToken) error {
+	repo.log.Info().Int64("userID", old.UserID).Msg("Rotating refresh token")
+
+	var (
+		sqlFind = `SELECT id, family_id, revoked
+		FROM refresh_tokens
+		WHERE user_id = $1 AND token_hash = $2 AND expires_at > NOW()
+		FOR UPDATE`
+		sqlRevoke = `UPDATE refresh_tokens SET revoked = true, last_used_at = NOW() WHERE id = $1`
+		sqlCreate = `INSERT INTO refresh_tokens (user_id, token_hash, expires_at, revoked, family_id, user_agent, ip)
+		VALUES ($1, $2, $3, false, $4, $5, $6)`
+		reused bool
+	)
+
+	err := repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		var revoked bool
+		err := tx.QueryRow(ctx, sqlFind, old.UserID, tokenDigest(old.Token)).Scan(&old.ID, &old.FamilyID, &revoked)
+		if err == pgx.ErrNoRows {
+			repo.log.Warn().Int64("userID", old.UserID).Msg("Refresh token not found or expired")
+			return errors.New("token not found")
+		} else if err != nil {
+			return errors.Wrap(err, "failed to check refresh token")
+		}
+
+		if revoked {
+			reused = true
+			return repo.revokeFamily(ctx, tx, old.FamilyID)
+		}
+
+		if _, err = tx.Exec(ctx, sqlRevoke, old.ID); err != nil {
+			return errors.Wrap(err, "failed to revoke refresh token")
+		}
+
+		next.FamilyID = old.FamilyID
+		_, err = tx.Exec(ctx, sqlCreate, next.UserID, tokenDigest(next.Token), next.ExpiresAt, next.FamilyID, next.UserAgent, next.IP)
+		if err != nil {
+			return errors.Wrap(err, "failed to create refresh token")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if reused {
+		repo.log.Warn().
+			Str("event", "refresh_token_reuse").
+			Int64("userID", old.UserID).
+			Int64("familyID", old.FamilyID).
+			Msg("Security event: revoked refresh token was presented again, token family revoked")
+		return store.ErrTokenReused
+	}
+	return nil
+}
+
+func (repo *PostgresRepo) revokeFamily(ctx context.Context, tx pgx.Tx, familyID int64) error {
+	_, err := tx.Exec(ctx, `UPDATE refresh_tokens SET revoked = true WHERE family_id = $1 AND revoked = false`, familyID)
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke token family")
+	}
+	return nil
+}
+
+// RevokeRefreshToken ends the session the token belongs to: every token of
+// its family is revoked.
+func (repo *PostgresRepo) RevokeRefreshToken(ctx context.Context, token *store.RefreshToken) error {
+	repo.log.Info().Int64("userID", token.UserID).Msg("Revoking refresh token")
+
+	sql := `UPDATE refresh_tokens
+	SET revoked = true
+	WHERE family_id = (
+		SELECT family_id FROM refresh_tokens WHERE user_id = $1 AND token_hash = $2 AND revoked = false
+	) AND revoked = false`
+
+	tag, err := repo.db.Exec(ctx, sql, token.UserID, tokenDigest(token.Token))
+	if err != nil {
+		repo.log.Error().Err(err).Int64("userID", token.UserID).Msg("Failed to revoke refresh token")
+		return errors.Wrap(err, "failed to revoke refresh token")
+	}
+	if tag.RowsAffected() == 0 {
+		repo.log.Warn().Int64("userID", token.UserID).Msg("Refresh token not found or already revoked")
+		return errors.New("token not found")
+	}
+	return nil
+}
+
+const sqlRevokeUserTokens = `UPDATE refresh_tokens SET revoked = true WHERE user_id = $1 AND revoked = false`
+
+func (repo *PostgresRepo) RevokeUserTokens(ctx context.Context, userid int64) error {
+	repo.log.Info().Int64("userID", userid).Msg("Revoking all refresh tokens of the user")
+
+	tag, err := repo.db.Exec(ctx, sqlRevokeUserTokens, userid)
+	if err != nil {
+		repo.log.Error().Err(err).Int64("userID", userid).Msg("Failed to revoke refresh tokens")
+		return errors.Wrap(err, "failed to revoke refresh tokens")
+	}
+	repo.log.Debug().Int64("userID", userid).Int64("count", tag.RowsAffected()).Msg("Refresh tokens revoked")
+	return nil
+}
+
+// GetSessions returns the user's sessions that still have a usable refresh
+// token, most recently used first.
+func (repo *PostgresRepo) GetSessions(ctx context.Context, userid int64) ([]*store.Session, error) {
+	repo.log.Info().Int64("userID", userid).Msg("Fetching sessions")
+
+	sql := `SELECT
+	rt.family_id,
+	rt.user_agent,
+	rt.ip,
+	MIN(f.created_at),
+	MAX(COALESCE(f.last_used_at, f.created_at)) AS last_used_at
+	FROM
+	refresh_tokens rt
+	INNER JOIN
+	refresh_tokens f
+	ON
+	f.family_id = rt.family_id
+	WHERE
+	rt.user_id = $1 AND
+	rt.revoked = false AND
+	rt.expires_at > NOW()
+	GROUP BY rt.family_id, rt.user_agent, rt.ip
+	ORDER BY last_used_at DESC`
+
+	rows, err := repo.db.Query(ctx, sql, userid)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to query sessions")
+		return nil, errors.Wrap(err, "failed to query sessions")
+	}
+	defer rows.Close()
+
+	var sessions []*store.Session
+	for rows.Next() {
+		var session store.Session
+		err = rows.Scan(&session.ID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastUsedAt)
+		if err != nil {
+			repo.log.Error().Err(err).Msg("Failed to scan row")
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		sessions = append(sessions, &session)
+	}
+	return sessions, rows.Err()
+}
+
+func (repo *PostgresRepo) RevokeSession(ctx context.Context, userid, sessionID int64) error {
+	repo.log.Info().Int64("userID", userid).Int64("sessionID", sessionID).Msg("Revoking session")
+
+	sql := `UPDATE refresh_tokens
+	SET revoked = true
+	WHERE user_id = $1 AND family_id = $2 AND revoked = false`
+
+	tag, err := repo.db.Exec(ctx, sql, userid, sessionID)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to revoke session")
+		return errors.Wrap(err, "failed to revoke session")
+	}
+	if tag.RowsAffected() == 0 {
+		return store.ErrSessionNotFound
+	}
+	return nil
+}
+
+// PurgeExpiredTokens deletes refresh tokens that can no longer be used.
+func (repo *PostgresRepo) PurgeExpiredTokens(ctx context.Context) (int64, error) {
+	tag, err := repo.db.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge expired tokens")
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (repo *PostgresRepo) purgeTokens(ctx context.Context) {
+	repo.log.Debug().Msg("Expired tokens purge worker is started")
+
+	ticker := time.NewTicker(repo.config.TokensPurgePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-repo.stop:
+			repo.log.Info().Msg("Expired tokens purge worker is stopped..")
+			return
+		case <-ticker.C:
+			purged, err := repo.PurgeExpiredTokens(ctx)
+			if err != nil {
+				repo.log.Err(err).Msg("Failed to purge expired tokens")
+				continue
+			}
+			repo.log.Debug().Int64("count", purged).Msg("Expired tokens purged")
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+// userColumns are the columns scanUser reads, selected from users aliased u.
+const userColumns = `u.id, u.username, u.email, u.created_at, u.updated_at, u.email_verified_at, u.role, u.frozen_at`
+
+func scanUser(row pgx.Row) (*store.User, error) {
+	user := &store.User{}
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt,
+		&user.EmailVerifiedAt, &user.Role, &user.FrozenAt)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (repo *PostgresRepo) GetUser(ctx context.Context, userid int64) (*store.User, error) {
+	sql := `SELECT ` + userColumns + ` FROM users u WHERE u.id = $1`
+
+	user, err := scanUser(repo.db.QueryRow(ctx, sql, userid))
+	if err == pgx.ErrNoRows {
+		return nil, store.ErrUserNotFound
+	} else if err != nil {
+		repo.log.Error().Err(err).Int64("userID", userid).Msg("Failed to get user")
+		return nil, errors.Wrap(err, "failed to get user")
+	}
+	return user, nil
+}
+
+// FindUsers returns the users whose username or email starts with the
+// query, ignoring case.
+func (repo *PostgresRepo) FindUsers(ctx context.Context, query string, limit int) ([]*store.User, error) {
+	sql := `SELECT ` + userColumns + ` FROM users u
+	WHERE lower(u.username) LIKE $1 || '%' OR lower(u.email) LIKE $1 || '%'
+	ORDER BY u.id LIMIT $2`
+
+	rows, err := repo.db.Query(ctx, sql, escapeLike(strings.ToLower(query)), limit)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to find users")
+		return nil, errors.Wrap(err, "failed to find users")
+	}
+	defer rows.Close()
+
+	users := []*store.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan user")
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// escapeLike makes the wildcards of LIKE match themselves.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SetUserRole changes the role of the user and revokes the user's refresh
+// tokens, so the new role is in every token from the next login on.
+func (repo *PostgresRepo) SetUserRole(ctx context.Context, userid int64, role string, entry *store.AuditEntry) error {
+	sql := `UPDATE users SET role = $2 WHERE id = $1`
+
+	return repo.adminUpdate(ctx, entry, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sql, userid, role)
+		if err != nil {
+			return errors.Wrap(err, "failed to set role")
+		}
+		if tag.RowsAffected() == 0 {
+			return store.ErrUserNotFound
+		}
+		_, err = tx.Exec(ctx, sqlRevokeUserTokens, userid)
+		return errors.Wrap(err, "failed to revoke refresh tokens")
+	})
+}
+
+// FreezeUser blocks the logins and operations of the user and revokes the
+// user's refresh tokens.
+func (repo *PostgresRepo) FreezeUser(ctx context.Context, userid int64, entry *store.AuditEntry) error {
+	sql := `UPDATE users SET frozen_at = NOW() WHERE id = $1 AND frozen_at IS NULL`
+
+	return repo.adminUpdate(ctx, entry, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sql, userid)
+		if err != nil {
+			return errors.Wrap(err, "failed to freeze user")
+		}
+		if tag.RowsAffected() == 0 {
+			return repo.explainFrozen(ctx, tx, userid, store.ErrAccountFrozen)
+		}
+		_, err = tx.Exec(ctx, sqlRevokeUserTokens, userid)
+		return errors.Wrap(err, "failed to revoke refresh tokens")
+	})
+}
+
+func (repo *PostgresRepo) UnfreezeUser(ctx context.Context, userid int64, entry *store.AuditEntry) error {
+	sql := `UPDATE users SET frozen_at = NULL WHERE id = $1 AND frozen_at IS NOT NULL`
+
+	return repo.adminUpdate(ctx, entry, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sql, userid)
+		if err != nil {
+			return errors.Wrap(err, "failed to unfreeze user")
+		}
+		if tag.RowsAffected() == 0 {
+			return repo.explainFrozen(ctx, tx, userid, store.ErrAccountNotFrozen)
+		}
+		return nil
+	})
+}
+
+// explainFrozen tells a missing user from one already in the wanted state.
+func (repo *PostgresRepo) explainFrozen(ctx context.Context, tx pgx.Tx, userid int64, stateErr error) error {
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userid).Scan(&exists)
+	if err != nil {
+		return errors.Wrap(err, "failed to check user")
+	}
+	if !exists {
+		return store.ErrUserNotFound
+	}
+	return stateErr
+}
+
+// adminUpdate runs the change and records it in the audit log in one
+// transaction, so no change is left unrecorded.
+func (repo *PostgresRepo) adminUpdate(ctx context.Context, entry *store.AuditEntry, fn func(tx pgx.Tx) error) error {
+	err := repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return repo.recordAudit(ctx, tx, entry)
+	})
+	if err != nil {
+		repo.log.Warn().Err(err).Int64("actorID", entry.ActorID).Str("action", entry.Action).Msg("Admin action failed")
+		return err
+	}
+
+	repo.log.Info().Int64("actorID", entry.ActorID).Str("action", entry.Action).Msg("Admin action done")
+	return nil
+}
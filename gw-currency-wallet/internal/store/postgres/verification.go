@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+func (repo *PostgresRepo) CreateEmailVerification(ctx context.Context, verification *store.EmailVerification) error {
+	repo.log.Info().Int64("userID", verification.UserID).Msg("Creating email verification token")
+
+	sql := `INSERT INTO email_verification_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	_, err := repo.db.Exec(ctx, sql, verification.UserID, tokenDigest(verification.Token), verification.ExpiresAt)
+	if err != nil {
+		repo.log.Error().Err(err).Int64("userID", verification.UserID).Msg("Failed to create email verification token")
+		return errors.Wrap(err, "failed to create email verification token")
+	}
+	return nil
+}
+
+// VerifyEmail spends the token and marks the email of its user verified. A
+// token works once and only before it expires.
+func (repo *PostgresRepo) VerifyEmail(ctx context.Context, token string) (int64, error) {
+	var (
+		sqlUse = `UPDATE email_verification_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`
+		sqlVerify = `UPDATE users SET email_verified_at = NOW() WHERE id = $1 AND email_verified_at IS NULL`
+		userID    int64
+	)
+
+	err := repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, sqlUse, tokenDigest(token)).Scan(&userID)
+		if err == pgx.ErrNoRows {
+			return store.ErrVerificationFailed
+		} else if err != nil {
+			return errors.Wrap(err, "failed to use verification token")
+		}
+
+		if _, err = tx.Exec(ctx, sqlVerify, userID); err != nil {
+			return errors.Wrap(err, "failed to verify email")
+		}
+		return nil
+	})
+	if err != nil {
+		repo.log.Warn().Err(err).Msg("Email verification failed")
+		return 0, err
+	}
+
+	repo.log.Info().Int64("userID", userID).Msg("Email verified")
+	return userID, nil
+}
@@ -0,0 +1,232 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/store"
+	"github.com/pkg/errors"
+)
+
+// walletCondition matches the wallet w given by the user id in $1 and the
+// wallet id in $2; a zero wallet id means the user's primary wallet.
+const walletCondition = `w.user_id = $1 AND (w.id = $2 OR ($2 = 0 AND w.is_primary))`
+
+// walletFor resolves the user's wallet and refuses operations its status
+// does not allow: a frozen wallet only accepts incoming funds, a closed one
+// nothing. The wallet row stays share locked until the transaction ends, so
+// the status cannot change while the operation runs.
+func (repo *PostgresRepo) walletFor(ctx context.Context, tx pgx.Tx, userid, walletID int64, outgoing bool) (int64, error) {
+	sql := `SELECT w.id, w.status FROM wallets w WHERE ` + walletCondition + ` FOR SHARE`
+
+	var status string
+	err := tx.QueryRow(ctx, sql, userid, walletID).Scan(&walletID, &status)
+	if err == pgx.ErrNoRows {
+		return 0, store.ErrWalletNotFound
+	} else if err != nil {
+		return 0, errors.Wrap(err, "failed to check wallet status")
+	}
+
+	switch {
+	case status == store.WalletClosed:
+		repo.log.Warn().Int64("userID", userid).Int64("walletID", walletID).Msg("Operation on a closed wallet")
+		return 0, store.ErrWalletClosed
+	case status == store.WalletFrozen && outgoing:
+		repo.log.Warn().Int64("userID", userid).Int64("walletID", walletID).Msg("Outgoing operation on a frozen wallet")
+		return 0, store.ErrWalletFrozen
+	}
+	return walletID, nil
+}
+
+// SetWalletStatus moves the user's wallet to the status. Only an empty
+// wallet can be closed and a closed wallet stays closed; the wallet and its
+// previous status are added to the audit entry.
+func (repo *PostgresRepo) SetWalletStatus(ctx context.Context, userid, walletID int64, status string, entry *store.AuditEntry) error {
+	var (
+		sqlCurrent = `SELECT w.id, w.status FROM wallets w WHERE ` + walletCondition + ` FOR UPDATE`
+		sqlFunds   = `SELECT EXISTS (SELECT 1 FROM wallet_balances WHERE wallet_id = $1 AND balance <> 0)`
+		sqlUpdate  = `UPDATE wallets SET status = $2 WHERE id = $1`
+	)
+
+	return repo.adminUpdate(ctx, entry, func(tx pgx.Tx) error {
+		var current string
+		err := tx.QueryRow(ctx, sqlCurrent, userid, walletID).Scan(&walletID, &current)
+		if err == pgx.ErrNoRows && walletID == 0 {
+			return store.ErrUserNotFound
+		} else if err == pgx.ErrNoRows {
+			return store.ErrWalletNotFound
+		} else if err != nil {
+			return errors.Wrap(err, "failed to get wallet status")
+		}
+
+		switch current {
+		case store.WalletClosed:
+			return store.ErrWalletClosed
+		case status:
+			return store.ErrWalletStatusSame
+		}
+
+		// nothing can leave a closed wallet, so it has to be emptied first;
+		// operations share lock the wallet, the balances cannot change
+		// until the status is set
+		if status == store.WalletClosed {
+			var funded bool
+			if err = tx.QueryRow(ctx, sqlFunds, walletID).Scan(&funded); err != nil {
+				return errors.Wrap(err, "failed to check wallet balances")
+			}
+			if funded {
+				return store.ErrWalletNotEmpty
+			}
+		}
+
+		_, err = tx.Exec(ctx, sqlUpdate, walletID, status)
+		if err != nil {
+			return errors.Wrap(err, "failed to set wallet status")
+		}
+
+		if entry.Details == nil {
+			entry.Details = map[string]string{}
+		}
+		entry.Details["wallet_id"] = fmt.Sprint(walletID)
+		entry.Details["previous_status"] = current
+		return nil
+	})
+}
+
+// GetWallets returns the user's wallets with their balances, the primary
+// wallet first.
+func (repo *PostgresRepo) GetWallets(ctx context.Context, userid int64) ([]*store.Wallet, error) {
+	repo.log.Info().Int64("userID", userid).Msg("Fetching wallets")
+
+	sql := `SELECT id, user_id, name, is_primary, status, created_at, updated_at
+	FROM wallets
+	WHERE user_id = $1
+	ORDER BY is_primary DESC, id`
+
+	rows, err := repo.db.Query(ctx, sql, userid)
+	if err != nil {
+		repo.log.Error().Err(err).Msg("Failed to query wallets")
+		return nil, errors.Wrap(err, "failed to query wallets")
+	}
+	defer rows.Close()
+
+	var (
+		wallets []*store.Wallet
+		byID    = make(map[int64]*store.Wallet)
+	)
+	for rows.Next() {
+		var wallet store.Wallet
+		err = rows.Scan(&wallet.ID, &wallet.UserID, &wallet.Name, &wallet.Primary, &wallet.Status, &wallet.CreatedAt, &wallet.UpdatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		wallets = append(wallets, &wallet)
+		byID[wallet.ID] = &wallet
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read wallets")
+	}
+
+	balances, err := repo.balances(ctx, "w.user_id = $1", userid)
+	if err != nil {
+		return nil, err
+	}
+	for _, balance := range balances {
+		// a wallet created between the two queries is left for the next call
+		wallet, ok := byID[balance.WalletID]
+		if !ok {
+			continue
+		}
+		wallet.Balances = append(wallet.Balances, balance)
+	}
+	return wallets, nil
+}
+
+// CreateWallet adds a named wallet with a zero balance in every enabled
+// currency. Closed wallets do not count towards maxWallets.
+func (repo *PostgresRepo) CreateWallet(ctx context.Context, wallet *store.Wallet, maxWallets int) error {
+	var (
+		sqlUser     = `SELECT 1 FROM users WHERE id = $1 FOR NO KEY UPDATE`
+		sqlCount    = `SELECT COUNT(*) FROM wallets WHERE user_id = $1 AND status <> 'closed'`
+		sqlWallet   = `INSERT INTO wallets (user_id, name) VALUES ($1, $2) RETURNING id, status, created_at, updated_at`
+		sqlBalances = `INSERT INTO wallet_balances (wallet_id, currency, balance) SELECT $1, code, 0 FROM currencies WHERE enabled`
+	)
+
+	repo.log.Info().Int64("userID", wallet.UserID).Str("name", wallet.Name).Msg("Creating wallet")
+
+	return repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		// the user row lock keeps concurrent requests from passing the
+		// count together
+		var exists int
+		err := tx.QueryRow(ctx, sqlUser, wallet.UserID).Scan(&exists)
+		if err == pgx.ErrNoRows {
+			return store.ErrUserNotFound
+		} else if err != nil {
+			return errors.Wrap(err, "failed to lock user")
+		}
+
+		var count int
+		err = tx.QueryRow(ctx, sqlCount, wallet.UserID).Scan(&count)
+		if err != nil {
+			return errors.Wrap(err, "failed to count wallets")
+		}
+		if count >= maxWallets {
+			return store.ErrTooManyWallets
+		}
+
+		err = tx.QueryRow(ctx, sqlWallet, wallet.UserID, wallet.Name).Scan(&wallet.ID, &wallet.Status, &wallet.CreatedAt, &wallet.UpdatedAt)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return store.ErrWalletNameTaken
+		} else if err != nil {
+			return errors.Wrap(err, "failed to create wallet")
+		}
+
+		_, err = tx.Exec(ctx, sqlBalances, wallet.ID)
+		if err != nil {
+			return errors.Wrap(err, "failed to set initial wallet balances")
+		}
+		repo.log.Info().Int64("walletID", wallet.ID).Msg("Wallet created successfully")
+		return nil
+	})
+}
+
+// MoveFunds takes funds from one of the user's wallets to another. The move
+// is a single transaction whose entries both point at the user's balances.
+func (repo *PostgresRepo) MoveFunds(ctx context.Context, move *store.Move) error {
+	repo.log.Info().Int64("userID", move.UserID).Int64("from", move.FromWalletID).Int64("to", move.ToWalletID).Str("currency", move.Currency).Msg("Moving funds between wallets")
+
+	return repo.inTransaction(ctx, func(tx pgx.Tx) error {
+		fromID, err := repo.walletFor(ctx, tx, move.UserID, move.FromWalletID, true)
+		if err != nil {
+			return err
+		}
+		toID, err := repo.walletFor(ctx, tx, move.UserID, move.ToWalletID, false)
+		if err != nil {
+			return err
+		}
+		if fromID == toID {
+			return store.ErrMoveToSameWallet
+		}
+
+		err = repo.ensureBalance(ctx, tx, toID, move.Currency)
+		if err != nil {
+			return err
+		}
+		err = repo.lockTransferBalances(ctx, tx, fromID, move.Currency, toID, move.Currency)
+		if err != nil {
+			return err
+		}
+		from, err := repo.updateBalance(ctx, tx, move.Amount, fromID, move.Currency, "-")
+		if err != nil {
+			return err
+		}
+		to, err := repo.updateBalance(ctx, tx, move.Amount, toID, move.Currency, "+")
+		if err != nil {
+			return errors.Wrap(err, "failed to update target wallet balance")
+		}
+		return repo.recordTransaction(ctx, tx, moveTransaction(from, to, move.Amount))
+	})
+}
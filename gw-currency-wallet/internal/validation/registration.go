@@ -0,0 +1,132 @@
+package validation
+
+import (
+	"bufio"
+	"fmt"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/pkg/errors"
+)
+
+const (
+	// bcrypt ignores everything past 72 bytes
+	passwordMaxBytes = 72
+	emailMaxLength   = 254
+)
+
+// usernames cannot contain "@", so a username never reads as an email where
+// either is accepted, e.g. as a transfer recipient
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Registration checks new accounts against the configured policy.
+type Registration struct {
+	cfg      config.Registration
+	breached map[string]struct{}
+}
+
+func NewRegistration(cfg config.Registration) (*Registration, error) {
+	r := &Registration{
+		cfg:      cfg,
+		breached: make(map[string]struct{}),
+	}
+	if cfg.BreachedPasswordsFile == "" {
+		return r, nil
+	}
+
+	file, err := os.Open(cfg.BreachedPasswordsFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open breached passwords file")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			r.breached[strings.ToLower(password)] = struct{}{}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read breached passwords file")
+	}
+	return r, nil
+}
+
+// Validate normalizes the request in place, trimming the username and
+// case-folding the email, and returns domain.FieldErrors listing every
+// field that breaks the policy.
+func (r *Registration) Validate(req *domain.RegisterRequest) error {
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+
+	fields := domain.FieldErrors{}
+	if problem := r.checkUsername(req.Username); problem != "" {
+		fields["username"] = problem
+	}
+	if problem := checkEmail(req.Email); problem != "" {
+		fields["email"] = problem
+	}
+	if problem := r.checkPassword(req.Password, req.Username, req.Email); problem != "" {
+		fields["password"] = problem
+	}
+
+	if len(fields) > 0 {
+		return fields
+	}
+	return nil
+}
+
+func (r *Registration) checkUsername(username string) string {
+	length := utf8.RuneCountInString(username)
+	switch {
+	case length < r.cfg.UsernameMinLength || length > r.cfg.UsernameMaxLength:
+		return fmt.Sprintf("must be between %d and %d characters long", r.cfg.UsernameMinLength, r.cfg.UsernameMaxLength)
+	case !usernamePattern.MatchString(username):
+		return "may contain only latin letters, digits, '_', '.' and '-' and must start with a letter or a digit"
+	}
+	return ""
+}
+
+func checkEmail(email string) string {
+	if len(email) > emailMaxLength {
+		return "is too long"
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return "is not a valid email address"
+	}
+	_, domainPart, _ := strings.Cut(email, "@")
+	if !strings.Contains(domainPart, ".") {
+		return "is not a valid email address"
+	}
+	return ""
+}
+
+// ValidatePassword checks a new password of an existing account against the
+// same policy as at registration and reports it as the new_password field.
+func (r *Registration) ValidatePassword(password, username, email string) error {
+	if problem := r.checkPassword(password, username, email); problem != "" {
+		return domain.FieldErrors{"new_password": problem}
+	}
+	return nil
+}
+
+func (r *Registration) checkPassword(password, username, email string) string {
+	switch {
+	case utf8.RuneCountInString(password) < r.cfg.PasswordMinLength:
+		return fmt.Sprintf("must be at least %d characters long", r.cfg.PasswordMinLength)
+	case len(password) > passwordMaxBytes:
+		return fmt.Sprintf("must not be longer than %d bytes", passwordMaxBytes)
+	case strings.EqualFold(password, username) || strings.EqualFold(password, email):
+		return "must differ from the username and the email"
+	}
+	if _, ok := r.breached[strings.ToLower(password)]; ok {
+		return "is too common or has appeared in a data breach"
+	}
+	return ""
+}
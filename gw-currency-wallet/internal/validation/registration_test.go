@@ -0,0 +1,117 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistration(t *testing.T) *Registration {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	err := os.WriteFile(path, []byte("qwerty123\n\nIloveyou1\n"), 0o600)
+	assert.NoError(t, err)
+
+	r, err := NewRegistration(config.Registration{
+		UsernameMinLength:     3,
+		UsernameMaxLength:     16,
+		PasswordMinLength:     8,
+		BreachedPasswordsFile: path,
+	})
+	assert.NoError(t, err)
+	return r
+}
+
+func TestValidateNormalizes(t *testing.T) {
+	r := newTestRegistration(t)
+
+	req := &domain.RegisterRequest{Username: " john.doe ", Email: " John.Doe@Example.COM ", Password: "correct horse"}
+	assert.NoError(t, r.Validate(req))
+	assert.Equal(t, "john.doe", req.Username)
+	assert.Equal(t, "john.doe@example.com", req.Email)
+}
+
+func TestValidateFields(t *testing.T) {
+	r := newTestRegistration(t)
+
+	tests := []struct {
+		name   string
+		req    domain.RegisterRequest
+		fields []string
+	}{
+		{
+			name:   "short username",
+			req:    domain.RegisterRequest{Username: "jo", Email: "jo@example.com", Password: "correct horse"},
+			fields: []string{"username"},
+		},
+		{
+			name:   "username with at sign",
+			req:    domain.RegisterRequest{Username: "jo@example.com", Email: "jo@example.com", Password: "correct horse"},
+			fields: []string{"username"},
+		},
+		{
+			name:   "email with display name",
+			req:    domain.RegisterRequest{Username: "john", Email: "John <john@example.com>", Password: "correct horse"},
+			fields: []string{"email"},
+		},
+		{
+			name:   "email without domain",
+			req:    domain.RegisterRequest{Username: "john", Email: "john@localhost", Password: "correct horse"},
+			fields: []string{"email"},
+		},
+		{
+			name:   "short password",
+			req:    domain.RegisterRequest{Username: "john", Email: "john@example.com", Password: "short"},
+			fields: []string{"password"},
+		},
+		{
+			name:   "breached password in another case",
+			req:    domain.RegisterRequest{Username: "john", Email: "john@example.com", Password: "ILOVEYOU1"},
+			fields: []string{"password"},
+		},
+		{
+			name:   "password equals username",
+			req:    domain.RegisterRequest{Username: "johnsmith", Email: "john@example.com", Password: "JohnSmith"},
+			fields: []string{"password"},
+		},
+		{
+			name:   "everything wrong",
+			req:    domain.RegisterRequest{Username: "", Email: "nope", Password: ""},
+			fields: []string{"username", "email", "password"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Validate(&tt.req)
+
+			var fields domain.FieldErrors
+			assert.True(t, errors.As(err, &fields))
+			assert.Len(t, fields, len(tt.fields))
+			for _, field := range tt.fields {
+				assert.Contains(t, fields, field)
+			}
+		})
+	}
+}
+
+func TestMissingBreachedFile(t *testing.T) {
+	_, err := NewRegistration(config.Registration{BreachedPasswordsFile: filepath.Join(t.TempDir(), "missing.txt")})
+	assert.Error(t, err)
+}
+
+func TestValidatePassword(t *testing.T) {
+	r := newTestRegistration(t)
+
+	assert.NoError(t, r.ValidatePassword("correct horse", "john", "john@example.com"))
+
+	err := r.ValidatePassword("qwerty123", "john", "john@example.com")
+	var fields domain.FieldErrors
+	assert.True(t, errors.As(err, &fields))
+	assert.Contains(t, fields, "new_password")
+
+	assert.Error(t, r.ValidatePassword("John@Example.com", "john", "john@example.com"))
+}
@@ -0,0 +1,196 @@
+package jwttoken
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// KeySet signs tokens with its active key and verifies them with any key it
+// knows, so the signing key can be rotated while tokens signed with the
+// previous one are still in use.
+type KeySet struct {
+	method     jwt.SigningMethod
+	signingKey interface{}
+	signingKID string
+	keys       map[string]*verificationKey
+}
+
+// NewHMACKeySet returns a key set that signs and verifies with a shared
+// secret. Its tokens carry no kid and it publishes no keys.
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{
+		method:     jwt.SigningMethodHS256,
+		signingKey: []byte(secret),
+		keys: map[string]*verificationKey{
+			"": {method: jwt.SigningMethodHS256, key: []byte(secret)},
+		},
+	}
+}
+
+// NewKeySet returns a key set that signs with the PEM encoded private key
+// (RSA for RS256, Ed25519 for EdDSA) and additionally accepts tokens signed
+// by the keys of the PEM encoded public keys. The kid of every key is derived
+// from its public part.
+func NewKeySet(privatePEM []byte, publicPEMs ...[]byte) (*KeySet, error) {
+	signer, err := parsePrivateKey(privatePEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signing key")
+	}
+
+	ks := &KeySet{keys: make(map[string]*verificationKey, len(publicPEMs)+1)}
+
+	ks.signingKID, err = ks.add(signer.Public())
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signing key")
+	}
+	ks.method = ks.keys[ks.signingKID].method
+	ks.signingKey = signer
+
+	for i, publicPEM := range publicPEMs {
+		public, err := parsePublicKey(publicPEM)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid verification key #%d", i+1)
+		}
+		if _, err := ks.add(public); err != nil {
+			return nil, errors.Wrapf(err, "invalid verification key #%d", i+1)
+		}
+	}
+
+	return ks, nil
+}
+
+// KeyID returns the kid of the signing key, empty for a shared secret.
+func (ks *KeySet) KeyID() string {
+	return ks.signingKID
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.method, claims)
+	if ks.signingKID != "" {
+		token.Header["kid"] = ks.signingKID
+	}
+	return token.SignedString(ks.signingKey)
+}
+
+// keyFunc picks the verification key by the token's kid and refuses tokens
+// whose algorithm does not match that key.
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+	return key.key, nil
+}
+
+func (ks *KeySet) add(public crypto.PublicKey) (string, error) {
+	var method jwt.SigningMethod
+	switch public.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return "", errors.Errorf("unsupported key type %T", public)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	kid := base64.RawURLEncoding.EncodeToString(sum[:12])
+
+	ks.keys[kid] = &verificationKey{method: method, key: public}
+	return kid, nil
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set. A shared secret is never
+// published, so an HMAC key set returns an empty list.
+func (ks *KeySet) JWKS() *JWKS {
+	set := &JWKS{Keys: []JWK{}}
+	for kid, key := range ks.keys {
+		jwk := JWK{KeyID: kid, Use: "sig", Algorithm: key.method.Alg()}
+		switch public := key.key.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+	return set
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
+
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
@@ -0,0 +1,92 @@
+package jwttoken
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func privatePEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicPEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestKeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	// старый ключ RS256, новый EdDSA
+	oldKeys, err := NewKeySet(privatePEM(t, rsaKey))
+	assert.NoError(t, err)
+	newKeys, err := NewKeySet(privatePEM(t, edKey), publicPEM(t, &rsaKey.PublicKey))
+	assert.NoError(t, err)
+	assert.NotEqual(t, oldKeys.KeyID(), newKeys.KeyID())
+
+	oldToken, err := generateToken(&TokensOption{UserID: 7}, TypeAccess, time.Minute, oldKeys)
+	assert.NoError(t, err)
+	newToken, err := generateToken(&TokensOption{UserID: 7}, TypeAccess, time.Minute, newKeys)
+	assert.NoError(t, err)
+
+	// новый набор принимает токены обоих ключей
+	assert.NoError(t, Validate(oldToken, newKeys, Expected{}))
+	assert.NoError(t, Validate(newToken, newKeys, Expected{}))
+
+	userID, err := GetUserID(oldToken, newKeys, Expected{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), userID)
+
+	// старый набор о новом ключе не знает
+	assert.Error(t, Validate(newToken, oldKeys, Expected{}))
+
+	jwks := newKeys.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+	for _, key := range jwks.Keys {
+		switch key.KeyType {
+		case "RSA":
+			assert.Equal(t, "RS256", key.Algorithm)
+			assert.Equal(t, "AQAB", key.E)
+		case "OKP":
+			assert.Equal(t, "EdDSA", key.Algorithm)
+			assert.Equal(t, "Ed25519", key.Curve)
+			assert.Equal(t, newKeys.KeyID(), key.KeyID)
+			assert.Equal(t, base64.RawURLEncoding.EncodeToString(edPublic), key.X)
+		default:
+			t.Fatalf("unexpected key type %s", key.KeyType)
+		}
+	}
+}
+
+func TestHMACKeySet(t *testing.T) {
+	keys := NewHMACKeySet(accessSecret)
+	assert.Empty(t, keys.JWKS().Keys)
+
+	token, err := generateToken(&TokensOption{UserID: 1}, TypeAccess, time.Minute, keys)
+	assert.NoError(t, err)
+
+	// HS256 токен с чужим секретом не принимается
+	assert.Error(t, Validate(token, NewHMACKeySet(refreshSecret), Expected{}))
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	rsaKeys, err := NewKeySet(privatePEM(t, rsaKey))
+	assert.NoError(t, err)
+
+	// токен без kid не принимается набором с асимметричными ключами
+	assert.Error(t, Validate(token, rsaKeys, Expected{}))
+}
@@ -1,18 +1,21 @@
 package jwttoken
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 func GenerateTokens(options *TokensOption) (string, string, error) {
-	accessToken, err := generateToken(options.AccessExp, options.SecretAccess, options.UserID)
+	accessToken, err := generateToken(options, TypeAccess, options.AccessExp, options.AccessKeys)
 	if err != nil {
 		return "", "", err
 	}
 
-	refreshToken, err := generateToken(options.RefreshExp, options.SecretRefresh, options.UserID)
+	refreshToken, err := generateToken(options, TypeRefresh, options.RefreshExp, options.RefreshKeys)
 	if err != nil {
 		return "", "", err
 	}
@@ -20,15 +23,36 @@ func GenerateTokens(options *TokensOption) (string, string, error) {
 	return accessToken, refreshToken, nil
 }
 
-func generateToken(expTime time.Duration, secret string, id int64) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomClaims{
-		UserID: id,
+// GenerateMFAToken issues the token of a login waiting for its second
+// factor. Like a refresh token it is only checked by this service, so it is
+// signed with the refresh keys.
+func GenerateMFAToken(options *TokensOption, expTime time.Duration) (string, error) {
+	return generateToken(options, TypeMFA, expTime, options.RefreshKeys)
+}
+
+func generateToken(options *TokensOption, typ string, expTime time.Duration, keys *KeySet) (string, error) {
+	// a random id keeps two tokens issued within the same second distinct
+	// and lets a single token be denylisted
+	tokenID := make([]byte, 16)
+	if _, err := rand.Read(tokenID); err != nil {
+		return "", err
+	}
+
+	claims := CustomClaims{
+		UserID: options.UserID,
+		Role:   options.Role,
+		Type:   typ,
 		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   string(rune(id)),
+			ID:        hex.EncodeToString(tokenID),
+			Issuer:    options.Issuer,
+			Subject:   strconv.FormatInt(options.UserID, 10),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expTime)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
-	})
+	}
+	if options.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{options.Audience}
+	}
 
-	return token.SignedString([]byte(secret))
+	return keys.sign(claims)
 }
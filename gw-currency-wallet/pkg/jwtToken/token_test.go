@@ -15,20 +15,95 @@ var (
 
 func TestValidate(t *testing.T) {
 	tokenOpts := &TokensOption{
-		UserID:        1,
-		AccessExp:     time.Minute * 5,
-		RefreshExp:    time.Hour * 24,
-		SecretAccess:  accessSecret,
-		SecretRefresh: refreshSecret,
+		UserID:      1,
+		AccessExp:   time.Minute * 5,
+		RefreshExp:  time.Hour * 24,
+		AccessKeys:  NewHMACKeySet(accessSecret),
+		RefreshKeys: NewHMACKeySet(refreshSecret),
 	}
 
 	access, refresh, err := GenerateTokens(tokenOpts)
 
 	assert.Nil(t, err)
 
-	err = Validate(access, []byte(accessSecret))
+	err = Validate(access, tokenOpts.AccessKeys, Expected{Type: TypeAccess})
 	assert.Nil(t, err)
 
-	err = Validate(refresh, []byte(refreshSecret))
+	err = Validate(refresh, tokenOpts.RefreshKeys, Expected{Type: TypeRefresh})
 	assert.Nil(t, err)
 }
+
+func TestTokensAreUnique(t *testing.T) {
+	tokenOpts := &TokensOption{
+		UserID:      1,
+		AccessExp:   time.Minute * 5,
+		RefreshExp:  time.Hour * 24,
+		AccessKeys:  NewHMACKeySet(accessSecret),
+		RefreshKeys: NewHMACKeySet(refreshSecret),
+	}
+
+	_, first, err := GenerateTokens(tokenOpts)
+	assert.Nil(t, err)
+
+	_, second, err := GenerateTokens(tokenOpts)
+	assert.Nil(t, err)
+
+	assert.NotEqual(t, first, second)
+}
+
+func TestClaims(t *testing.T) {
+	keys := NewHMACKeySet(accessSecret)
+	tokenOpts := &TokensOption{
+		UserID:      42,
+		AccessExp:   time.Minute * 5,
+		RefreshExp:  time.Hour * 24,
+		Issuer:      "gw-currency-wallet",
+		Audience:    "gw-currency",
+		AccessKeys:  keys,
+		RefreshKeys: keys,
+	}
+
+	access, refresh, err := GenerateTokens(tokenOpts)
+	assert.Nil(t, err)
+
+	expected := Expected{Type: TypeAccess, Issuer: "gw-currency-wallet", Audience: "gw-currency"}
+	claims, err := Parse(access, keys, expected)
+	assert.Nil(t, err)
+	assert.Equal(t, "42", claims.Subject)
+	assert.Equal(t, int64(42), claims.UserID)
+	assert.NotEmpty(t, claims.ID)
+
+	// с одинаковым ключом токены различаются только типом
+	_, err = Parse(refresh, keys, expected)
+	assert.Error(t, err)
+
+	_, err = Parse(access, keys, Expected{Type: TypeAccess, Issuer: "other"})
+	assert.Error(t, err)
+
+	_, err = Parse(access, keys, Expected{Type: TypeAccess, Audience: "other"})
+	assert.Error(t, err)
+
+	tokenOpts.AccessExp = -time.Minute
+	expired, _, err := GenerateTokens(tokenOpts)
+	assert.Nil(t, err)
+	_, err = Parse(expired, keys, expected)
+	assert.Error(t, err)
+}
+
+func TestMFAToken(t *testing.T) {
+	tokenOpts := &TokensOption{
+		UserID:      3,
+		AccessKeys:  NewHMACKeySet(accessSecret),
+		RefreshKeys: NewHMACKeySet(refreshSecret),
+	}
+
+	token, err := GenerateMFAToken(tokenOpts, time.Minute)
+	assert.Nil(t, err)
+
+	userID, err := GetUserID(token, tokenOpts.RefreshKeys, Expected{Type: TypeMFA})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), userID)
+
+	// MFA токен не заменяет refresh токен
+	assert.Error(t, Validate(token, tokenOpts.RefreshKeys, Expected{Type: TypeRefresh}))
+}
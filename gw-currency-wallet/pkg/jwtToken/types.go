@@ -6,15 +6,38 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token types, carried in the typ claim so that an access token cannot be
+// used as a refresh token and vice versa. An MFA token only proves the
+// password was right and is exchanged for the other two with a second
+// factor.
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+	TypeMFA     = "mfa"
+)
+
 type TokensOption struct {
-	UserID        int64         `json:"user_id"`
-	RefreshExp    time.Duration `json:"refresh_exp"`
-	AccessExp     time.Duration `json:"access_exp"`
-	SecretRefresh string        `json:"secret_refresh"`
-	SecretAccess  string        `json:"secret_access"`
+	UserID      int64         `json:"user_id"`
+	Role        string        `json:"role"`
+	RefreshExp  time.Duration `json:"refresh_exp"`
+	AccessExp   time.Duration `json:"access_exp"`
+	Issuer      string        `json:"issuer"`
+	Audience    string        `json:"audience"`
+	RefreshKeys *KeySet       `json:"-"`
+	AccessKeys  *KeySet       `json:"-"`
 }
 
 type CustomClaims struct {
 	UserID int64
+	Role   string `json:"role,omitempty"`
+	Type   string `json:"typ"`
 	jwt.RegisteredClaims
 }
+
+// Expected lists what a token must carry to be accepted. Empty fields are
+// not checked.
+type Expected struct {
+	Type     string
+	Issuer   string
+	Audience string
+}
@@ -1,26 +1,37 @@
 package jwttoken
 
 import (
-	"time"
-
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
 )
 
-func Validate(tokenString string, jwtSecret []byte) error {
-	tokenParsed, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrInvalidType
-		}
-		return jwtSecret, nil
-	})
+// Parse verifies the token's signature, expiry, issuer, audience and type
+// and returns its claims.
+func Parse(tokenString string, keys *KeySet, expected Expected) (*CustomClaims, error) {
+	options := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if expected.Issuer != "" {
+		options = append(options, jwt.WithIssuer(expected.Issuer))
+	}
+	if expected.Audience != "" {
+		options = append(options, jwt.WithAudience(expected.Audience))
+	}
+
+	tokenParsed, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, keys.keyFunc, options...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	expTime, err := tokenParsed.Claims.GetExpirationTime()
 
-	if err != nil || time.Now().After(expTime.Time) {
-		return err
+	claims, ok := tokenParsed.Claims.(*CustomClaims)
+	if !ok {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	if expected.Type != "" && claims.Type != expected.Type {
+		return nil, errors.Wrapf(jwt.ErrTokenInvalidClaims, "token type is %q, expected %q", claims.Type, expected.Type)
 	}
+	return claims, nil
+}
 
-	return nil
+func Validate(tokenString string, keys *KeySet, expected Expected) error {
+	_, err := Parse(tokenString, keys, expected)
+	return err
 }
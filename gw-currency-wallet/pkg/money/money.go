@@ -0,0 +1,84 @@
+package money
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// RateScale is the number of decimal places kept for exchange rates.
+const RateScale = 10
+
+const defaultMinorUnits = 2
+
+// minorUnits holds the rounding rule of every currency: how many decimal
+// places an amount in that currency may have. It is filled from the
+// currency catalogue with SetMinorUnits.
+var (
+	minorUnitsMu sync.RWMutex
+	minorUnits   = map[string]int32{}
+)
+
+type Money struct {
+	Currency string          `json:"currency" binding:"required"`
+	Amount   decimal.Decimal `json:"amount" binding:"required" swaggertype:"string" example:"100.50"`
+}
+
+func New(amount decimal.Decimal, currency string) Money {
+	return Money{
+		Currency: currency,
+		Amount:   amount,
+	}
+}
+
+// SetMinorUnits replaces the rounding rules. Currencies missing from units
+// get the default of two decimal places.
+func SetMinorUnits(units map[string]int32) {
+	copied := make(map[string]int32, len(units))
+	for currency, n := range units {
+		copied[currency] = n
+	}
+
+	minorUnitsMu.Lock()
+	minorUnits = copied
+	minorUnitsMu.Unlock()
+}
+
+func MinorUnits(currency string) int32 {
+	minorUnitsMu.RLock()
+	defer minorUnitsMu.RUnlock()
+
+	if units, ok := minorUnits[currency]; ok {
+		return units
+	}
+	return defaultMinorUnits
+}
+
+// Validate accepts only positive amounts that fit the currency's minor
+// units: user input is never rounded silently.
+func (m Money) Validate() error {
+	if m.Currency == "" {
+		return errors.New("currency is required")
+	}
+	if !m.Amount.IsPositive() {
+		return errors.New("amount must be positive")
+	}
+	if !m.Amount.Equal(m.Amount.Truncate(MinorUnits(m.Currency))) {
+		return errors.Errorf("amount has more than %d decimal places for %s", MinorUnits(m.Currency), m.Currency)
+	}
+	return nil
+}
+
+// Rate returns how many units of the target currency one unit of the base
+// currency buys, given both rates against the same reference currency.
+func Rate(baseRate, targetRate decimal.Decimal) decimal.Decimal {
+	return targetRate.DivRound(baseRate, RateScale)
+}
+
+// Convert exchanges the amount at the given rate. The result is rounded down
+// to the target currency's minor units, so an exchange never credits more
+// than was paid for.
+func (m Money) Convert(rate decimal.Decimal, target string) Money {
+	return New(m.Amount.Mul(rate).RoundDown(MinorUnits(target)), target)
+}
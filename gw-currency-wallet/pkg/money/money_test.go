@@ -0,0 +1,51 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, New(decimal.RequireFromString("10.50"), "USD").Validate())
+	assert.NoError(t, New(decimal.RequireFromString("10.500"), "USD").Validate())
+
+	assert.Error(t, New(decimal.RequireFromString("10.505"), "USD").Validate())
+	assert.Error(t, New(decimal.Zero, "USD").Validate())
+	assert.Error(t, New(decimal.RequireFromString("-1"), "USD").Validate())
+	assert.Error(t, New(decimal.RequireFromString("1"), "").Validate())
+}
+
+func TestConvert(t *testing.T) {
+	rate := Rate(decimal.RequireFromString("0.0098"), decimal.RequireFromString("0.0093"))
+	assert.Equal(t, "0.9489795918", rate.String())
+
+	converted := New(decimal.RequireFromString("100"), "USD").Convert(rate, "EUR")
+	assert.Equal(t, "EUR", converted.Currency)
+	assert.Equal(t, "94.89", converted.Amount.String())
+
+	// сумма копеек после обмена не растёт за счёт округления
+	for _, amount := range []string{"0.01", "0.03", "1.07", "999.99"} {
+		from := New(decimal.RequireFromString(amount), "USD")
+		to := from.Convert(decimal.NewFromInt(1), "EUR")
+		assert.True(t, to.Amount.Equal(from.Amount))
+	}
+}
+
+func TestSetMinorUnits(t *testing.T) {
+	SetMinorUnits(map[string]int32{"JPY": 0, "BTC": 8})
+	defer SetMinorUnits(nil)
+
+	assert.Equal(t, int32(0), MinorUnits("JPY"))
+	assert.Equal(t, int32(8), MinorUnits("BTC"))
+	// валюта без правила округляется до копеек
+	assert.Equal(t, int32(2), MinorUnits("USD"))
+
+	assert.NoError(t, New(decimal.RequireFromString("100"), "JPY").Validate())
+	assert.Error(t, New(decimal.RequireFromString("100.5"), "JPY").Validate())
+	assert.NoError(t, New(decimal.RequireFromString("0.00000001"), "BTC").Validate())
+
+	converted := New(decimal.RequireFromString("10"), "USD").Convert(decimal.RequireFromString("151.237"), "JPY")
+	assert.Equal(t, "1512", converted.Amount.String())
+}
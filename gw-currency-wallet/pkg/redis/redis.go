@@ -3,7 +3,6 @@ package redis
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -40,21 +39,78 @@ func (r *RedisClient) Stop(_ context.Context) error {
 	return nil
 }
 
-func (r *RedisClient) Set(ctx context.Context, key string, value float64, expiration time.Duration) error {
+func (r *RedisClient) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	return r.Client.SetNX(ctx, key, value, expiration).Result()
+}
+
+func (r *RedisClient) SetBytes(ctx context.Context, key string, value []byte, expiration time.Duration) error {
 	return r.Client.Set(ctx, key, value, expiration).Err()
 }
 
-func (r *RedisClient) Get(ctx context.Context, key string) (float64, error) {
-	rateRaw, err := r.Client.Get(ctx, key).Result()
+func (r *RedisClient) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.Client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+	return value, err
+}
+
+func (r *RedisClient) Del(ctx context.Context, key string) error {
+	return r.Client.Del(ctx, key).Err()
+}
+
+// GetDelBytes reads the key and deletes it in one step, so the value can be
+// taken only once. A missing key gives nil and no error, leaving errors to
+// the cases where Redis could not answer.
+func (r *RedisClient) GetDelBytes(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.Client.GetDel(ctx, key).Bytes()
 	if err == redis.Nil {
-		return 0, fmt.Errorf("key %s not found", key)
+		return nil, nil
 	}
+	return value, err
+}
+
+func (r *RedisClient) Exists(ctx context.Context, key string) (bool, error) {
+	count, err := r.Client.Exists(ctx, key).Result()
+	return count > 0, err
+}
+
+// Incr increments the counter and starts its expiration when the counter
+// is created, so the counter covers a fixed window from the first hit. The
+// counter is created with its expiration and incremented in one
+// transaction, so it cannot be left without one.
+func (r *RedisClient) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetNX(ctx, key, 0, expiration)
+		incr = pipe.Incr(ctx, key)
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
-	rate, err := strconv.ParseFloat(rateRaw, 64)
+	return incr.Val(), nil
+}
+
+// TTL returns the time left before the key expires, or zero if the key does
+// not exist.
+func (r *RedisClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.Client.PTTL(ctx, key).Result()
 	if err != nil {
 		return 0, err
 	}
-	return rate, nil
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// GetInt64 returns the counter stored under the key, or zero if the key does
+// not exist.
+func (r *RedisClient) GetInt64(ctx context.Context, key string) (int64, error) {
+	value, err := r.Client.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return value, err
 }
@@ -31,4 +31,10 @@ func TestInvalidLogin(t *testing.T) {
 	resp, err = http.Post(serverURL+"/login", "application/json", bytes.NewBuffer(loginBody))
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// 3. Повторная попытка до истечения задержки
+	resp, err = http.Post(serverURL+"/login", "application/json", bytes.NewBuffer(loginBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
 }
@@ -10,6 +10,8 @@ import (
 
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,6 +27,9 @@ func TestBalanceAndWithdrawal(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusCreated, resp.StatusCode)
 
+	// вывод доступен только после подтверждения email
+	verifyEmail(t, serverURL, user.Email)
+
 	// 2. Логин
 	loginReq := domain.AuthorizationRequest{Username: "userforbalance", Password: "password"}
 	loginBody, _ := json.Marshal(loginReq)
@@ -45,14 +50,21 @@ func TestBalanceAndWithdrawal(t *testing.T) {
 
 	var balanceResp domain.BalanceResponse
 	json.NewDecoder(resp.Body).Decode(&balanceResp)
-	assert.Greater(t, balanceResp.Value, 0.0)
+	assert.True(t, balanceResp.Value.GreaterThan(decimal.Zero))
 
 	// 4. Вывод средств
-	withdrawalReq := domain.WithdrawRequest{Amount: 200.0, Currency: "USD"}
+	withdrawalReq := domain.WithdrawRequest{Money: money.New(decimal.NewFromInt(200), "USD")}
 	withdrawalBody, _ := json.Marshal(withdrawalReq)
 	req, _ = http.NewRequest("POST", serverURL+"/wallet/withdraw", bytes.NewBuffer(withdrawalBody))
 	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
 	resp, err = http.DefaultClient.Do(req)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 5. История: период, который заканчивается раньше начала, отклоняется
+	req, _ = http.NewRequest("GET", serverURL+"/wallet/transactions?from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 }
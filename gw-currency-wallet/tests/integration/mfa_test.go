@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/totp"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMFAFlow(t *testing.T) {
+	config := config.Get()
+	address := net.JoinHostPort(config.HttpHost, config.HttpPort)
+	serverURL := fmt.Sprintf("http://%s/api/v1", address)
+
+	// 1. Регистрация и логин
+	user := domain.RegisterRequest{Username: "userformfa", Email: "userformfa@example.com", Password: "password"}
+	userBody, _ := json.Marshal(user)
+	resp, err := http.Post(serverURL+"/register", "application/json", bytes.NewBuffer(userBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	verifyEmail(t, serverURL, user.Email)
+
+	loginBody, _ := json.Marshal(domain.AuthorizationRequest{Username: user.Username, Password: user.Password})
+	resp, err = http.Post(serverURL+"/login", "application/json", bytes.NewBuffer(loginBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var loginResp domain.LoginResponse
+	json.NewDecoder(resp.Body).Decode(&loginResp)
+	assert.False(t, loginResp.MFARequired)
+	access := loginResp.Access
+
+	// без 2FA крупный вывод не требует кода
+	depositBody, _ := json.Marshal(domain.DepositRequest{Money: money.New(decimal.NewFromInt(2000), "USD")})
+	req, _ := http.NewRequest("POST", serverURL+"/wallet/deposit", bytes.NewBuffer(depositBody))
+	req.Header.Set("Authorization", "Bearer "+access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	withdrawBody, _ := json.Marshal(domain.WithdrawRequest{Money: money.New(decimal.NewFromInt(2000), "USD")})
+	req, _ = http.NewRequest("POST", serverURL+"/wallet/withdraw", bytes.NewBuffer(withdrawBody))
+	req.Header.Set("Authorization", "Bearer "+access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 2. Подключение 2FA
+	req, _ = http.NewRequest("POST", serverURL+"/mfa/enroll", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var enrollResp domain.MFAEnrollResponse
+	json.NewDecoder(resp.Body).Decode(&enrollResp)
+	assert.NotEmpty(t, enrollResp.Secret)
+
+	step := totp.Step(time.Now())
+	code, err := totp.Code(enrollResp.Secret, step)
+	assert.NoError(t, err)
+
+	confirmBody, _ := json.Marshal(domain.MFACodeRequest{Code: code})
+	req, _ = http.NewRequest("POST", serverURL+"/mfa/confirm", bytes.NewBuffer(confirmBody))
+	req.Header.Set("Authorization", "Bearer "+access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var codesResp domain.RecoveryCodesResponse
+	json.NewDecoder(resp.Body).Decode(&codesResp)
+	assert.Len(t, codesResp.RecoveryCodes, 10)
+
+	// 3. Логин теперь требует второй фактор
+	resp, err = http.Post(serverURL+"/login", "application/json", bytes.NewBuffer(loginBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	loginResp = domain.LoginResponse{}
+	json.NewDecoder(resp.Body).Decode(&loginResp)
+	assert.True(t, loginResp.MFARequired)
+	assert.Empty(t, loginResp.Access)
+
+	mfaBody, _ := json.Marshal(domain.MFALoginRequest{MFAToken: loginResp.MFAToken, Code: codesResp.RecoveryCodes[0]})
+	resp, err = http.Post(serverURL+"/login/mfa", "application/json", bytes.NewBuffer(mfaBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tokenResp domain.TokenResponse
+	json.NewDecoder(resp.Body).Decode(&tokenResp)
+	assert.NotEmpty(t, tokenResp.Access)
+
+	// MFA токен одноразовый
+	resp, err = http.Post(serverURL+"/login/mfa", "application/json", bytes.NewBuffer(mfaBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// 4. Крупный вывод средств требует код
+	depositBody, _ = json.Marshal(domain.DepositRequest{Money: money.New(decimal.NewFromInt(5000), "USD")})
+	req, _ = http.NewRequest("POST", serverURL+"/wallet/deposit", bytes.NewBuffer(depositBody))
+	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	withdrawBody, _ = json.Marshal(domain.WithdrawRequest{Money: money.New(decimal.NewFromInt(2000), "USD")})
+	req, _ = http.NewRequest("POST", serverURL+"/wallet/withdraw", bytes.NewBuffer(withdrawBody))
+	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// код уже использованного шага не подходит, следующего — подходит
+	code, err = totp.Code(enrollResp.Secret, step+1)
+	assert.NoError(t, err)
+
+	withdrawBody, _ = json.Marshal(domain.WithdrawRequest{Money: money.New(decimal.NewFromInt(2000), "USD"), MFACode: code})
+	req, _ = http.NewRequest("POST", serverURL+"/wallet/withdraw", bytes.NewBuffer(withdrawBody))
+	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 5. Крупный перевод другому пользователю тоже требует код
+	recipient := domain.RegisterRequest{Username: "userformfarecipient", Email: "userformfarecipient@example.com", Password: "password"}
+	recipientBody, _ := json.Marshal(recipient)
+	resp, err = http.Post(serverURL+"/register", "application/json", bytes.NewBuffer(recipientBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	transferBody, _ := json.Marshal(domain.TransferRequest{Recipient: recipient.Username, Money: money.New(decimal.NewFromInt(2000), "USD")})
+	req, _ = http.NewRequest("POST", serverURL+"/wallet/transfer", bytes.NewBuffer(transferBody))
+	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// ниже порога код не нужен
+	transferBody, _ = json.Marshal(domain.TransferRequest{Recipient: recipient.Username, Money: money.New(decimal.NewFromInt(500), "USD")})
+	req, _ = http.NewRequest("POST", serverURL+"/wallet/transfer", bytes.NewBuffer(transferBody))
+	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordReset(t *testing.T) {
+	config := config.Get()
+	address := net.JoinHostPort(config.HttpHost, config.HttpPort)
+	serverURL := fmt.Sprintf("http://%s/api/v1", address)
+
+	// 1. Регистрация и логин
+	user := domain.RegisterRequest{Username: "userforreset", Email: "userforreset@example.com", Password: "password"}
+	userBody, _ := json.Marshal(user)
+	resp, err := http.Post(serverURL+"/register", "application/json", bytes.NewBuffer(userBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	loginBody, _ := json.Marshal(domain.AuthorizationRequest{Username: user.Username, Password: user.Password})
+	resp, err = http.Post(serverURL+"/login", "application/json", bytes.NewBuffer(loginBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var tokenResp domain.TokenResponse
+	json.NewDecoder(resp.Body).Decode(&tokenResp)
+
+	// 2. Ответ не зависит от того, зарегистрирован ли email
+	forgotBody, _ := json.Marshal(domain.ForgotPasswordRequest{Email: "nobody@example.com"})
+	resp, err = http.Post(serverURL+"/password/forgot", "application/json", bytes.NewBuffer(forgotBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	forgotBody, _ = json.Marshal(domain.ForgotPasswordRequest{Email: user.Email})
+	resp, err = http.Post(serverURL+"/password/forgot", "application/json", bytes.NewBuffer(forgotBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	// 3. Сброс пароля по токену из письма
+	resetBody, _ := json.Marshal(domain.ResetPasswordRequest{Token: mailedToken(t, user.Email), NewPassword: "new password"})
+	resp, err = http.Post(serverURL+"/password/reset", "application/json", bytes.NewBuffer(resetBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// токен одноразовый
+	resp, err = http.Post(serverURL+"/password/reset", "application/json", bytes.NewBuffer(resetBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// 4. Старые сессии завершены
+	refreshBody, _ := json.Marshal(domain.RefreshRequest{TokenHash: tokenResp.Refresh})
+	resp, err = http.Post(serverURL+"/refresh", "application/json", bytes.NewBuffer(refreshBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// 5. Логин с новым паролем
+	loginBody, _ = json.Marshal(domain.AuthorizationRequest{Username: user.Username, Password: "new password"})
+	resp, err = http.Post(serverURL+"/login", "application/json", bytes.NewBuffer(loginBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	json.NewDecoder(resp.Body).Decode(&tokenResp)
+
+	// 6. Смена пароля требует текущий пароль
+	changeBody, _ := json.Marshal(domain.ChangePasswordRequest{OldPassword: "password", NewPassword: "newest password"})
+	req, _ := http.NewRequest("POST", serverURL+"/password/change", bytes.NewBuffer(changeBody))
+	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	changeBody, _ = json.Marshal(domain.ChangePasswordRequest{OldPassword: "new password", NewPassword: "newest password"})
+	req, _ = http.NewRequest("POST", serverURL+"/password/change", bytes.NewBuffer(changeBody))
+	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	refreshBody, _ = json.Marshal(domain.RefreshRequest{TokenHash: tokenResp.Refresh})
+	resp, err = http.Post(serverURL+"/refresh", "application/json", bytes.NewBuffer(refreshBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
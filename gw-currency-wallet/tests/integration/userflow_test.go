@@ -10,6 +10,8 @@ import (
 
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
 	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/domain"
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/pkg/money"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,6 +29,9 @@ func TestUserFlow(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusCreated, resp.StatusCode)
 
+	// обмен доступен только после подтверждения email
+	verifyEmail(t, serverURL, user.Email)
+
 	// 2. Логин
 	loginReq := domain.AuthorizationRequest{Username: "realnewuser", Password: "password"}
 	loginBody, _ := json.Marshal(loginReq)
@@ -39,7 +44,7 @@ func TestUserFlow(t *testing.T) {
 	assert.NotEmpty(t, tokenResp.Access)
 
 	// 3. Депозит средств
-	depositReq := domain.DepositRequest{Amount: 1000.0, Currency: "USD"}
+	depositReq := domain.DepositRequest{Money: money.New(decimal.NewFromInt(1000), "USD")}
 	depositBody, _ := json.Marshal(depositReq)
 	req, _ := http.NewRequest("POST", serverURL+"/wallet/deposit", bytes.NewBuffer(depositBody))
 	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
@@ -48,11 +53,25 @@ func TestUserFlow(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 
 	// 4. Обмен валюты
-	exchangeReq := domain.ExchangeRequest{BaseCurrency: "USD", TargetCurrency: "EUR", Amount: 500.0}
+	exchangeReq := domain.ExchangeRequest{BaseCurrency: "USD", TargetCurrency: "EUR", Amount: decimal.NewFromInt(500)}
 	exchangeBody, _ := json.Marshal(exchangeReq)
 	req, _ = http.NewRequest("POST", serverURL+"/exchange", bytes.NewBuffer(exchangeBody))
 	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
 	resp, err = http.DefaultClient.Do(req)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 5. Выход: отзываются и refresh, и access токен сессии
+	logoutBody, _ := json.Marshal(domain.RefreshRequest{TokenHash: tokenResp.Refresh})
+	req, _ = http.NewRequest("POST", serverURL+"/logout", bytes.NewBuffer(logoutBody))
+	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req, _ = http.NewRequest("GET", serverURL+"/wallet/balance", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenResp.Access)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 }
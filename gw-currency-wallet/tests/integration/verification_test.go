@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mizmorr/gw_currency/gw-currency-wallet/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+var mailedTokenPattern = regexp.MustCompile(`[?&]token=([0-9a-f]+)`)
+
+// verifyEmail подтверждает email по последнему письму, отправленному на него.
+// Сервис должен быть запущен с MAILER.TRANSPORT=file.
+func verifyEmail(t *testing.T, serverURL, email string) {
+	resp, err := http.Get(serverURL + "/verify-email?token=" + mailedToken(t, email))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// mailedToken возвращает токен из ссылки в последнем письме на email.
+func mailedToken(t *testing.T, email string) string {
+	cfg := config.Get()
+	if cfg.Mailer.Transport != "file" {
+		t.Fatal("reading emails requires the file mailer transport")
+	}
+
+	data, err := os.ReadFile(cfg.Mailer.FilePath)
+	assert.NoError(t, err)
+
+	content := string(data)
+	start := strings.LastIndex(content, "To: "+email+"\r\n")
+	assert.NotEqual(t, -1, start)
+
+	match := mailedTokenPattern.FindStringSubmatch(content[start:])
+	if !assert.Len(t, match, 2) {
+		t.FailNow()
+	}
+	return match[1]
+}
@@ -48,15 +48,35 @@ func (repo *PostgresRepo) GetAllRates(ctx context.Context) ([]*model.Rate, error
 	return rates, nil
 }
 
+// setRate inserts the rate of a newly enabled currency and updates the
+// others.
 func (repo *PostgresRepo) setRate(ctx context.Context, rate *model.Rate) error {
-	sql := "update exchange_rate set rate=$1 where currency_code = $2"
+	sql := `INSERT INTO exchange_rate (currency_code, rate) VALUES ($2, $1)
+	ON CONFLICT (currency_code) DO UPDATE SET rate = EXCLUDED.rate`
 
-	row, err := repo.db.Exec(ctx, sql, rate.Value, rate.CurrencyCode)
+	_, err := repo.db.Exec(ctx, sql, rate.Value, rate.CurrencyCode)
 	if err != nil {
 		return errors.Wrap(err, "failed to set rate")
 	}
-	if row.RowsAffected() == 0 {
-		return errors.New("no rows affected")
-	}
 	return nil
 }
+
+func (repo *PostgresRepo) enabledCurrencies(ctx context.Context) ([]string, error) {
+	sql := `SELECT code FROM currencies WHERE enabled ORDER BY code`
+
+	rows, err := repo.db.Query(ctx, sql)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query currencies")
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, errors.Wrap(err, "failed to scan row")
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
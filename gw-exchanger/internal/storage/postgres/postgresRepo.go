@@ -116,11 +116,24 @@ func (repo *PostgresRepo) updater(ctx context.Context) {
 	}
 }
 
+// update fetches the rates of the currencies the wallet service has
+// enabled. The currency table is owned by the wallet service, the exchanger
+// only reads it.
 func (repo *PostgresRepo) update(ctx context.Context) error {
-	rates, err := fetcher.FetchRates(ctx)
+	codes, err := repo.enabledCurrencies(ctx)
+	if err != nil {
+		return err
+	}
+
+	rates, err := fetcher.FetchRates(ctx, codes)
 	if err != nil {
 		return errors.New("Failed to fetch rates")
 	}
+	for _, code := range codes {
+		if _, ok := rates[code]; !ok {
+			repo.log.Warn().Msg("Provider has no rate for " + code + ", skipping")
+		}
+	}
 	for currencyCode, value := range rates {
 		rate := &model.Rate{
 			CurrencyCode: currencyCode,
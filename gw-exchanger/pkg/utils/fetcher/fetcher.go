@@ -16,10 +16,11 @@ type apiResponse struct {
 	Date  string             `json:"date"`
 }
 
-var currenciesName = []string{"RUB", "EUR", "USD"}
-
-func FetchRates(ctx context.Context) (map[string]float64, error) {
-	currencies := make(map[string]float64, 3)
+// FetchRates returns the rates of the given currency codes against RUB.
+// Codes the provider has no rate for are left out of the result, so one
+// unknown code does not stop the others from updating.
+func FetchRates(ctx context.Context, codes []string) (map[string]float64, error) {
+	currencies := make(map[string]float64, len(codes))
 
 	response, err := http.Get(apiURL)
 	if err != nil {
@@ -31,12 +32,10 @@ func FetchRates(ctx context.Context) (map[string]float64, error) {
 	if err = json.NewDecoder(response.Body).Decode(&data); err != nil {
 		return nil, errors.Wrap(err, "Ошибка при декодировании ответа")
 	}
-	for _, currency := range currenciesName {
-		rate, ok := data.Rates[currency]
-		if !ok {
-			return nil, errors.Errorf("Курс для валюты %s не найден", currency)
+	for _, currency := range codes {
+		if rate, ok := data.Rates[currency]; ok {
+			currencies[currency] = rate
 		}
-		currencies[currency] = rate
 	}
 	return currencies, nil
 }